@@ -0,0 +1,78 @@
+package netbuffer
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrAuthFailed is returned by Open when a frame fails authentication.
+	ErrAuthFailed = errors.New("netbuffer: message authentication failed")
+	// ErrNonceSize is returned by Seal for a nonce of wrong length.
+	ErrNonceSize = errors.New("netbuffer: invalid nonce size")
+)
+
+// Seal encrypts all readable bytes of this buffer in place with aead, such
+// as AES-GCM from crypto/cipher or ChaCha20-Poly1305. The nonce is
+// prepended and the tag appended, so that the readable bytes become the
+// frame nonce|ciphertext|tag. If nonce is nil, a random nonce is used.
+func (b *Buffer) Seal(aead cipher.AEAD, nonce, additionalData []byte) error {
+	nonceSize := aead.NonceSize()
+	if nonce != nil && len(nonce) != nonceSize {
+		return ErrNonceSize
+	}
+	overhead := aead.Overhead()
+	// room for the tag even after ensurePrependableBytes shifts the
+	// readable bytes by up to nonceSize
+	b.ensureWritableBytes(nonceSize + overhead)
+	b.ensurePrependableBytes(nonceSize)
+	b.unshare()
+
+	slot := b.buf[b.readerIndex-nonceSize : b.readerIndex]
+	if nonce != nil {
+		copy(slot, nonce)
+	} else if _, err := io.ReadFull(rand.Reader, slot); err != nil {
+		return err
+	}
+	plaintext := b.buf[b.readerIndex:b.writerIndex]
+	aead.Seal(plaintext[:0], slot, plaintext, additionalData)
+	b.readerIndex -= nonceSize
+	b.writerIndex += overhead
+	return nil
+}
+
+// Open decrypts in place the first n readable bytes of this buffer, which
+// are a frame made by Seal, so that the plaintext is left at the
+// beginning of the readable bytes.
+// If the frame fails authentication, it returns ErrAuthFailed and removes
+// the frame, whose bytes are no longer meaningful.
+func (b *Buffer) Open(aead cipher.AEAD, n int, additionalData []byte) error {
+	nonceSize := aead.NonceSize()
+	overhead := aead.Overhead()
+	if n < nonceSize+overhead || n > b.ReadableBytes() {
+		return ErrShortBuffer
+	}
+	b.unshare()
+	if debug {
+		b.gen++
+	}
+
+	start := b.readerIndex
+	nonce := b.buf[start : start+nonceSize]
+	ciphertext := b.buf[start+nonceSize : start+n]
+	if _, err := aead.Open(ciphertext[:0], nonce, ciphertext, additionalData); err != nil {
+		b.Retrieve(n)
+		return ErrAuthFailed
+	}
+	if n == b.ReadableBytes() {
+		b.readerIndex += nonceSize
+		b.writerIndex -= overhead
+		return nil
+	}
+	plaintextLen := n - nonceSize - overhead
+	copy(b.buf[start+nonceSize+overhead:start+n], b.buf[start+nonceSize:start+nonceSize+plaintextLen])
+	b.readerIndex += nonceSize + overhead
+	return nil
+}
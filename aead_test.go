@@ -0,0 +1,91 @@
+package netbuffer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func newGCM(t *testing.T) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("aes.NewCipher error %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM error %v", err)
+	}
+	return aead
+}
+
+func TestSealOpen(t *testing.T) {
+	aead := newGCM(t)
+	ad := []byte("header")
+
+	buf := NewBufferWithSize(16)
+	buf.Append([]byte("first message"))
+	if err := buf.Seal(aead, nil, ad); err != nil {
+		t.Errorf("buf.Seal error %v", err)
+	}
+	n := buf.ReadableBytes()
+	if want := aead.NonceSize() + len("first message") + aead.Overhead(); n != want {
+		t.Errorf("after buf.Seal, buf.ReadableBytes() = %d, want %d", n, want)
+	}
+
+	frames := NewBuffer()
+	frames.Append(buf.PeekAllAsByteSlice())
+	frames.Append([]byte("next"))
+	if err := frames.Open(aead, n, ad); err != nil {
+		t.Errorf("frames.Open error %v", err)
+	}
+	if got := string(frames.PeekAllAsByteSlice()); got != "first message"+"next" {
+		t.Errorf("after frames.Open, readable bytes are %q", got)
+	}
+
+	if err := buf.Open(aead, buf.ReadableBytes(), ad); err != nil {
+		t.Errorf("buf.Open error %v", err)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "first message" {
+		t.Errorf("after buf.Open, readable bytes are %q", got)
+	}
+}
+
+func TestSealNonce(t *testing.T) {
+	aead := newGCM(t)
+	nonce := bytes.Repeat([]byte{1}, aead.NonceSize())
+
+	buf := NewBuffer()
+	buf.Append([]byte("payload"))
+	if err := buf.Seal(aead, nonce[1:], nil); err != ErrNonceSize {
+		t.Errorf("buf.Seal with a short nonce error %v, want %v", err, ErrNonceSize)
+	}
+	if err := buf.Seal(aead, nonce, nil); err != nil {
+		t.Errorf("buf.Seal error %v", err)
+	}
+	if !bytes.Equal(buf.PeekAsByteSlice(len(nonce)), nonce) {
+		t.Error("buf.Seal did not prepend the nonce")
+	}
+}
+
+func TestOpenAuthFailed(t *testing.T) {
+	aead := newGCM(t)
+	buf := NewBuffer()
+	buf.Append([]byte("payload"))
+	if err := buf.Seal(aead, nil, nil); err != nil {
+		t.Errorf("buf.Seal error %v", err)
+	}
+	buf.Append([]byte("next"))
+	n := buf.ReadableBytes() - 4
+	buf.buf[buf.readerIndex+aead.NonceSize()] ^= 1
+
+	if err := buf.Open(aead, n, nil); err != ErrAuthFailed {
+		t.Errorf("buf.Open of a tampered frame error %v, want %v", err, ErrAuthFailed)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "next" {
+		t.Errorf("after a failed buf.Open, readable bytes are %q, want %q", got, "next")
+	}
+	if err := buf.Open(aead, 4, nil); err != ErrShortBuffer {
+		t.Errorf("buf.Open of a short frame error %v, want %v", err, ErrShortBuffer)
+	}
+}
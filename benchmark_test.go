@@ -0,0 +1,517 @@
+package netbuffer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+// integerOps holds the typed functions of one integer type.
+var integerOps = []struct {
+	name    string
+	size    int
+	append  func(b *Buffer) error
+	prepend func(b *Buffer) error
+	peek    func(b *Buffer) error
+	read    func(b *Buffer) error
+}{
+	{"Int8", 1,
+		func(b *Buffer) error { return b.AppendInt8(-8) },
+		func(b *Buffer) error { return b.PrependInt8(-8) },
+		func(b *Buffer) error { _, err := b.PeekInt8(); return err },
+		func(b *Buffer) error { _, err := b.ReadInt8(); return err }},
+	{"Int16", 2,
+		func(b *Buffer) error { return b.AppendInt16(-16) },
+		func(b *Buffer) error { return b.PrependInt16(-16) },
+		func(b *Buffer) error { _, err := b.PeekInt16(); return err },
+		func(b *Buffer) error { _, err := b.ReadInt16(); return err }},
+	{"Int32", 4,
+		func(b *Buffer) error { return b.AppendInt32(-32) },
+		func(b *Buffer) error { return b.PrependInt32(-32) },
+		func(b *Buffer) error { _, err := b.PeekInt32(); return err },
+		func(b *Buffer) error { _, err := b.ReadInt32(); return err }},
+	{"Int64", 8,
+		func(b *Buffer) error { return b.AppendInt64(-64) },
+		func(b *Buffer) error { return b.PrependInt64(-64) },
+		func(b *Buffer) error { _, err := b.PeekInt64(); return err },
+		func(b *Buffer) error { _, err := b.ReadInt64(); return err }},
+	{"Uint8", 1,
+		func(b *Buffer) error { return b.AppendUint8(8) },
+		func(b *Buffer) error { return b.PrependUint8(8) },
+		func(b *Buffer) error { _, err := b.PeekUint8(); return err },
+		func(b *Buffer) error { _, err := b.ReadUint8(); return err }},
+	{"Uint16", 2,
+		func(b *Buffer) error { return b.AppendUint16(16) },
+		func(b *Buffer) error { return b.PrependUint16(16) },
+		func(b *Buffer) error { _, err := b.PeekUint16(); return err },
+		func(b *Buffer) error { _, err := b.ReadUint16(); return err }},
+	{"Uint32", 4,
+		func(b *Buffer) error { return b.AppendUint32(32) },
+		func(b *Buffer) error { return b.PrependUint32(32) },
+		func(b *Buffer) error { _, err := b.PeekUint32(); return err },
+		func(b *Buffer) error { _, err := b.ReadUint32(); return err }},
+	{"Uint64", 8,
+		func(b *Buffer) error { return b.AppendUint64(64) },
+		func(b *Buffer) error { return b.PrependUint64(64) },
+		func(b *Buffer) error { _, err := b.PeekUint64(); return err },
+		func(b *Buffer) error { _, err := b.ReadUint64(); return err }},
+}
+
+func BenchmarkAppend(b *testing.B) {
+	for _, size := range []int{16, 256, 4096} {
+		data := make([]byte, size)
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := NewBuffer()
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Append(data)
+				buf.RetrieveAll()
+			}
+		})
+	}
+}
+
+func BenchmarkAppendString(b *testing.B) {
+	s := string(make([]byte, 256))
+	buf := NewBuffer()
+	b.SetBytes(int64(len(s)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.AppendString(s)
+		buf.RetrieveAll()
+	}
+}
+
+func BenchmarkAppendInteger(b *testing.B) {
+	for _, op := range integerOps {
+		op := op
+		b.Run(op.name, func(b *testing.B) {
+			buf := NewBuffer()
+			b.SetBytes(int64(op.size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := op.append(buf); err != nil {
+					b.Fatal(err)
+				}
+				buf.RetrieveAll()
+			}
+		})
+	}
+}
+
+func BenchmarkPrependInteger(b *testing.B) {
+	for _, op := range integerOps {
+		op := op
+		b.Run(op.name, func(b *testing.B) {
+			buf := NewBuffer()
+			b.SetBytes(int64(op.size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := op.prepend(buf); err != nil {
+					b.Fatal(err)
+				}
+				buf.RetrieveAll()
+			}
+		})
+	}
+}
+
+func BenchmarkPeekInteger(b *testing.B) {
+	for _, op := range integerOps {
+		op := op
+		b.Run(op.name, func(b *testing.B) {
+			buf := NewBuffer()
+			buf.Append(make([]byte, 8))
+			b.SetBytes(int64(op.size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := op.peek(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadInteger(b *testing.B) {
+	for _, op := range integerOps {
+		op := op
+		b.Run(op.name, func(b *testing.B) {
+			buf := NewBuffer()
+			b.SetBytes(int64(op.size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := op.append(buf); err != nil {
+					b.Fatal(err)
+				}
+				if err := op.read(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVarint(b *testing.B) {
+	buf := NewBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.AppendUvarint(uint64(i))
+		if _, err := buf.ReadUvarint(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPeekAsByteSlice(b *testing.B) {
+	buf := NewBuffer()
+	buf.Append(make([]byte, 256))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if len(buf.PeekAsByteSlice(256)) != 256 {
+			b.Fatal("short peek")
+		}
+	}
+}
+
+func BenchmarkView(b *testing.B) {
+	buf := NewBuffer()
+	data := make([]byte, 256)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Append(data)
+		v := buf.ReadView(len(data))
+		v.Release()
+	}
+}
+
+// BenchmarkGrowth appends 64 KiB in 512 byte chunks to a new buffer, so
+// that makeSpace grows the storage several times.
+func BenchmarkGrowth(b *testing.B) {
+	chunk := make([]byte, 512)
+	b.SetBytes(64 << 10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffer()
+		for n := 0; n < 64<<10; n += len(chunk) {
+			buf.Append(chunk)
+		}
+	}
+}
+
+// BenchmarkCompaction appends and retrieves so that a few bytes always
+// stay readable, which makes makeSpace move them to the front instead of
+// growing the storage.
+func BenchmarkCompaction(b *testing.B) {
+	chunk := make([]byte, 300)
+	buf := NewBuffer()
+	buf.Append(chunk[:10])
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Append(chunk)
+		buf.Retrieve(len(chunk))
+	}
+}
+
+// frames returns n frames of a big endian uint32 length and a body of
+// bodySize bytes.
+func frames(n, bodySize int) []byte {
+	var out []byte
+	for i := 0; i < n; i++ {
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], uint32(bodySize))
+		out = append(out, header[:]...)
+		out = append(out, make([]byte, bodySize)...)
+	}
+	return out
+}
+
+// BenchmarkFrameDecode decodes length prefixed frames arriving in reads
+// of 1400 bytes, with Buffer, bytes.Buffer and bufio.Reader.
+func BenchmarkFrameDecode(b *testing.B) {
+	const bodySize = 100
+	stream := frames(100, bodySize)
+	const readSize = 1400
+
+	b.Run("netbuffer", func(b *testing.B) {
+		buf := NewBuffer()
+		body := make([]byte, bodySize)
+		b.SetBytes(int64(len(stream)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for off := 0; off < len(stream); off += readSize {
+				end := off + readSize
+				if end > len(stream) {
+					end = len(stream)
+				}
+				buf.Append(stream[off:end])
+				for buf.ReadableBytes() >= 4 {
+					n, _ := buf.PeekUint32()
+					if buf.ReadableBytes() < 4+int(n) {
+						break
+					}
+					buf.RetrieveUint32()
+					buf.retrieveToByteSlice(int(n), body)
+				}
+			}
+		}
+	})
+
+	b.Run("bytes.Buffer", func(b *testing.B) {
+		var buf bytes.Buffer
+		body := make([]byte, bodySize)
+		b.SetBytes(int64(len(stream)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for off := 0; off < len(stream); off += readSize {
+				end := off + readSize
+				if end > len(stream) {
+					end = len(stream)
+				}
+				buf.Write(stream[off:end])
+				for buf.Len() >= 4 {
+					n := binary.BigEndian.Uint32(buf.Bytes())
+					if buf.Len() < 4+int(n) {
+						break
+					}
+					buf.Next(4)
+					_, _ = buf.Read(body[:n])
+				}
+			}
+		}
+	})
+
+	b.Run("bufio.Reader", func(b *testing.B) {
+		r := &chunkReader{data: stream, size: readSize}
+		br := bufio.NewReader(r)
+		body := make([]byte, bodySize)
+		b.SetBytes(int64(len(stream)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.off = 0
+			br.Reset(r)
+			for {
+				header, err := br.Peek(4)
+				if err != nil {
+					break
+				}
+				n := binary.BigEndian.Uint32(header)
+				_, _ = br.Discard(4)
+				if _, err := io.ReadFull(br, body[:n]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// chunkReader returns data in reads of at most size bytes, like a
+// connection.
+type chunkReader struct {
+	data []byte
+	off  int
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.off == len(r.data) {
+		return 0, io.EOF
+	}
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	n := copy(p, r.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// BenchmarkFrameEncode writes length prefixed frames with Buffer, using
+// PrependUint32 for the length, and with bytes.Buffer and bufio.Writer.
+func BenchmarkFrameEncode(b *testing.B) {
+	body := make([]byte, 100)
+	const count = 100
+	size := int64(count * (4 + len(body)))
+
+	b.Run("netbuffer", func(b *testing.B) {
+		buf := NewBuffer()
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < count; j++ {
+				frame := NewBufferWithSize(len(body))
+				frame.Append(body)
+				_ = frame.PrependUint32(uint32(len(body)))
+				buf.Append(frame.PeekAllAsByteSlice())
+			}
+			buf.RetrieveAll()
+		}
+	})
+
+	b.Run("netbuffer-append", func(b *testing.B) {
+		buf := NewBuffer()
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < count; j++ {
+				_ = buf.AppendUint32(uint32(len(body)))
+				buf.Append(body)
+			}
+			buf.RetrieveAll()
+		}
+	})
+
+	b.Run("bytes.Buffer", func(b *testing.B) {
+		var buf bytes.Buffer
+		var header [4]byte
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < count; j++ {
+				binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+				buf.Write(header[:])
+				buf.Write(body)
+			}
+			buf.Reset()
+		}
+	})
+
+	b.Run("bufio.Writer", func(b *testing.B) {
+		w := bufio.NewWriter(ioutil.Discard)
+		var header [4]byte
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < count; j++ {
+				binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+				_, _ = w.Write(header[:])
+				_, _ = w.Write(body)
+			}
+			_ = w.Flush()
+		}
+	})
+}
+
+type benchItem struct {
+	ID    uint32
+	Delta int32 `nb:"varint"`
+}
+
+type benchMessage struct {
+	Kind  uint16      `nb:"le"`
+	Seq   int         `nb:"i32"`
+	Size  uint64      `nb:"varint"`
+	Name  string      `nb:"len=u8"`
+	Token []byte      `nb:"len=varint"`
+	Items []benchItem `nb:"len=u16"`
+	Tags  []string    `nb:"len=u8"`
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	m := benchMessage{Kind: 1, Seq: 2, Size: 300, Name: "name", Token: []byte{1, 2, 3},
+		Items: []benchItem{{1, -1}, {2, 2}}, Tags: []string{"a", "b"}}
+	buf := NewBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Marshal(buf, &m); err != nil {
+			b.Fatal(err)
+		}
+		var out benchMessage
+		if err := Unmarshal(buf, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkChecksum(b *testing.B) {
+	kinds := []struct {
+		name string
+		kind ChecksumKind
+	}{{"CRC32", CRC32}, {"CRC32C", CRC32C}, {"Adler32", Adler32}, {"XXHash64", XXHash64}}
+	for _, k := range kinds {
+		kind := k.kind
+		b.Run(k.name, func(b *testing.B) {
+			buf := NewBuffer()
+			buf.Append(make([]byte, 4096))
+			b.SetBytes(4096)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := buf.Checksum(kind, 0, 4096); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSealOpen(b *testing.B) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		b.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		b.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	body := make([]byte, 4096)
+	buf := NewBuffer()
+	b.SetBytes(4096)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Append(body)
+		if err := buf.Seal(aead, nonce, nil); err != nil {
+			b.Fatal(err)
+		}
+		if err := buf.Open(aead, buf.ReadableBytes(), nil); err != nil {
+			b.Fatal(err)
+		}
+		buf.RetrieveAll()
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	algos := []struct {
+		name string
+		algo Compression
+	}{{"Gzip", Gzip}, {"Zlib", Zlib}, {"Deflate", Deflate}}
+	body := bytes.Repeat([]byte("netbuffer compresses frames "), 4096/28+1)[:4096]
+	for _, a := range algos {
+		algo := a.algo
+		b.Run(a.name, func(b *testing.B) {
+			src, compressed, dst := NewBuffer(), NewBuffer(), NewBuffer()
+			b.SetBytes(4096)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				src.Append(body)
+				if err := src.CompressInto(compressed, algo); err != nil {
+					b.Fatal(err)
+				}
+				if err := dst.DecompressFrom(compressed, algo, 0); err != nil {
+					b.Fatal(err)
+				}
+				dst.RetrieveAll()
+			}
+		})
+	}
+}
+
+func BenchmarkDump(b *testing.B) {
+	buf := NewBuffer()
+	buf.Append(make([]byte, 256))
+	b.SetBytes(256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := buf.Dump(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
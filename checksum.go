@@ -0,0 +1,131 @@
+package netbuffer
+
+import (
+	"errors"
+	"hash/adler32"
+	"hash/crc32"
+)
+
+// ChecksumKind selects the algorithm of Checksum and friends.
+type ChecksumKind int
+
+// Supported checksum algorithms.
+const (
+	CRC32    ChecksumKind = iota // CRC-32 with the IEEE polynomial, 4 bytes
+	CRC32C                       // CRC-32 with the Castagnoli polynomial, 4 bytes
+	Adler32                      // Adler-32, 4 bytes
+	XXHash64                     // xxHash64 with seed 0, 8 bytes
+)
+
+var (
+	// ErrShortBuffer is returned when the readable bytes of a buffer are
+	// fewer than an operation needs.
+	ErrShortBuffer = errors.New("netbuffer: not enough readable bytes")
+	// ErrChecksumMismatch is returned when a trailing checksum does not match.
+	ErrChecksumMismatch = errors.New("netbuffer: checksum mismatch")
+	// ErrUnknownChecksum is returned for an invalid ChecksumKind.
+	ErrUnknownChecksum = errors.New("netbuffer: unknown checksum kind")
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Size returns count of byte of a checksum of this kind, or 0 if the
+// kind is unknown.
+func (k ChecksumKind) Size() int {
+	switch k {
+	case CRC32, CRC32C, Adler32:
+		return 4
+	case XXHash64:
+		return 8
+	}
+	return 0
+}
+
+func (k ChecksumKind) sum(p []byte) uint64 {
+	switch k {
+	case CRC32:
+		return uint64(crc32.ChecksumIEEE(p))
+	case CRC32C:
+		return uint64(crc32.Checksum(p, castagnoliTable))
+	case Adler32:
+		return uint64(adler32.Checksum(p))
+	default:
+		return xxhash64(p)
+	}
+}
+
+// Checksum computes a checksum over n readable bytes of this buffer,
+// starting off bytes after the beginning of the readable bytes.
+// This function does not modify this buffer.
+func (b *Buffer) Checksum(kind ChecksumKind, off, n int) (uint64, error) {
+	if kind.Size() == 0 {
+		return 0, ErrUnknownChecksum
+	}
+	if off < 0 || n < 0 || off+n > b.ReadableBytes() {
+		return 0, ErrShortBuffer
+	}
+	start := b.readerIndex + off
+	return kind.sum(b.buf[start : start+n]), nil
+}
+
+// AppendChecksum appends a big endian checksum of the readable bytes
+// starting since bytes after the beginning of the readable bytes.
+// To cover what you append for a frame, take since from ReadableBytes
+// before appending the frame.
+func (b *Buffer) AppendChecksum(kind ChecksumKind, since int) error {
+	sum, err := b.Checksum(kind, since, b.ReadableBytes()-since)
+	if err != nil {
+		return err
+	}
+	if kind.Size() == 8 {
+		return b.AppendUint64(sum)
+	}
+	return b.AppendUint32(uint32(sum))
+}
+
+// VerifyChecksum checks the first n readable bytes of this buffer, which
+// are a body followed by its big endian checksum.
+// This function does not modify this buffer.
+func (b *Buffer) VerifyChecksum(kind ChecksumKind, n int) error {
+	size := kind.Size()
+	if size == 0 {
+		return ErrUnknownChecksum
+	}
+	if n < size || n > b.ReadableBytes() {
+		return ErrShortBuffer
+	}
+	body := b.buf[b.readerIndex : b.readerIndex+n-size]
+	trailer := b.buf[b.readerIndex+n-size : b.readerIndex+n]
+	var want uint64
+	for _, c := range trailer {
+		want = want<<8 | uint64(c)
+	}
+	if kind.sum(body) != want {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// StripChecksum verifies the first n readable bytes of this buffer like
+// VerifyChecksum, then removes the checksum, so that the body is left at
+// the beginning of the readable bytes.
+func (b *Buffer) StripChecksum(kind ChecksumKind, n int) error {
+	if err := b.VerifyChecksum(kind, n); err != nil {
+		return err
+	}
+	size := kind.Size()
+	// the checksum is dropped in place, and later appends would write
+	// over it under the Views
+	b.unshare()
+	if n == b.ReadableBytes() {
+		b.writerIndex -= size
+		return nil
+	}
+	if debug {
+		b.gen++
+	}
+	start := b.readerIndex
+	copy(b.buf[start+size:start+n], b.buf[start:start+n-size])
+	b.readerIndex += size
+	return nil
+}
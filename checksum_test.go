@@ -0,0 +1,118 @@
+package netbuffer
+
+import (
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		if got := xxhash64([]byte(c.s)); got != c.want {
+			t.Errorf("xxhash64(%q) = %#x, want %#x", c.s, got, c.want)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("xx123456789"))
+	for _, c := range []struct {
+		kind ChecksumKind
+		want uint64
+	}{
+		{CRC32, 0xcbf43926},
+		{CRC32C, 0xe3069283},
+		{Adler32, 0x091e01de},
+	} {
+		sum, err := buf.Checksum(c.kind, 2, 9)
+		if err != nil {
+			t.Errorf("buf.Checksum(%d) error %v", c.kind, err)
+		}
+		if sum != c.want {
+			t.Errorf("buf.Checksum(%d) = %#x, want %#x", c.kind, sum, c.want)
+		}
+	}
+
+	if _, err := buf.Checksum(CRC32, 3, 9); err != ErrShortBuffer {
+		t.Errorf("buf.Checksum out of range error %v, want %v", err, ErrShortBuffer)
+	}
+	if _, err := buf.Checksum(ChecksumKind(-1), 0, 1); err != ErrUnknownChecksum {
+		t.Errorf("buf.Checksum of unknown kind error %v, want %v", err, ErrUnknownChecksum)
+	}
+}
+
+func TestAppendChecksum(t *testing.T) {
+	for _, kind := range []ChecksumKind{CRC32, CRC32C, Adler32, XXHash64} {
+		buf := NewBuffer()
+		buf.Append([]byte("head"))
+		mark := buf.ReadableBytes()
+		buf.Append([]byte("body"))
+		if err := buf.AppendChecksum(kind, mark); err != nil {
+			t.Errorf("buf.AppendChecksum(%d) error %v", kind, err)
+		}
+		if buf.ReadableBytes() != 8+kind.Size() {
+			t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 8+kind.Size())
+		}
+		buf.Retrieve(4)
+		if err := buf.VerifyChecksum(kind, buf.ReadableBytes()); err != nil {
+			t.Errorf("buf.VerifyChecksum(%d) error %v", kind, err)
+		}
+	}
+}
+
+func TestStripChecksum(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("frame"))
+	if err := buf.AppendChecksum(CRC32C, 0); err != nil {
+		t.Errorf("buf.AppendChecksum error %v", err)
+	}
+	buf.Append([]byte("next"))
+
+	if err := buf.StripChecksum(CRC32C, 9); err != nil {
+		t.Errorf("buf.StripChecksum error %v", err)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "framenext" {
+		t.Errorf("after buf.StripChecksum, readable bytes are %q, want %q", got, "framenext")
+	}
+
+	buf.RetrieveAll()
+	buf.Append([]byte("frame"))
+	if err := buf.AppendChecksum(CRC32, 0); err != nil {
+		t.Errorf("buf.AppendChecksum error %v", err)
+	}
+	buf.buf[buf.readerIndex] = 'F'
+	if err := buf.StripChecksum(CRC32, buf.ReadableBytes()); err != ErrChecksumMismatch {
+		t.Errorf("buf.StripChecksum of a corrupted frame error %v, want %v", err, ErrChecksumMismatch)
+	}
+	if buf.ReadableBytes() != 9 {
+		t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 9)
+	}
+}
+
+func TestStripChecksumUnderView(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("frame"))
+	if err := buf.AppendChecksum(CRC32C, 0); err != nil {
+		t.Errorf("buf.AppendChecksum error %v", err)
+	}
+	v := buf.PeekView(buf.ReadableBytes())
+	want := v.String()
+	if err := buf.StripChecksum(CRC32C, buf.ReadableBytes()); err != nil {
+		t.Errorf("buf.StripChecksum error %v", err)
+	}
+	buf.Append([]byte("next"))
+	if v.String() != want {
+		t.Errorf("after buf.Append, v.String() = %q, want %q", v.String(), want)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "framenext" {
+		t.Errorf("readable bytes are %q, want %q", got, "framenext")
+	}
+	v.Release()
+}
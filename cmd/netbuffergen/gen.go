@@ -0,0 +1,765 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	netbufferPath   = "github.com/ZhangGuangxu/netbuffer"
+	generatedHeader = "// Code generated by netbuffergen. DO NOT EDIT."
+	directive       = "//netbuffer:generate"
+)
+
+// pkg holds the type declarations of the package to generate for.
+type pkg struct {
+	name   string
+	types  map[string]*ast.TypeSpec
+	marked []string // structs with a //netbuffer:generate comment, in source order
+}
+
+func parsePackage(dir string) (*pkg, error) {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("found %d packages in %s, want 1", len(pkgs), dir)
+	}
+
+	p := &pkg{types: make(map[string]*ast.TypeSpec)}
+	for name, astPkg := range pkgs {
+		p.name = name
+		files := make([]string, 0, len(astPkg.Files))
+		for fileName := range astPkg.Files {
+			files = append(files, fileName)
+		}
+		sort.Strings(files)
+		for _, fileName := range files {
+			f := astPkg.Files[fileName]
+			if isGenerated(f) {
+				continue
+			}
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					p.types[ts.Name.Name] = ts
+					_, isStruct := ts.Type.(*ast.StructType)
+					if isStruct && (hasDirective(gd.Doc) || hasDirective(ts.Doc)) {
+						p.marked = append(p.marked, ts.Name.Name)
+					}
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if c.Text == generatedHeader {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasDirective(cg *ast.CommentGroup) bool {
+	if cg == nil {
+		return false
+	}
+	for _, c := range cg.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// generate returns the formatted source of the methods of the named
+// structs, or of the marked ones if names is empty.
+func generate(p *pkg, names []string) ([]byte, error) {
+	if len(names) == 0 {
+		names = p.marked
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no struct marked %s and no -type given", directive)
+	}
+
+	g := &generator{pkg: p, imports: make(map[string]bool)}
+	for _, name := range names {
+		if err := g.genStruct(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s\n\npackage %s\n\nimport (\n", generatedHeader, p.name)
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	fmt.Fprintf(&out, "\n%q\n)\n", netbufferPath)
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// Kinds of ftype.
+const (
+	kindInt = iota
+	kindUint
+	kindFloat
+	kindBool
+	kindString
+	kindBytes
+	kindSlice
+	kindArray
+	kindStruct
+)
+
+// intFormat is the wire format of an integer, as in netbuffer.Marshal.
+type intFormat struct {
+	size   int // 0 for varint
+	signed bool
+	le     bool
+}
+
+var intFormats = map[string]intFormat{
+	"i8": {1, true, false}, "i16": {2, true, false}, "i32": {4, true, false}, "i64": {8, true, false},
+	"u8": {1, false, false}, "u16": {2, false, false}, "u32": {4, false, false}, "u64": {8, false, false},
+	"varint": {0, false, false},
+}
+
+// ftype describes how one field, or element, is encoded.
+type ftype struct {
+	kind   int
+	goType string    // type decoded values are converted to
+	goSize int       // count of byte of integer Go types, 0 for int and uint
+	format intFormat // of integers and floats
+	length intFormat // of the prefix of strings, bytes and slices
+	elem   *ftype
+}
+
+// options are the parsed nb tag of a field.
+type options struct {
+	format string
+	le     bool
+	length string
+}
+
+func parseOptions(tag string) (options, error) {
+	var opts options
+	if tag == "" {
+		return opts, nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch opt = strings.TrimSpace(opt); {
+		case opt == "le":
+			opts.le = true
+		case opt == "be":
+			opts.le = false
+		case strings.HasPrefix(opt, "len="):
+			opts.length = strings.TrimPrefix(opt, "len=")
+			if _, ok := intFormats[opts.length]; !ok || opts.length[0] == 'i' {
+				return opts, fmt.Errorf("invalid length format %q", opts.length)
+			}
+		case opt == "f32" || opt == "f64":
+			opts.format = opt
+		default:
+			if _, ok := intFormats[opt]; !ok {
+				return opts, fmt.Errorf("unknown option %q", opt)
+			}
+			opts.format = opt
+		}
+	}
+	return opts, nil
+}
+
+// basic types and their default formats
+var basicTypes = map[string]ftype{
+	"int8":    {kind: kindInt, goSize: 1, format: intFormat{size: 1, signed: true}},
+	"int16":   {kind: kindInt, goSize: 2, format: intFormat{size: 2, signed: true}},
+	"int32":   {kind: kindInt, goSize: 4, format: intFormat{size: 4, signed: true}},
+	"rune":    {kind: kindInt, goSize: 4, format: intFormat{size: 4, signed: true}},
+	"int64":   {kind: kindInt, goSize: 8, format: intFormat{size: 8, signed: true}},
+	"int":     {kind: kindInt, format: intFormat{size: 8, signed: true}},
+	"uint8":   {kind: kindUint, goSize: 1, format: intFormat{size: 1}},
+	"byte":    {kind: kindUint, goSize: 1, format: intFormat{size: 1}},
+	"uint16":  {kind: kindUint, goSize: 2, format: intFormat{size: 2}},
+	"uint32":  {kind: kindUint, goSize: 4, format: intFormat{size: 4}},
+	"uint64":  {kind: kindUint, goSize: 8, format: intFormat{size: 8}},
+	"uint":    {kind: kindUint, format: intFormat{size: 8}},
+	"float32": {kind: kindFloat, format: intFormat{size: 4}},
+	"float64": {kind: kindFloat, format: intFormat{size: 8}},
+	"bool":    {kind: kindBool},
+	"string":  {kind: kindString},
+}
+
+// resolve returns how a field of type expr with opts is encoded.
+// goType is the name decoded values are converted to, or empty.
+func (g *generator) resolve(expr ast.Expr, opts options, goType string) (*ftype, error) {
+	typeName := types.ExprString(expr)
+	if goType == "" {
+		goType = typeName
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if basic, ok := basicTypes[e.Name]; ok {
+			t := basic
+			t.goType = goType
+			return g.applyOptions(&t, opts)
+		}
+		ts, ok := g.pkg.types[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %s", e.Name)
+		}
+		if _, ok := ts.Type.(*ast.StructType); ok {
+			if opts != (options{}) {
+				return nil, fmt.Errorf("options on struct type %s", e.Name)
+			}
+			return &ftype{kind: kindStruct, goType: goType}, nil
+		}
+		return g.resolve(ts.Type, opts, goType)
+	case *ast.SelectorExpr:
+		if opts != (options{}) {
+			return nil, fmt.Errorf("options on struct type %s", typeName)
+		}
+		return &ftype{kind: kindStruct, goType: goType}, nil
+	case *ast.ArrayType:
+		length := lengthFormat(opts)
+		if e.Len == nil {
+			if elt, ok := e.Elt.(*ast.Ident); ok && (elt.Name == "byte" || elt.Name == "uint8") && opts.format == "" {
+				return &ftype{kind: kindBytes, goType: goType, length: length}, nil
+			}
+		}
+		if e.Len != nil && opts.length != "" {
+			return nil, fmt.Errorf("len= on type %s", goType)
+		}
+		elemOpts := opts
+		elemOpts.length = ""
+		elem, err := g.resolve(e.Elt, elemOpts, "")
+		if err != nil {
+			return nil, err
+		}
+		if e.Len == nil {
+			return &ftype{kind: kindSlice, goType: goType, length: length, elem: elem}, nil
+		}
+		return &ftype{kind: kindArray, goType: goType, elem: elem}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typeName)
+}
+
+func (g *generator) applyOptions(t *ftype, opts options) (*ftype, error) {
+	if opts.length != "" && t.kind != kindString {
+		return nil, fmt.Errorf("len= on type %s", t.goType)
+	}
+	switch t.kind {
+	case kindString:
+		if opts.format != "" {
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t.goType)
+		}
+		t.length = lengthFormat(opts)
+	case kindBool:
+		if opts.format != "" {
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t.goType)
+		}
+	case kindFloat:
+		switch opts.format {
+		case "":
+		case "f32":
+			t.format.size = 4
+		case "f64":
+			t.format.size = 8
+		default:
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t.goType)
+		}
+	case kindInt, kindUint:
+		if opts.format == "f32" || opts.format == "f64" {
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t.goType)
+		}
+		if f, ok := intFormats[opts.format]; ok {
+			t.format = f
+		}
+		if opts.format == "varint" {
+			t.format.signed = t.kind == kindInt
+		}
+	}
+	t.format.le = opts.le
+	return t, nil
+}
+
+func lengthFormat(opts options) intFormat {
+	if opts.length == "" {
+		return intFormat{size: 4, le: opts.le}
+	}
+	f := intFormats[opts.length]
+	f.le = opts.le
+	return f
+}
+
+// generator accumulates the generated methods.
+type generator struct {
+	pkg     *pkg
+	imports map[string]bool
+	body    bytes.Buffer
+
+	// per method
+	code  bytes.Buffer
+	fixed int // constant part of EncodedSize
+	depth int // nesting of loops, names loop variables
+}
+
+// field is a field to encode, with its Go expression.
+type field struct {
+	name string
+	expr string
+	t    *ftype
+}
+
+func (g *generator) genStruct(name string) error {
+	ts, ok := g.pkg.types[name]
+	if !ok {
+		return fmt.Errorf("type %s not found", name)
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct", name)
+	}
+
+	var fields []field
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(s).Get("nb")
+		}
+		if tag == "-" {
+			continue
+		}
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 { // embedded
+			typeName := types.ExprString(f.Type)
+			names = append(names, typeName[strings.LastIndex(typeName, ".")+1:])
+		}
+		for _, fieldName := range names {
+			if !ast.IsExported(fieldName) {
+				continue
+			}
+			opts, err := parseOptions(tag)
+			if err != nil {
+				return fmt.Errorf("field %s.%s: %v", name, fieldName, err)
+			}
+			t, err := g.resolve(f.Type, opts, "")
+			if err != nil {
+				return fmt.Errorf("field %s.%s: %v", name, fieldName, err)
+			}
+			fields = append(fields, field{name: fieldName, expr: "m." + fieldName, t: t})
+		}
+	}
+
+	g.fixed = 0
+	g.code.Reset()
+	for _, f := range fields {
+		g.size(f.t, f.expr)
+	}
+	fmt.Fprintf(&g.body, "\n// EncodedSize returns count of byte of m encoded by EncodeTo.\n")
+	fmt.Fprintf(&g.body, "func (m *%s) EncodedSize() int {\nn := %d\n", name, g.fixed)
+	g.body.Write(g.code.Bytes())
+	g.body.WriteString("return n\n}\n")
+
+	g.code.Reset()
+	for _, f := range fields {
+		g.encode(f.t, f.expr, f.name)
+	}
+	fmt.Fprintf(&g.body, "\n// EncodeTo appends m to b.\n")
+	fmt.Fprintf(&g.body, "func (m *%s) EncodeTo(b *netbuffer.Buffer) error {\nb.EnsureWritableBytes(m.EncodedSize())\n", name)
+	g.body.Write(g.code.Bytes())
+	g.body.WriteString("return nil\n}\n")
+
+	g.code.Reset()
+	for _, f := range fields {
+		g.decode(f.t, f.expr, f.name)
+	}
+	fmt.Fprintf(&g.body, "\n// DecodeBytes parses m from the beginning of p and returns count of byte\n// parsed. If p ends in the middle of m, it returns netbuffer.ErrShortBuffer.\n")
+	fmt.Fprintf(&g.body, "func (m *%s) DecodeBytes(p []byte) (int, error) {\noff := 0\n", name)
+	g.body.Write(g.code.Bytes())
+	g.body.WriteString("return off, nil\n}\n")
+
+	fmt.Fprintf(&g.body, "\n// DecodeFrom parses m from the readable bytes of b and removes them from b.\n")
+	fmt.Fprintf(&g.body, "// If they end in the middle of m, it returns netbuffer.ErrShortBuffer.\n")
+	fmt.Fprintf(&g.body, "// If DecodeFrom returns an error, b is left unchanged.\n")
+	fmt.Fprintf(&g.body, "func (m *%s) DecodeFrom(b *netbuffer.Buffer) error {\n", name)
+	g.body.WriteString("n, err := m.DecodeBytes(b.PeekAllAsByteSlice())\nif err != nil {\nreturn err\n}\nb.Retrieve(n)\nreturn nil\n}\n")
+	return nil
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.code, format, args...)
+	g.code.WriteByte('\n')
+}
+
+func (g *generator) loopVar() string {
+	v := fmt.Sprintf("i%d", g.depth)
+	g.depth++
+	return v
+}
+
+// fixedSize returns count of byte of every value of t, or -1.
+func fixedSize(t *ftype) int {
+	switch t.kind {
+	case kindInt, kindUint, kindFloat:
+		if t.format.size == 0 {
+			return -1
+		}
+		return t.format.size
+	case kindBool:
+		return 1
+	}
+	return -1
+}
+
+func (g *generator) size(t *ftype, expr string) {
+	if n := fixedSize(t); n >= 0 {
+		g.fixed += n
+		return
+	}
+	switch t.kind {
+	case kindInt:
+		g.p("n += netbuffer.VarintSize(int64(%s))", expr)
+	case kindUint:
+		g.p("n += netbuffer.UvarintSize(uint64(%s))", expr)
+	case kindString, kindBytes:
+		g.sizeLength(t.length, expr)
+		g.p("n += len(%s)", expr)
+	case kindSlice, kindArray:
+		if t.kind == kindSlice {
+			g.sizeLength(t.length, expr)
+		}
+		if n := fixedSize(t.elem); n >= 0 {
+			g.p("n += len(%s) * %d", expr, n)
+			return
+		}
+		i := g.loopVar()
+		g.p("for %s := range %s {", i, expr)
+		fixed := g.fixed
+		g.fixed = 0
+		g.size(t.elem, expr+"["+i+"]")
+		if g.fixed != 0 {
+			g.p("n += %d", g.fixed)
+		}
+		g.fixed = fixed
+		g.p("}")
+		g.depth--
+	case kindStruct:
+		g.p("n += %s.EncodedSize()", expr)
+	}
+}
+
+func (g *generator) sizeLength(f intFormat, expr string) {
+	if f.size == 0 {
+		g.p("n += netbuffer.UvarintSize(uint64(len(%s)))", expr)
+	} else {
+		g.fixed += f.size
+	}
+}
+
+func (g *generator) encode(t *ftype, expr, name string) {
+	switch t.kind {
+	case kindInt, kindUint:
+		g.checkRange(t, expr, name)
+		g.encodeInt(t.format, t.kind == kindInt, expr)
+	case kindFloat:
+		g.imports["math"] = true
+		if t.format.size == 4 {
+			g.encodeInt(t.format, false, fmt.Sprintf("math.Float32bits(float32(%s))", expr))
+		} else {
+			g.encodeInt(t.format, false, fmt.Sprintf("math.Float64bits(float64(%s))", expr))
+		}
+	case kindBool:
+		g.p("{\nvar v uint8\nif %s {\nv = 1\n}", expr)
+		g.p("if err := b.AppendUint8(v); err != nil {\nreturn err\n}\n}")
+	case kindString:
+		g.encodeLength(t.length, expr, name)
+		g.p("b.AppendString(string(%s))", expr)
+	case kindBytes:
+		g.encodeLength(t.length, expr, name)
+		g.p("b.Append(%s)", expr)
+	case kindSlice, kindArray:
+		if t.kind == kindSlice {
+			g.encodeLength(t.length, expr, name)
+		}
+		i := g.loopVar()
+		g.p("for %s := range %s {", i, expr)
+		g.encode(t.elem, expr+"["+i+"]", name)
+		g.p("}")
+		g.depth--
+	case kindStruct:
+		g.p("if err := %s.EncodeTo(b); err != nil {\nreturn err\n}", expr)
+	}
+}
+
+// checkRange returns an error from the generated code if the integer expr
+// does not fit the format of t, as netbuffer.Marshal does.
+func (g *generator) checkRange(t *ftype, expr, name string) {
+	f := t.format
+	if f.size == 0 {
+		return
+	}
+	goSize := t.goSize
+	if goSize == 0 {
+		goSize = 8
+	}
+	bitCount := uint(8 * f.size)
+	var cond string
+	if t.kind == kindInt {
+		switch {
+		case f.signed && f.size >= goSize:
+			return
+		case f.signed:
+			cond = fmt.Sprintf("x < %d || x > %d", -(int64(1) << (bitCount - 1)), int64(1)<<(bitCount-1)-1)
+		case f.size == 8:
+			cond = "x < 0"
+		default:
+			cond = fmt.Sprintf("x < 0 || x > %d", uint64(1)<<bitCount-1)
+		}
+		g.p("if x := int64(%s); %s {", expr, cond)
+	} else {
+		switch {
+		case !f.signed && f.size >= goSize || f.signed && f.size > goSize:
+			return
+		case f.signed:
+			cond = fmt.Sprintf("x > %d", uint64(1)<<(bitCount-1)-1)
+		default:
+			cond = fmt.Sprintf("x > %d", uint64(1)<<bitCount-1)
+		}
+		g.p("if x := uint64(%s); %s {", expr, cond)
+	}
+	g.imports["fmt"] = true
+	g.p("return fmt.Errorf(\"netbuffer: field %s: %%d overflows %d bytes\", x)\n}", name, f.size)
+}
+
+func (g *generator) encodeInt(f intFormat, signed bool, expr string) {
+	if f.size == 0 {
+		if signed {
+			g.p("b.AppendVarint(int64(%s))", expr)
+		} else {
+			g.p("b.AppendUvarint(uint64(%s))", expr)
+		}
+		return
+	}
+	bitCount := 8 * f.size
+	if f.le && f.size > 1 {
+		g.imports["math/bits"] = true
+		g.p("if err := b.AppendUint%d(bits.ReverseBytes%d(uint%d(%s))); err != nil {\nreturn err\n}",
+			bitCount, bitCount, bitCount, expr)
+		return
+	}
+	method, typ := "Uint", "uint"
+	if f.signed {
+		method, typ = "Int", "int"
+	}
+	g.p("if err := b.Append%s%d(%s%d(%s)); err != nil {\nreturn err\n}", method, bitCount, typ, bitCount, expr)
+}
+
+func (g *generator) encodeLength(f intFormat, expr, name string) {
+	if f.size > 0 && f.size < 8 {
+		g.imports["fmt"] = true
+		max := uint64(1)<<uint(8*f.size) - 1
+		g.p("if uint64(len(%s)) > %d {", expr, max)
+		g.p("return fmt.Errorf(\"netbuffer: length %%d of %s overflows %d bytes\", len(%s))\n}", name, f.size, expr)
+	}
+	g.encodeInt(f, false, "len("+expr+")")
+}
+
+func (g *generator) decode(t *ftype, lv, name string) {
+	switch t.kind {
+	case kindInt, kindUint:
+		g.decodeInteger(t, lv, name)
+	case kindFloat:
+		g.imports["math"] = true
+		if t.format.size == 4 {
+			g.decodeInt(t.format, false, lv, t.goType, "math.Float32frombits(%s)", "float32")
+		} else {
+			g.decodeInt(t.format, false, lv, t.goType, "math.Float64frombits(%s)", "float64")
+		}
+	case kindBool:
+		g.p("if off >= len(p) {\nreturn 0, netbuffer.ErrShortBuffer\n}")
+		g.p("%s = %s\noff++", lv, convert(t.goType, "p[off] != 0", "bool"))
+	case kindString:
+		g.p("{")
+		g.decodeLength(t.length)
+		g.p("%s = %s(p[off : off+int(n)])\noff += int(n)\n}", lv, t.goType)
+	case kindBytes:
+		g.p("{")
+		g.decodeLength(t.length)
+		g.p("%s = %s\noff += int(n)\n}", lv,
+			convert(t.goType, "append([]byte(nil), p[off:off+int(n)]...)", "[]byte"))
+	case kindSlice:
+		g.p("{")
+		g.decodeLength(t.length)
+		g.p("%s = make(%s, int(n))", lv, t.goType)
+		g.decodeElems(t.elem, lv, name)
+		g.p("}")
+	case kindArray:
+		g.decodeElems(t.elem, lv, name)
+	case kindStruct:
+		g.p("{\nn, err := %s.DecodeBytes(p[off:])\nif err != nil {\nreturn 0, err\n}\noff += n\n}", lv)
+	}
+}
+
+func (g *generator) decodeElems(elem *ftype, lv, name string) {
+	i := g.loopVar()
+	g.p("for %s := range %s {", i, lv)
+	g.decode(elem, lv+"["+i+"]", name)
+	g.p("}")
+	g.depth--
+}
+
+// decodeInt reads an integer, applies wrap of type wrapType to it unless
+// wrap is empty, and assigns the result converted to goType to lv.
+func (g *generator) decodeInt(f intFormat, signed bool, lv, goType, wrap, wrapType string) {
+	g.p("{")
+	val, typ := g.readInt(f, signed, "v")
+	if wrap != "" {
+		val, typ = fmt.Sprintf(wrap, val), wrapType
+	}
+	g.p("%s = %s\n}", lv, convert(goType, val, typ))
+}
+
+// decodeInteger reads an integer of t and assigns it to lv, returning an
+// error from the generated code if it does not fit t.goType, as
+// netbuffer.Unmarshal does.
+func (g *generator) decodeInteger(t *ftype, lv, name string) {
+	g.p("{")
+	val, typ := g.readInt(t.format, t.kind == kindInt, "v")
+	readSize, readSigned := t.format.size, t.format.signed
+	if readSize == 0 {
+		readSize, readSigned = 8, t.kind == kindInt
+	}
+	goSize := t.goSize
+	if goSize == 0 {
+		goSize = 4 // int and uint have at least 32 bits
+	}
+	signed := t.kind == kindInt
+	x := "v"
+	if val != x {
+		x = "x"
+	}
+	var cond string
+	switch {
+	case readSigned && signed:
+		if readSize > goSize {
+			cond = fmt.Sprintf("int64(%s(%s)) != int64(%s)", t.goType, x, x)
+		}
+	case readSigned:
+		cond = fmt.Sprintf("%s < 0 || uint64(%s(%s)) != uint64(%s)", x, t.goType, x, x)
+	case signed:
+		if readSize >= goSize {
+			cond = fmt.Sprintf("%s(%s) < 0 || uint64(%s(%s)) != uint64(%s)", t.goType, x, t.goType, x, x)
+		}
+	default:
+		if readSize > goSize {
+			cond = fmt.Sprintf("uint64(%s(%s)) != uint64(%s)", t.goType, x, x)
+		}
+	}
+	if cond == "" {
+		g.p("%s = %s\n}", lv, convert(t.goType, val, typ))
+		return
+	}
+	g.imports["fmt"] = true
+	if x != val {
+		g.p("%s := %s", x, val)
+	}
+	g.p("if %s {", cond)
+	g.p("return 0, fmt.Errorf(\"netbuffer: field %s: %%d overflows %s\", %s)\n}", name, t.goType, x)
+	g.p("%s = %s\n}", lv, convert(t.goType, x, typ))
+}
+
+// convert returns expr of type typ converted to goType.
+func convert(goType, expr, typ string) string {
+	if goType == typ {
+		return expr
+	}
+	return goType + "(" + expr + ")"
+}
+
+// readInt declares v, reads an integer in format f at off of p into it
+// and returns the expression and type of the integer.
+func (g *generator) readInt(f intFormat, signed bool, v string) (string, string) {
+	bitCount := 8 * f.size
+	switch {
+	case f.size == 0:
+		g.imports["encoding/binary"] = true
+		if signed {
+			g.p("%s, k := binary.Varint(p[off:])", v)
+		} else {
+			g.p("%s, k := binary.Uvarint(p[off:])", v)
+		}
+		g.p("if k == 0 {\nreturn 0, netbuffer.ErrShortBuffer\n}")
+		g.p("if k < 0 {\nreturn 0, netbuffer.ErrVarintOverflow\n}")
+		g.p("off += k")
+		if signed {
+			return v, "int64"
+		}
+		return v, "uint64"
+	case f.size == 1:
+		g.p("if off >= len(p) {\nreturn 0, netbuffer.ErrShortBuffer\n}")
+		g.p("%s := p[off]\noff++", v)
+	default:
+		g.imports["encoding/binary"] = true
+		order := "BigEndian"
+		if f.le {
+			order = "LittleEndian"
+		}
+		g.p("if len(p)-off < %d {\nreturn 0, netbuffer.ErrShortBuffer\n}", f.size)
+		g.p("%s := binary.%s.Uint%d(p[off:])\noff += %d", v, order, bitCount, f.size)
+	}
+	if f.signed {
+		return fmt.Sprintf("int%d(%s)", bitCount, v), fmt.Sprintf("int%d", bitCount)
+	}
+	return v, fmt.Sprintf("uint%d", bitCount)
+}
+
+// decodeLength declares n and reads a length prefix into it, checking
+// that this many bytes follow.
+func (g *generator) decodeLength(f intFormat) {
+	if val, _ := g.readInt(f, false, "n"); val != "n" {
+		g.p("n = %s", val)
+	}
+	g.p("if uint64(len(p)-off) < uint64(n) {\nreturn 0, netbuffer.ErrShortBuffer\n}")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateExample(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	p, err := parsePackage(dir)
+	if err != nil {
+		t.Fatalf("parsePackage error %v", err)
+	}
+	if strings.Join(p.marked, ",") != "Item,Login,Limits" {
+		t.Errorf("marked structs are %v, want [Item Login Limits]", p.marked)
+	}
+	got, err := generate(p, nil)
+	if err != nil {
+		t.Fatalf("generate error %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, "example_netbuffer.go"))
+	if err != nil {
+		t.Fatalf("os.ReadFile error %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("generated code differs from example_netbuffer.go, run go generate in internal/example")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{"type T struct{ M map[int]int }", "unsupported type"},
+		{"type T struct{ P *int }", "unsupported type"},
+		{"type T struct{ A int `nb:\"u12\"`}", "unknown option"},
+		{"type T struct{ A int `nb:\"len=u8\"`}", "len= on type"},
+		{"type T struct{ A [2]string `nb:\"len=u8\"`}", "len= on type"},
+		{"type T struct{ S string `nb:\"len=i8\"`}", "invalid length format"},
+		{"type T struct{ F float32 `nb:\"u8\"`}", "option u8 on type"},
+		{"type T struct{ B bool `nb:\"f32\"`}", "option f32 on type"},
+		{"type U struct{}\ntype T struct{ U U `nb:\"le\"`}", "options on struct type"},
+	} {
+		dir := t.TempDir()
+		src := "package p\n\n" + c.src + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0644); err != nil {
+			t.Fatalf("os.WriteFile error %v", err)
+		}
+		p, err := parsePackage(dir)
+		if err != nil {
+			t.Fatalf("parsePackage error %v", err)
+		}
+		_, err = generate(p, []string{"T"})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("generate(%q) error %v, want %q", c.src, err, c.want)
+		}
+	}
+}
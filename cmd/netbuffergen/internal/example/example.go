@@ -0,0 +1,50 @@
+// Package example holds message structs for testing netbuffergen.
+package example
+
+//go:generate go run github.com/ZhangGuangxu/netbuffer/cmd/netbuffergen
+
+// MsgID identifies a message.
+type MsgID uint16
+
+// Item is an entry of an inventory.
+//
+//netbuffer:generate
+type Item struct {
+	ID    uint32
+	Count int16 `nb:"varint"`
+}
+
+// Login is sent by a client after connecting.
+//
+//netbuffer:generate
+type Login struct {
+	ID      MsgID
+	Kind    uint16 `nb:"u16,le"`
+	Seq     int    `nb:"i32"`
+	Delta   int32  `nb:"le"`
+	Name    string `nb:"len=u8"`
+	Token   []byte `nb:"len=varint"`
+	Ratio   float32
+	Scale   float64 `nb:"f32,le"`
+	OK      bool
+	Items   []Item   `nb:"len=u16"`
+	Ports   []uint16 `nb:"le,len=u8"`
+	Tags    []string `nb:"len=u8"`
+	Pad     [2]uint8
+	Matrix  [2][]int8
+	Size    uint64 `nb:"varint"`
+	Skipped int    `nb:"-"`
+	hidden  int
+}
+
+// Limits has integers encoded in formats they may not fit.
+//
+//netbuffer:generate
+type Limits struct {
+	Small int8   `nb:"i16"`
+	Byte  uint8  `nb:"i8"`
+	Count uint16 `nb:"i32"`
+	Delta int32  `nb:"u16"`
+	Big   int64  `nb:"u64"`
+	Level int    `nb:"u8"`
+}
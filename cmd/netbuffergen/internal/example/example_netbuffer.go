@@ -0,0 +1,527 @@
+// Code generated by netbuffergen. DO NOT EDIT.
+
+package example
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// EncodedSize returns count of byte of m encoded by EncodeTo.
+func (m *Item) EncodedSize() int {
+	n := 4
+	n += netbuffer.VarintSize(int64(m.Count))
+	return n
+}
+
+// EncodeTo appends m to b.
+func (m *Item) EncodeTo(b *netbuffer.Buffer) error {
+	b.EnsureWritableBytes(m.EncodedSize())
+	if err := b.AppendUint32(uint32(m.ID)); err != nil {
+		return err
+	}
+	b.AppendVarint(int64(m.Count))
+	return nil
+}
+
+// DecodeBytes parses m from the beginning of p and returns count of byte
+// parsed. If p ends in the middle of m, it returns netbuffer.ErrShortBuffer.
+func (m *Item) DecodeBytes(p []byte) (int, error) {
+	off := 0
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint32(p[off:])
+		off += 4
+		m.ID = v
+	}
+	{
+		v, k := binary.Varint(p[off:])
+		if k == 0 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		if k < 0 {
+			return 0, netbuffer.ErrVarintOverflow
+		}
+		off += k
+		if int64(int16(v)) != int64(v) {
+			return 0, fmt.Errorf("netbuffer: field Count: %d overflows int16", v)
+		}
+		m.Count = int16(v)
+	}
+	return off, nil
+}
+
+// DecodeFrom parses m from the readable bytes of b and removes them from b.
+// If they end in the middle of m, it returns netbuffer.ErrShortBuffer.
+// If DecodeFrom returns an error, b is left unchanged.
+func (m *Item) DecodeFrom(b *netbuffer.Buffer) error {
+	n, err := m.DecodeBytes(b.PeekAllAsByteSlice())
+	if err != nil {
+		return err
+	}
+	b.Retrieve(n)
+	return nil
+}
+
+// EncodedSize returns count of byte of m encoded by EncodeTo.
+func (m *Login) EncodedSize() int {
+	n := 26
+	n += len(m.Name)
+	n += netbuffer.UvarintSize(uint64(len(m.Token)))
+	n += len(m.Token)
+	for i0 := range m.Items {
+		n += m.Items[i0].EncodedSize()
+	}
+	n += len(m.Ports) * 2
+	for i0 := range m.Tags {
+		n += len(m.Tags[i0])
+		n += 4
+	}
+	n += len(m.Pad) * 1
+	for i0 := range m.Matrix {
+		n += len(m.Matrix[i0]) * 1
+		n += 4
+	}
+	n += netbuffer.UvarintSize(uint64(m.Size))
+	return n
+}
+
+// EncodeTo appends m to b.
+func (m *Login) EncodeTo(b *netbuffer.Buffer) error {
+	b.EnsureWritableBytes(m.EncodedSize())
+	if err := b.AppendUint16(uint16(m.ID)); err != nil {
+		return err
+	}
+	if err := b.AppendUint16(bits.ReverseBytes16(uint16(m.Kind))); err != nil {
+		return err
+	}
+	if x := int64(m.Seq); x < -2147483648 || x > 2147483647 {
+		return fmt.Errorf("netbuffer: field Seq: %d overflows 4 bytes", x)
+	}
+	if err := b.AppendInt32(int32(m.Seq)); err != nil {
+		return err
+	}
+	if err := b.AppendUint32(bits.ReverseBytes32(uint32(m.Delta))); err != nil {
+		return err
+	}
+	if uint64(len(m.Name)) > 255 {
+		return fmt.Errorf("netbuffer: length %d of Name overflows 1 bytes", len(m.Name))
+	}
+	if err := b.AppendUint8(uint8(len(m.Name))); err != nil {
+		return err
+	}
+	b.AppendString(string(m.Name))
+	b.AppendUvarint(uint64(len(m.Token)))
+	b.Append(m.Token)
+	if err := b.AppendUint32(uint32(math.Float32bits(float32(m.Ratio)))); err != nil {
+		return err
+	}
+	if err := b.AppendUint32(bits.ReverseBytes32(uint32(math.Float32bits(float32(m.Scale))))); err != nil {
+		return err
+	}
+	{
+		var v uint8
+		if m.OK {
+			v = 1
+		}
+		if err := b.AppendUint8(v); err != nil {
+			return err
+		}
+	}
+	if uint64(len(m.Items)) > 65535 {
+		return fmt.Errorf("netbuffer: length %d of Items overflows 2 bytes", len(m.Items))
+	}
+	if err := b.AppendUint16(uint16(len(m.Items))); err != nil {
+		return err
+	}
+	for i0 := range m.Items {
+		if err := m.Items[i0].EncodeTo(b); err != nil {
+			return err
+		}
+	}
+	if uint64(len(m.Ports)) > 255 {
+		return fmt.Errorf("netbuffer: length %d of Ports overflows 1 bytes", len(m.Ports))
+	}
+	if err := b.AppendUint8(uint8(len(m.Ports))); err != nil {
+		return err
+	}
+	for i0 := range m.Ports {
+		if err := b.AppendUint16(bits.ReverseBytes16(uint16(m.Ports[i0]))); err != nil {
+			return err
+		}
+	}
+	if uint64(len(m.Tags)) > 255 {
+		return fmt.Errorf("netbuffer: length %d of Tags overflows 1 bytes", len(m.Tags))
+	}
+	if err := b.AppendUint8(uint8(len(m.Tags))); err != nil {
+		return err
+	}
+	for i0 := range m.Tags {
+		if uint64(len(m.Tags[i0])) > 4294967295 {
+			return fmt.Errorf("netbuffer: length %d of Tags overflows 4 bytes", len(m.Tags[i0]))
+		}
+		if err := b.AppendUint32(uint32(len(m.Tags[i0]))); err != nil {
+			return err
+		}
+		b.AppendString(string(m.Tags[i0]))
+	}
+	for i0 := range m.Pad {
+		if err := b.AppendUint8(uint8(m.Pad[i0])); err != nil {
+			return err
+		}
+	}
+	for i0 := range m.Matrix {
+		if uint64(len(m.Matrix[i0])) > 4294967295 {
+			return fmt.Errorf("netbuffer: length %d of Matrix overflows 4 bytes", len(m.Matrix[i0]))
+		}
+		if err := b.AppendUint32(uint32(len(m.Matrix[i0]))); err != nil {
+			return err
+		}
+		for i1 := range m.Matrix[i0] {
+			if err := b.AppendInt8(int8(m.Matrix[i0][i1])); err != nil {
+				return err
+			}
+		}
+	}
+	b.AppendUvarint(uint64(m.Size))
+	return nil
+}
+
+// DecodeBytes parses m from the beginning of p and returns count of byte
+// parsed. If p ends in the middle of m, it returns netbuffer.ErrShortBuffer.
+func (m *Login) DecodeBytes(p []byte) (int, error) {
+	off := 0
+	{
+		if len(p)-off < 2 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint16(p[off:])
+		off += 2
+		m.ID = MsgID(v)
+	}
+	{
+		if len(p)-off < 2 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.LittleEndian.Uint16(p[off:])
+		off += 2
+		m.Kind = v
+	}
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint32(p[off:])
+		off += 4
+		m.Seq = int(int32(v))
+	}
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.LittleEndian.Uint32(p[off:])
+		off += 4
+		m.Delta = int32(v)
+	}
+	{
+		if off >= len(p) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		n := p[off]
+		off++
+		if uint64(len(p)-off) < uint64(n) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		m.Name = string(p[off : off+int(n)])
+		off += int(n)
+	}
+	{
+		n, k := binary.Uvarint(p[off:])
+		if k == 0 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		if k < 0 {
+			return 0, netbuffer.ErrVarintOverflow
+		}
+		off += k
+		if uint64(len(p)-off) < uint64(n) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		m.Token = append([]byte(nil), p[off:off+int(n)]...)
+		off += int(n)
+	}
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint32(p[off:])
+		off += 4
+		m.Ratio = math.Float32frombits(v)
+	}
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.LittleEndian.Uint32(p[off:])
+		off += 4
+		m.Scale = float64(math.Float32frombits(v))
+	}
+	if off >= len(p) {
+		return 0, netbuffer.ErrShortBuffer
+	}
+	m.OK = p[off] != 0
+	off++
+	{
+		if len(p)-off < 2 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		n := binary.BigEndian.Uint16(p[off:])
+		off += 2
+		if uint64(len(p)-off) < uint64(n) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		m.Items = make([]Item, int(n))
+		for i0 := range m.Items {
+			{
+				n, err := m.Items[i0].DecodeBytes(p[off:])
+				if err != nil {
+					return 0, err
+				}
+				off += n
+			}
+		}
+	}
+	{
+		if off >= len(p) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		n := p[off]
+		off++
+		if uint64(len(p)-off) < uint64(n) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		m.Ports = make([]uint16, int(n))
+		for i0 := range m.Ports {
+			{
+				if len(p)-off < 2 {
+					return 0, netbuffer.ErrShortBuffer
+				}
+				v := binary.LittleEndian.Uint16(p[off:])
+				off += 2
+				m.Ports[i0] = v
+			}
+		}
+	}
+	{
+		if off >= len(p) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		n := p[off]
+		off++
+		if uint64(len(p)-off) < uint64(n) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		m.Tags = make([]string, int(n))
+		for i0 := range m.Tags {
+			{
+				if len(p)-off < 4 {
+					return 0, netbuffer.ErrShortBuffer
+				}
+				n := binary.BigEndian.Uint32(p[off:])
+				off += 4
+				if uint64(len(p)-off) < uint64(n) {
+					return 0, netbuffer.ErrShortBuffer
+				}
+				m.Tags[i0] = string(p[off : off+int(n)])
+				off += int(n)
+			}
+		}
+	}
+	for i0 := range m.Pad {
+		{
+			if off >= len(p) {
+				return 0, netbuffer.ErrShortBuffer
+			}
+			v := p[off]
+			off++
+			m.Pad[i0] = v
+		}
+	}
+	for i0 := range m.Matrix {
+		{
+			if len(p)-off < 4 {
+				return 0, netbuffer.ErrShortBuffer
+			}
+			n := binary.BigEndian.Uint32(p[off:])
+			off += 4
+			if uint64(len(p)-off) < uint64(n) {
+				return 0, netbuffer.ErrShortBuffer
+			}
+			m.Matrix[i0] = make([]int8, int(n))
+			for i1 := range m.Matrix[i0] {
+				{
+					if off >= len(p) {
+						return 0, netbuffer.ErrShortBuffer
+					}
+					v := p[off]
+					off++
+					m.Matrix[i0][i1] = int8(v)
+				}
+			}
+		}
+	}
+	{
+		v, k := binary.Uvarint(p[off:])
+		if k == 0 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		if k < 0 {
+			return 0, netbuffer.ErrVarintOverflow
+		}
+		off += k
+		m.Size = v
+	}
+	return off, nil
+}
+
+// DecodeFrom parses m from the readable bytes of b and removes them from b.
+// If they end in the middle of m, it returns netbuffer.ErrShortBuffer.
+// If DecodeFrom returns an error, b is left unchanged.
+func (m *Login) DecodeFrom(b *netbuffer.Buffer) error {
+	n, err := m.DecodeBytes(b.PeekAllAsByteSlice())
+	if err != nil {
+		return err
+	}
+	b.Retrieve(n)
+	return nil
+}
+
+// EncodedSize returns count of byte of m encoded by EncodeTo.
+func (m *Limits) EncodedSize() int {
+	n := 18
+	return n
+}
+
+// EncodeTo appends m to b.
+func (m *Limits) EncodeTo(b *netbuffer.Buffer) error {
+	b.EnsureWritableBytes(m.EncodedSize())
+	if err := b.AppendInt16(int16(m.Small)); err != nil {
+		return err
+	}
+	if x := uint64(m.Byte); x > 127 {
+		return fmt.Errorf("netbuffer: field Byte: %d overflows 1 bytes", x)
+	}
+	if err := b.AppendInt8(int8(m.Byte)); err != nil {
+		return err
+	}
+	if err := b.AppendInt32(int32(m.Count)); err != nil {
+		return err
+	}
+	if x := int64(m.Delta); x < 0 || x > 65535 {
+		return fmt.Errorf("netbuffer: field Delta: %d overflows 2 bytes", x)
+	}
+	if err := b.AppendUint16(uint16(m.Delta)); err != nil {
+		return err
+	}
+	if x := int64(m.Big); x < 0 {
+		return fmt.Errorf("netbuffer: field Big: %d overflows 8 bytes", x)
+	}
+	if err := b.AppendUint64(uint64(m.Big)); err != nil {
+		return err
+	}
+	if x := int64(m.Level); x < 0 || x > 255 {
+		return fmt.Errorf("netbuffer: field Level: %d overflows 1 bytes", x)
+	}
+	if err := b.AppendUint8(uint8(m.Level)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeBytes parses m from the beginning of p and returns count of byte
+// parsed. If p ends in the middle of m, it returns netbuffer.ErrShortBuffer.
+func (m *Limits) DecodeBytes(p []byte) (int, error) {
+	off := 0
+	{
+		if len(p)-off < 2 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint16(p[off:])
+		off += 2
+		x := int16(v)
+		if int64(int8(x)) != int64(x) {
+			return 0, fmt.Errorf("netbuffer: field Small: %d overflows int8", x)
+		}
+		m.Small = int8(x)
+	}
+	{
+		if off >= len(p) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := p[off]
+		off++
+		x := int8(v)
+		if x < 0 || uint64(uint8(x)) != uint64(x) {
+			return 0, fmt.Errorf("netbuffer: field Byte: %d overflows uint8", x)
+		}
+		m.Byte = uint8(x)
+	}
+	{
+		if len(p)-off < 4 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint32(p[off:])
+		off += 4
+		x := int32(v)
+		if x < 0 || uint64(uint16(x)) != uint64(x) {
+			return 0, fmt.Errorf("netbuffer: field Count: %d overflows uint16", x)
+		}
+		m.Count = uint16(x)
+	}
+	{
+		if len(p)-off < 2 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint16(p[off:])
+		off += 2
+		m.Delta = int32(v)
+	}
+	{
+		if len(p)-off < 8 {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := binary.BigEndian.Uint64(p[off:])
+		off += 8
+		if int64(v) < 0 || uint64(int64(v)) != uint64(v) {
+			return 0, fmt.Errorf("netbuffer: field Big: %d overflows int64", v)
+		}
+		m.Big = int64(v)
+	}
+	{
+		if off >= len(p) {
+			return 0, netbuffer.ErrShortBuffer
+		}
+		v := p[off]
+		off++
+		m.Level = int(v)
+	}
+	return off, nil
+}
+
+// DecodeFrom parses m from the readable bytes of b and removes them from b.
+// If they end in the middle of m, it returns netbuffer.ErrShortBuffer.
+// If DecodeFrom returns an error, b is left unchanged.
+func (m *Limits) DecodeFrom(b *netbuffer.Buffer) error {
+	n, err := m.DecodeBytes(b.PeekAllAsByteSlice())
+	if err != nil {
+		return err
+	}
+	b.Retrieve(n)
+	return nil
+}
@@ -0,0 +1,132 @@
+package example
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func newLogin() Login {
+	return Login{
+		ID:      7,
+		Kind:    0x0102,
+		Seq:     -3,
+		Delta:   -70000,
+		Name:    "hero",
+		Token:   []byte{1, 2, 3},
+		Ratio:   0.5,
+		Scale:   2.25,
+		OK:      true,
+		Items:   []Item{{ID: 1, Count: -1}, {ID: 2, Count: 300}},
+		Ports:   []uint16{80, 443},
+		Tags:    []string{"a", "bc"},
+		Pad:     [2]uint8{9, 8},
+		Matrix:  [2][]int8{{-1}, {2, 3}},
+		Size:    1 << 40,
+		Skipped: 5,
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	in := newLogin()
+	buf := netbuffer.NewBuffer()
+	if err := in.EncodeTo(buf); err != nil {
+		t.Fatalf("in.EncodeTo error %v", err)
+	}
+	if buf.ReadableBytes() != in.EncodedSize() {
+		t.Errorf("in.EncodedSize() = %d, EncodeTo wrote %d bytes", in.EncodedSize(), buf.ReadableBytes())
+	}
+
+	var out Login
+	if err := out.DecodeFrom(buf); err != nil {
+		t.Fatalf("out.DecodeFrom error %v", err)
+	}
+	in.Skipped = 0
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("out.DecodeFrom got %+v, want %+v", out, in)
+	}
+	if buf.ReadableBytes() != 0 {
+		t.Errorf("after out.DecodeFrom, buf.ReadableBytes() = %d, want 0", buf.ReadableBytes())
+	}
+}
+
+func TestSameBytesAsMarshal(t *testing.T) {
+	in := newLogin()
+	generated := netbuffer.NewBuffer()
+	if err := in.EncodeTo(generated); err != nil {
+		t.Fatalf("in.EncodeTo error %v", err)
+	}
+	reflected := netbuffer.NewBuffer()
+	if err := netbuffer.Marshal(reflected, &in); err != nil {
+		t.Fatalf("netbuffer.Marshal error %v", err)
+	}
+	if !bytes.Equal(generated.PeekAllAsByteSlice(), reflected.PeekAllAsByteSlice()) {
+		t.Errorf("EncodeTo wrote %v, Marshal wrote %v",
+			generated.PeekAllAsByteSlice(), reflected.PeekAllAsByteSlice())
+	}
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	in := newLogin()
+	full := netbuffer.NewBuffer()
+	if err := in.EncodeTo(full); err != nil {
+		t.Fatalf("in.EncodeTo error %v", err)
+	}
+	data := full.PeekAllAsByteSlice()
+	for i := 0; i < len(data); i++ {
+		buf := netbuffer.NewBuffer()
+		buf.Append(data[:i])
+		var out Login
+		if err := out.DecodeFrom(buf); err != netbuffer.ErrShortBuffer {
+			t.Fatalf("DecodeFrom of %d bytes error %v, want %v", i, err, netbuffer.ErrShortBuffer)
+		}
+		if buf.ReadableBytes() != i {
+			t.Fatalf("failed DecodeFrom of %d bytes left %d bytes", i, buf.ReadableBytes())
+		}
+		// the rest arrives, and decoding resumes from the beginning
+		buf.Append(data[i:])
+		if err := out.DecodeFrom(buf); err != nil || buf.ReadableBytes() != 0 {
+			t.Fatalf("DecodeFrom after %d bytes returned %v, left %d bytes", i, err, buf.ReadableBytes())
+		}
+	}
+}
+
+func TestEncodeLengthOverflow(t *testing.T) {
+	in := Login{Name: string(make([]byte, 256))}
+	if err := in.EncodeTo(netbuffer.NewBuffer()); err == nil {
+		t.Error("EncodeTo of a 256 bytes name with len=u8 returned no error")
+	}
+}
+
+func TestRangeLikeMarshal(t *testing.T) {
+	valid := Limits{Small: -128, Byte: 127, Count: 65535, Delta: 65535, Big: 1<<63 - 1, Level: 255}
+	invalid := []Limits{{Byte: 128}, {Delta: -1}, {Delta: 65536}, {Big: -1}, {Level: 256}, {Level: -1}}
+	for i, in := range append(invalid, valid) {
+		gerr := in.EncodeTo(netbuffer.NewBuffer())
+		rerr := netbuffer.Marshal(netbuffer.NewBuffer(), &in)
+		if (gerr == nil) != (i == len(invalid)) || (gerr == nil) != (rerr == nil) {
+			t.Errorf("EncodeTo of %+v error %v, Marshal error %v", in, gerr, rerr)
+		}
+	}
+
+	validData := []byte{0xff, 0x80, 0x7f, 0, 0, 0xff, 0xff, 0xff, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	invalidData := [][]byte{
+		{0, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0x7f, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for i, data := range append(invalidData, validData) {
+		var got, want Limits
+		_, gerr := got.DecodeBytes(data)
+		buf := netbuffer.NewBuffer()
+		buf.Append(data)
+		rerr := netbuffer.Unmarshal(buf, &want)
+		if (gerr == nil) != (i == len(invalidData)) || (gerr == nil) != (rerr == nil) || gerr == nil && got != want {
+			t.Errorf("DecodeBytes of %v got %+v error %v, Unmarshal got %+v error %v", data, got, gerr, want, rerr)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//go:build go1.18
+// +build go1.18
+
+package example
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// FuzzDecodeFrom checks that generated DecodeFrom accepts what Unmarshal
+// accepts, and decodes the same value.
+func FuzzDecodeFrom(f *testing.F) {
+	in := newLogin()
+	seed := netbuffer.NewBuffer()
+	if err := in.EncodeTo(seed); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed.PeekAllAsByteSlice())
+	f.Add([]byte{})
+	f.Add(make([]byte, 64))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		generated := netbuffer.NewBuffer()
+		generated.Append(data)
+		var got Login
+		gerr := got.DecodeFrom(generated)
+
+		reflected := netbuffer.NewBuffer()
+		reflected.Append(data)
+		var want Login
+		rerr := netbuffer.Unmarshal(reflected, &want)
+		switch {
+		case rerr == netbuffer.ErrShortBuffer:
+			if gerr != netbuffer.ErrShortBuffer {
+				t.Fatalf("DecodeFrom error %v, Unmarshal error %v", gerr, rerr)
+			}
+			return
+		case rerr != nil:
+			return
+		case gerr != nil:
+			t.Fatalf("DecodeFrom error %v, Unmarshal succeeded", gerr)
+		}
+		if generated.ReadableBytes() != reflected.ReadableBytes() {
+			t.Fatalf("DecodeFrom left %d bytes, Unmarshal %d", generated.ReadableBytes(), reflected.ReadableBytes())
+		}
+
+		// compare encodings, which unlike reflect.DeepEqual treat NaNs alike
+		a, b := netbuffer.NewBuffer(), netbuffer.NewBuffer()
+		if err := got.EncodeTo(a); err != nil {
+			t.Fatalf("EncodeTo error %v", err)
+		}
+		if err := netbuffer.Marshal(b, &want); err != nil {
+			t.Fatalf("Marshal error %v", err)
+		}
+		if !bytes.Equal(a.PeekAllAsByteSlice(), b.PeekAllAsByteSlice()) {
+			t.Fatalf("DecodeFrom and Unmarshal decoded different values")
+		}
+	})
+}
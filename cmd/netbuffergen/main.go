@@ -0,0 +1,75 @@
+// Command netbuffergen generates EncodeTo, DecodeFrom and EncodedSize
+// methods for message structs, using the typed Append and Read API of
+// github.com/ZhangGuangxu/netbuffer instead of reflection.
+//
+// Mark the structs with a //netbuffer:generate comment, or name them
+// with -type, and add to the package:
+//
+//	//go:generate netbuffergen
+//
+// Fields are encoded in declaration order, as described by the nb struct
+// tags of netbuffer.Marshal, so both produce the same bytes. Nested struct
+// fields must have generated methods too. Like Marshal and Unmarshal,
+// generated code returns an error for integers which do not fit their tag
+// or field, and DecodeFrom leaves the buffer unchanged when it returns an
+// error. Unlike Marshal, EncodeTo may have appended part of the message
+// when it returns an error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct names; default is structs marked //netbuffer:generate")
+	output    = flag.String("output", "", "output file name; default is <package>_netbuffer.go")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("netbuffergen: ")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	var types []string
+	if *typeNames != "" {
+		types = strings.Split(*typeNames, ",")
+	}
+
+	pkg, err := parsePackage(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(pkg, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = pkg.name + "_netbuffer.go"
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	if err := os.WriteFile(name, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: netbuffergen [-type T1,T2] [-output file] [dir]\n")
+	flag.PrintDefaults()
+}
+
+func init() {
+	flag.Usage = usage
+}
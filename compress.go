@@ -0,0 +1,127 @@
+package netbuffer
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+)
+
+// Compression selects the format of CompressInto and DecompressFrom.
+type Compression int
+
+// Supported compression formats.
+const (
+	Gzip    Compression = iota // RFC 1952
+	Zlib                       // RFC 1950
+	Deflate                    // RFC 1951, raw deflate
+)
+
+const minDecompressRead = 4096 // least writable bytes offered to a decompressor
+
+var (
+	// ErrUnknownCompression is returned for an invalid Compression.
+	ErrUnknownCompression = errors.New("netbuffer: unknown compression")
+	// ErrDecompressedTooLarge is returned when decompressed data exceeds
+	// the limit passed to DecompressFrom.
+	ErrDecompressedTooLarge = errors.New("netbuffer: decompressed data too large")
+)
+
+// Write appends p to this buffer. It always returns len(p), nil, and
+// makes Buffer an io.Writer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.Append(p)
+	return len(p), nil
+}
+
+// CompressInto compresses all readable bytes of this buffer, appends the
+// compressed stream to dst and removes the compressed bytes from this
+// buffer. dst must not be this buffer.
+func (b *Buffer) CompressInto(dst *Buffer, algo Compression) error {
+	var w io.WriteCloser
+	switch algo {
+	case Gzip:
+		w = gzip.NewWriter(dst)
+	case Zlib:
+		w = zlib.NewWriter(dst)
+	case Deflate:
+		fw, err := flate.NewWriter(dst, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		w = fw
+	default:
+		return ErrUnknownCompression
+	}
+
+	if err := dst.appendOrRollback(func() error {
+		if _, err := w.Write(b.buf[b.readerIndex:b.writerIndex]); err != nil {
+			return err
+		}
+		return w.Close()
+	}); err != nil {
+		return err
+	}
+	b.RetrieveAll()
+	return nil
+}
+
+// DecompressFrom decompresses one compressed stream from the beginning of
+// the readable bytes of src, appends the result to this buffer and
+// removes the stream from src. Bytes after the stream are left in src.
+// If the result would exceed maxOut bytes, it returns
+// ErrDecompressedTooLarge. A maxOut <= 0 means no limit.
+// On error neither buffer is changed. src must not be this buffer.
+func (b *Buffer) DecompressFrom(src *Buffer, algo Compression, maxOut int) error {
+	in := bytes.NewReader(src.buf[src.readerIndex:src.writerIndex])
+	var r io.Reader
+	switch algo {
+	case Gzip:
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		zr.Multistream(false)
+		r = zr
+	case Zlib:
+		zr, err := zlib.NewReader(in)
+		if err != nil {
+			return err
+		}
+		r = zr
+	case Deflate:
+		r = flate.NewReader(in)
+	default:
+		return ErrUnknownCompression
+	}
+
+	out := 0
+	if err := b.appendOrRollback(func() error {
+		for {
+			b.ensureWritableBytes(minDecompressRead)
+			p := b.WritableByteSlice()
+			if maxOut > 0 && len(p) > maxOut-out+1 {
+				// one more byte than allowed tells whether the limit is exceeded
+				p = p[:maxOut-out+1]
+			}
+			n, err := r.Read(p)
+			b.HasWritten(n)
+			out += n
+			if maxOut > 0 && out > maxOut {
+				return ErrDecompressedTooLarge
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	src.Retrieve(src.ReadableBytes() - in.Len())
+	return nil
+}
@@ -0,0 +1,96 @@
+package netbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("netbuffer "), 1000)
+	for _, algo := range []Compression{Gzip, Zlib, Deflate} {
+		src := NewBuffer()
+		src.Append(data)
+		compressed := NewBuffer()
+		if err := src.CompressInto(compressed, algo); err != nil {
+			t.Errorf("src.CompressInto(%d) error %v", algo, err)
+		}
+		if src.ReadableBytes() != 0 {
+			t.Errorf("after src.CompressInto(%d), src.ReadableBytes() = %d, want 0", algo, src.ReadableBytes())
+		}
+		if compressed.ReadableBytes() >= len(data) {
+			t.Errorf("src.CompressInto(%d) wrote %d bytes for %d bytes", algo, compressed.ReadableBytes(), len(data))
+		}
+		compressed.Append([]byte("tail"))
+
+		dst := NewBufferWithSize(16)
+		if err := dst.DecompressFrom(compressed, algo, len(data)); err != nil {
+			t.Errorf("dst.DecompressFrom(%d) error %v", algo, err)
+		}
+		if !bytes.Equal(dst.PeekAllAsByteSlice(), data) {
+			t.Errorf("dst.DecompressFrom(%d) got %d bytes, want %d bytes", algo, dst.ReadableBytes(), len(data))
+		}
+		if got := string(compressed.PeekAllAsByteSlice()); got != "tail" {
+			t.Errorf("after dst.DecompressFrom(%d), src has %q, want %q", algo, got, "tail")
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	src := NewBuffer()
+	src.Append(make([]byte, 1<<20))
+	compressed := NewBuffer()
+	if err := src.CompressInto(compressed, Gzip); err != nil {
+		t.Errorf("src.CompressInto error %v", err)
+	}
+	n := compressed.ReadableBytes()
+
+	dst := NewBuffer()
+	dst.Append([]byte("keep"))
+	if err := dst.DecompressFrom(compressed, Gzip, 1<<19); err != ErrDecompressedTooLarge {
+		t.Errorf("dst.DecompressFrom error %v, want %v", err, ErrDecompressedTooLarge)
+	}
+	if got := string(dst.PeekAllAsByteSlice()); got != "keep" {
+		t.Errorf("after a failed dst.DecompressFrom, dst has %q, want %q", got, "keep")
+	}
+	if compressed.ReadableBytes() != n {
+		t.Errorf("after a failed dst.DecompressFrom, src has %d bytes, want %d", compressed.ReadableBytes(), n)
+	}
+
+	if err := dst.DecompressFrom(compressed, Gzip, 1<<20); err != nil {
+		t.Errorf("dst.DecompressFrom error %v", err)
+	}
+	if dst.ReadableBytes() != 4+1<<20 {
+		t.Errorf("dst.ReadableBytes() = %d, want %d", dst.ReadableBytes(), 4+1<<20)
+	}
+}
+
+func TestDecompressTruncated(t *testing.T) {
+	src := NewBuffer()
+	src.Append([]byte("some bytes to compress"))
+	compressed := NewBuffer()
+	if err := src.CompressInto(compressed, Zlib); err != nil {
+		t.Errorf("src.CompressInto error %v", err)
+	}
+	compressed.writerIndex -= 3
+
+	dst := NewBuffer()
+	tap := &recordingTap{}
+	dst.SetTap(tap)
+	if err := dst.DecompressFrom(compressed, Zlib, 0); err == nil {
+		t.Error("dst.DecompressFrom of a truncated stream returned no error")
+	}
+	if dst.ReadableBytes() != 0 {
+		t.Errorf("dst.ReadableBytes() = %d, want 0", dst.ReadableBytes())
+	}
+	if len(tap.appended) != 0 {
+		t.Errorf("tap saw appended %q of a failed dst.DecompressFrom", tap.appended)
+	}
+
+	compressed.writerIndex += 3
+	if err := dst.DecompressFrom(compressed, Zlib, 0); err != nil {
+		t.Errorf("dst.DecompressFrom error %v", err)
+	}
+	if got, want := tap.appended, []string{"some bytes to compress"}; !equalStrings(got, want) {
+		t.Errorf("tap saw appended %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package netbuffer
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+const minFillRead = 4096 // least writable bytes offered to a read by Fill
+
+// WriteTo writes the readable bytes of this buffer to w until there are
+// none left or w returns an error, removing the written bytes. Bytes not
+// written stay readable. It makes Buffer an io.WriterTo.
+func (b *Buffer) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for b.ReadableBytes() > 0 {
+		n, err := w.Write(b.buf[b.readerIndex:b.writerIndex])
+		if n > 0 {
+			b.Retrieve(n)
+			total += int64(n)
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
+
+// Conn pairs a net.Conn with an input buffer, filled from the connection,
+// and an output buffer, flushed to it.
+// One goroutine may call Fill while another calls Send and Flush; other
+// concurrent use needs synchronization.
+type Conn struct {
+	conn         net.Conn
+	input        *Buffer
+	output       *Buffer
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// NewConn returns a Conn over c with empty buffers.
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		conn:   c,
+		input:  NewBuffer(),
+		output: NewBuffer(),
+	}
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// Input returns the buffer Fill appends to. Decode messages from its
+// readable bytes.
+func (c *Conn) Input() *Buffer {
+	return c.input
+}
+
+// Output returns the buffer Flush writes from. Encode messages by
+// appending to it, or use Send.
+func (c *Conn) Output() *Buffer {
+	return c.output
+}
+
+// SetReadTimeout makes each Fill fail with a timeout error if no byte
+// arrives within d. A zero d means no timeout, which is the default.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.readTimeout = d
+}
+
+// SetWriteTimeout makes each Flush fail with a timeout error if it takes
+// longer than d. A zero d means no timeout, which is the default.
+func (c *Conn) SetWriteTimeout(d time.Duration) {
+	c.writeTimeout = d
+}
+
+// Fill reads once from the connection into the input buffer and returns
+// count of byte read. At the end of the stream it returns io.EOF.
+func (c *Conn) Fill() (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	c.input.EnsureWritableBytes(minFillRead)
+	n, err := c.conn.Read(c.input.WritableByteSlice())
+	if n > 0 {
+		c.input.HasWritten(n)
+	}
+	return n, err
+}
+
+// Send appends p to the output buffer. It does not write to the
+// connection; call Flush for that.
+func (c *Conn) Send(p []byte) {
+	c.output.Append(p)
+}
+
+// Flush writes the output buffer to the connection, handling partial
+// writes. On error the bytes not written stay in the output buffer.
+func (c *Conn) Flush() error {
+	if c.output.ReadableBytes() == 0 {
+		return nil
+	}
+	if c.writeTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	_, err := c.output.WriteTo(c.conn)
+	return err
+}
+
+// Close closes the connection. Bytes in the output buffer are not
+// flushed.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,128 @@
+package netbuffer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// shortWriter accepts at most max bytes per Write, and fails after
+// failAfter bytes if failAfter > 0.
+type shortWriter struct {
+	written   []byte
+	max       int
+	failAfter int
+}
+
+var errShortWriter = errors.New("shortWriter failed")
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if w.failAfter > 0 && len(w.written) >= w.failAfter {
+		return 0, errShortWriter
+	}
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	w.written = append(w.written, p...)
+	return len(p), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	buf := NewBuffer()
+	buf.AppendString("hello, world")
+	w := &shortWriter{max: 5}
+	n, err := buf.WriteTo(w)
+	if err != nil || n != 12 || string(w.written) != "hello, world" {
+		t.Errorf("buf.WriteTo returned %d, %v and wrote %q", n, err, w.written)
+	}
+	if buf.ReadableBytes() != 0 {
+		t.Errorf("buf.ReadableBytes() = %d after WriteTo, want 0", buf.ReadableBytes())
+	}
+
+	buf.AppendString("hello, world")
+	w = &shortWriter{max: 5, failAfter: 5}
+	n, err = buf.WriteTo(w)
+	if err != errShortWriter || n != 5 {
+		t.Errorf("buf.WriteTo returned %d, %v, want 5, %v", n, err, errShortWriter)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != ", world" {
+		t.Errorf("buf.WriteTo left %q, want %q", got, ", world")
+	}
+
+	w = &shortWriter{max: 0}
+	if _, err := buf.WriteTo(w); err != io.ErrShortWrite {
+		t.Errorf("buf.WriteTo to a writer accepting nothing error %v, want %v", err, io.ErrShortWrite)
+	}
+}
+
+func TestConn(t *testing.T) {
+	client, server := net.Pipe()
+	c := NewConn(client)
+	s := NewConn(server)
+	defer c.Close()
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		c.Send([]byte("ping"))
+		if err := c.Output().AppendUint32(7); err != nil {
+			done <- err
+			return
+		}
+		done <- c.Flush()
+	}()
+
+	for s.Input().ReadableBytes() < 8 {
+		if _, err := s.Fill(); err != nil {
+			t.Fatalf("s.Fill error %v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("c.Flush error %v", err)
+	}
+	if c.Output().ReadableBytes() != 0 {
+		t.Errorf("c.Output().ReadableBytes() = %d after Flush, want 0", c.Output().ReadableBytes())
+	}
+	if got := string(s.Input().PeekAsByteSlice(4)); got != "ping" {
+		t.Errorf("s.Input() begins with %q, want %q", got, "ping")
+	}
+	s.Input().Retrieve(4)
+	if x, err := s.Input().ReadUint32(); err != nil || x != 7 {
+		t.Errorf("s.Input().ReadUint32() = %d, %v, want 7, nil", x, err)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Errorf("Flush of an empty output buffer error %v", err)
+	}
+
+	c.Close()
+	if _, err := s.Fill(); err != io.EOF {
+		t.Errorf("s.Fill after the peer closed error %v, want %v", err, io.EOF)
+	}
+}
+
+func TestConnTimeouts(t *testing.T) {
+	client, server := net.Pipe()
+	c := NewConn(client)
+	defer c.Close()
+	defer server.Close()
+
+	c.SetReadTimeout(10 * time.Millisecond)
+	_, err := c.Fill()
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("c.Fill with nothing to read error %v, want a timeout", err)
+	}
+
+	// nobody reads the pipe, so the write times out with the bytes kept
+	c.SetWriteTimeout(10 * time.Millisecond)
+	c.Send([]byte("lost?"))
+	err = c.Flush()
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("c.Flush with no reader error %v, want a timeout", err)
+	}
+	if got := string(c.Output().PeekAllAsByteSlice()); got != "lost?" {
+		t.Errorf("c.Output() holds %q after a failed Flush, want %q", got, "lost?")
+	}
+}
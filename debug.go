@@ -0,0 +1,71 @@
+package netbuffer
+
+import (
+	"fmt"
+)
+
+const (
+	poisonByte = 0xdd // fills freed bytes in debug mode
+	maxAliases = 256  // count of PeekAsByteSlice results remembered in debug mode
+)
+
+// alias records a slice returned by PeekAsByteSlice in debug mode.
+type alias struct {
+	first  *byte
+	offset int // index of first in buf
+	gen    uint64
+}
+
+// CheckAlias panics if p was returned by PeekAsByteSlice or
+// PeekAllAsByteSlice of this buffer and its bytes have been retrieved or
+// moved since. Append calls it for its argument.
+// It does nothing unless built with -tags netbuffer_debug.
+func (b *Buffer) CheckAlias(p []byte) {
+	if !debug || len(p) == 0 {
+		return
+	}
+	for i := len(b.aliases) - 1; i >= 0; i-- {
+		a := b.aliases[i]
+		if a.first != &p[0] {
+			continue
+		}
+		if a.gen != b.gen {
+			panic(fmt.Sprintf("netbuffer: use of stale PeekAsByteSlice result "+
+				"(taken at generation %d, buffer is at generation %d)", a.gen, b.gen))
+		}
+		if a.offset < b.readerIndex {
+			panic(fmt.Sprintf("netbuffer: use of stale PeekAsByteSlice result "+
+				"(%d bytes of it have been retrieved)", b.readerIndex-a.offset))
+		}
+		return
+	}
+}
+
+// Generation returns a counter which is increased each time this buffer
+// moves or resets its readable bytes, that is each time the results of
+// former PeekAsByteSlice calls become invalid.
+// It is only maintained when built with -tags netbuffer_debug.
+func (b *Buffer) Generation() uint64 {
+	return b.gen
+}
+
+func (b *Buffer) recordAlias(p []byte, offset int) {
+	if len(p) == 0 {
+		return
+	}
+	if len(b.aliases) == maxAliases {
+		copy(b.aliases, b.aliases[1:])
+		b.aliases = b.aliases[:maxAliases-1]
+	}
+	b.aliases = append(b.aliases, alias{first: &p[0], offset: offset, gen: b.gen})
+}
+
+// poison overwrites freed bytes, unless a View still references them.
+func (b *Buffer) poison(p []byte) {
+	if b.shared() {
+		return
+	}
+	for i := range p {
+		p[i] = poisonByte
+	}
+}
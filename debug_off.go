@@ -0,0 +1,6 @@
+//go:build !netbuffer_debug
+// +build !netbuffer_debug
+
+package netbuffer
+
+const debug = false
@@ -0,0 +1,8 @@
+//go:build netbuffer_debug
+// +build netbuffer_debug
+
+package netbuffer
+
+// debug enables poisoning of freed bytes and detection of stale
+// PeekAsByteSlice aliases. Build with -tags netbuffer_debug to turn it on.
+const debug = true
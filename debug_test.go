@@ -0,0 +1,71 @@
+//go:build netbuffer_debug
+// +build netbuffer_debug
+
+package netbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func expectPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", name)
+		}
+	}()
+	f()
+}
+
+func TestPoison(t *testing.T) {
+	buf := NewBufferWithSize(16)
+	buf.Append([]byte("abcdef"))
+	p := buf.PeekAsByteSlice(3)
+	buf.Retrieve(3)
+	if !bytes.Equal(p, []byte{poisonByte, poisonByte, poisonByte}) {
+		t.Errorf("retrieved bytes are %v, want them poisoned", p)
+	}
+
+	p = buf.PeekAllAsByteSlice()
+	buf.Append(bytes.Repeat([]byte("x"), 12)) // compaction
+	expectPanic(t, "CheckAlias after compaction", func() { buf.CheckAlias(p) })
+
+	p = buf.PeekAllAsByteSlice()
+	buf.Append(bytes.Repeat([]byte("y"), 64)) // growth
+	if !bytes.Equal(p, bytes.Repeat([]byte{poisonByte}, len(p))) {
+		t.Errorf("bytes of old storage are %v, want them poisoned", p)
+	}
+}
+
+func TestCheckAlias(t *testing.T) {
+	buf := NewBufferWithSize(16)
+	buf.Append([]byte("abcdef"))
+	p := buf.PeekAllAsByteSlice()
+	buf.CheckAlias(p)
+
+	gen := buf.Generation()
+	buf.Append(bytes.Repeat([]byte("x"), 32))
+	if buf.Generation() == gen {
+		t.Error("buf.Generation() did not change after growth")
+	}
+	expectPanic(t, "Append of a stale alias", func() { buf.Append(p) })
+
+	p = buf.PeekAsByteSlice(4)
+	buf.Retrieve(2)
+	expectPanic(t, "CheckAlias of a retrieved alias", func() { buf.CheckAlias(p) })
+
+	p = buf.PeekAsByteSlice(4)
+	buf.RetrieveAll()
+	expectPanic(t, "CheckAlias after RetrieveAll", func() { buf.CheckAlias(p) })
+}
+
+func TestPoisonSkipsViews(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("abc"))
+	v := buf.ReadView(3)
+	if v.String() != "abc" {
+		t.Errorf("v.String() = %q, want %q", v.String(), "abc")
+	}
+	v.Release()
+}
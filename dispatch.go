@@ -0,0 +1,141 @@
+package netbuffer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrUnknownMessageID is returned by Dispatch for a message ID without a
+// handler, unless an unknown-message callback is set.
+var ErrUnknownMessageID = errors.New("netbuffer: unknown message ID")
+
+// Decoder is implemented by messages which parse themselves from the
+// readable bytes of a Buffer, removing them, such as the code generated
+// by netbuffergen.
+type Decoder interface {
+	DecodeFrom(b *Buffer) error
+}
+
+// Codec decodes the body of a message from b into v.
+type Codec interface {
+	Decode(b *Buffer, v interface{}) error
+}
+
+// CodecFunc adapts a function to a Codec.
+type CodecFunc func(b *Buffer, v interface{}) error
+
+// Decode calls f(b, v).
+func (f CodecFunc) Decode(b *Buffer, v interface{}) error {
+	return f(b, v)
+}
+
+// DefaultCodec decodes with DecodeFrom if v is a Decoder, and with
+// Unmarshal otherwise.
+var DefaultCodec Codec = CodecFunc(func(b *Buffer, v interface{}) error {
+	if d, ok := v.(Decoder); ok {
+		return d.DecodeFrom(b)
+	}
+	return Unmarshal(b, v)
+})
+
+// HandlerFunc handles a decoded message. arg is the value passed to
+// Dispatch, such as the connection the message came from. A msg which is
+// the frame itself, as a *Buffer, is emptied by Dispatch when the handler
+// returns: a handler keeping its bytes must copy them.
+type HandlerFunc func(arg interface{}, msg interface{}) error
+
+// UnknownMessageFunc is called by Dispatch for a message ID without a
+// handler, with the body of the message in frame. As with a HandlerFunc,
+// frame is emptied when the function returns.
+type UnknownMessageFunc func(arg interface{}, id uint16, frame *Buffer) error
+
+// Dispatcher routes frames to handlers by the uint16 message ID at their
+// beginning, read as ReadUint16 does. Register the handlers before
+// dispatching; Dispatch may then be called concurrently.
+type Dispatcher struct {
+	routes  map[uint16]route
+	unknown UnknownMessageFunc
+}
+
+type route struct {
+	typ     reflect.Type // element type of the registered pointer, or nil
+	codec   Codec
+	handler HandlerFunc
+}
+
+// NewDispatcher returns a dispatcher without handlers.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{routes: make(map[uint16]route)}
+}
+
+// Register registers h for the messages of ID id, decoded by DefaultCodec
+// into a new value of the type of prototype, which must be a pointer,
+// such as (*Login)(nil). If prototype is nil, h is passed the frame after
+// the ID, as a *Buffer, instead.
+func (d *Dispatcher) Register(id uint16, prototype interface{}, h HandlerFunc) error {
+	return d.RegisterWithCodec(id, prototype, DefaultCodec, h)
+}
+
+// RegisterWithCodec is Register decoding with codec.
+func (d *Dispatcher) RegisterWithCodec(id uint16, prototype interface{}, codec Codec, h HandlerFunc) error {
+	if _, ok := d.routes[id]; ok {
+		return fmt.Errorf("netbuffer: message ID %d registered twice", id)
+	}
+	if h == nil {
+		return fmt.Errorf("netbuffer: nil handler for message ID %d", id)
+	}
+	if codec == nil {
+		return fmt.Errorf("netbuffer: nil codec for message ID %d", id)
+	}
+	r := route{codec: codec, handler: h}
+	if prototype != nil {
+		t := reflect.TypeOf(prototype)
+		if t.Kind() != reflect.Ptr {
+			return fmt.Errorf("netbuffer: message prototype of non-pointer type %T", prototype)
+		}
+		r.typ = t.Elem()
+	}
+	d.routes[id] = r
+	return nil
+}
+
+// SetUnknownMessageFunc sets the function called for message IDs without
+// a handler. By default Dispatch returns ErrUnknownMessageID for them.
+func (d *Dispatcher) SetUnknownMessageFunc(f UnknownMessageFunc) {
+	d.unknown = f
+}
+
+// Dispatch reads the message ID from frame, a whole message as extracted
+// by a framing function, decodes the rest of frame and passes the message
+// and arg to the handler registered for the ID. It returns the error of
+// the decoding or of the handler. If frame is shorter than the ID, it
+// returns ErrShortBuffer.
+//
+// Dispatch removes all of frame, also the bytes left after the message
+// and on error, so that they are not taken for the next message. Messages
+// decoded by DefaultCodec copy the bytes they keep; a handler registered
+// with a nil prototype, and the unknown-message function, are passed frame
+// itself, whose bytes are only valid until they return.
+func (d *Dispatcher) Dispatch(arg interface{}, frame *Buffer) error {
+	defer frame.RetrieveAll()
+	id, err := frame.ReadUint16()
+	if err != nil {
+		return err
+	}
+	r, ok := d.routes[id]
+	if !ok {
+		if d.unknown != nil {
+			return d.unknown(arg, id, frame)
+		}
+		return ErrUnknownMessageID
+	}
+	if r.typ == nil {
+		return r.handler(arg, frame)
+	}
+	msg := reflect.New(r.typ).Interface()
+	if err := r.codec.Decode(frame, msg); err != nil {
+		return err
+	}
+	return r.handler(arg, msg)
+}
@@ -0,0 +1,147 @@
+package netbuffer
+
+import (
+	"errors"
+	"testing"
+)
+
+// dispatchPing decodes itself, to check that DefaultCodec prefers
+// DecodeFrom over Unmarshal.
+type dispatchPing struct {
+	Seq     uint8
+	decoded bool
+}
+
+func (m *dispatchPing) DecodeFrom(b *Buffer) error {
+	seq, err := b.ReadUint8()
+	if err != nil {
+		return err
+	}
+	m.Seq = seq
+	m.decoded = true
+	return nil
+}
+
+func dispatchFrame(id uint16, body ...byte) *Buffer {
+	b := NewBuffer()
+	if err := b.AppendUint16(id); err != nil {
+		panic(err)
+	}
+	b.Append(body)
+	return b
+}
+
+func TestDispatch(t *testing.T) {
+	d := NewDispatcher()
+	var got []interface{}
+	record := func(arg interface{}, msg interface{}) error {
+		got = append(got, arg, msg)
+		return nil
+	}
+	if err := d.Register(1, (*marshalItem)(nil), record); err != nil {
+		t.Fatalf("d.Register error %v", err)
+	}
+	if err := d.Register(2, &dispatchPing{}, record); err != nil {
+		t.Fatalf("d.Register error %v", err)
+	}
+	if err := d.Register(3, nil, func(arg interface{}, msg interface{}) error {
+		b := msg.(*Buffer)
+		got = append(got, arg, string(b.PeekAllAsByteSlice()))
+		return nil
+	}); err != nil {
+		t.Fatalf("d.Register error %v", err)
+	}
+
+	item := NewBuffer()
+	if err := Marshal(item, &marshalItem{ID: 7, Count: -3}); err != nil {
+		t.Fatalf("Marshal error %v", err)
+	}
+	frames := []*Buffer{
+		dispatchFrame(1, item.PeekAllAsByteSlice()...),
+		dispatchFrame(2, 9, 0xff), // the trailing byte is discarded
+		dispatchFrame(3, 'h', 'i'),
+	}
+	for i, f := range frames {
+		if err := d.Dispatch(i, f); err != nil {
+			t.Fatalf("d.Dispatch of frame %d error %v", i, err)
+		}
+		if f.ReadableBytes() != 0 {
+			t.Errorf("d.Dispatch left %d bytes of frame %d", f.ReadableBytes(), i)
+		}
+	}
+	if len(got) != 6 {
+		t.Fatalf("handlers got %v", got)
+	}
+	if m, ok := got[1].(*marshalItem); !ok || got[0] != 0 || *m != (marshalItem{ID: 7, Count: -3}) {
+		t.Errorf("handler 1 got %v, %#v", got[0], got[1])
+	}
+	if m, ok := got[3].(*dispatchPing); !ok || got[2] != 1 || m.Seq != 9 || !m.decoded {
+		t.Errorf("handler 2 got %v, %#v", got[2], got[3])
+	}
+	if got[4] != 2 || got[5] != "hi" {
+		t.Errorf("handler 3 got %v, %#v", got[4], got[5])
+	}
+}
+
+func TestDispatchErrors(t *testing.T) {
+	d := NewDispatcher()
+	handlerErr := errors.New("handler failed")
+	if err := d.Register(1, &dispatchPing{}, func(arg interface{}, msg interface{}) error {
+		return handlerErr
+	}); err != nil {
+		t.Fatalf("d.Register error %v", err)
+	}
+	nop := func(arg interface{}, msg interface{}) error { return nil }
+	if err := d.Register(1, &dispatchPing{}, nop); err == nil {
+		t.Errorf("d.Register of a registered ID succeeded")
+	}
+	if err := d.Register(2, marshalItem{}, nop); err == nil {
+		t.Errorf("d.Register of a non-pointer prototype succeeded")
+	}
+	if err := d.Register(3, &dispatchPing{}, nil); err == nil {
+		t.Errorf("d.Register of a nil handler succeeded")
+	}
+	if err := d.RegisterWithCodec(4, &dispatchPing{}, nil, nop); err == nil {
+		t.Errorf("d.RegisterWithCodec of a nil codec succeeded")
+	}
+
+	cases := []struct {
+		name  string
+		frame *Buffer
+		want  error
+	}{
+		{"short ID", NewBufferWithSize(0), ErrShortBuffer},
+		{"short body", dispatchFrame(1), ErrShortBuffer},
+		{"handler", dispatchFrame(1, 0), handlerErr},
+		{"unknown", dispatchFrame(5, 0), ErrUnknownMessageID},
+	}
+	for _, c := range cases {
+		if err := d.Dispatch(nil, c.frame); err != c.want {
+			t.Errorf("%s: d.Dispatch error %v, want %v", c.name, err, c.want)
+		}
+		if c.frame.ReadableBytes() != 0 {
+			t.Errorf("%s: d.Dispatch left %d bytes", c.name, c.frame.ReadableBytes())
+		}
+	}
+
+	var unknown []uint16
+	d.SetUnknownMessageFunc(func(arg interface{}, id uint16, frame *Buffer) error {
+		unknown = append(unknown, id, uint16(frame.ReadableBytes()))
+		return nil
+	})
+	if err := d.Dispatch(nil, dispatchFrame(5, 0, 0)); err != nil {
+		t.Errorf("d.Dispatch of an unknown ID error %v", err)
+	}
+	if len(unknown) != 2 || unknown[0] != 5 || unknown[1] != 2 {
+		t.Errorf("unknown message func got %v, want [5 2]", unknown)
+	}
+
+	codecErr := errors.New("codec failed")
+	failing := CodecFunc(func(b *Buffer, v interface{}) error { return codecErr })
+	if err := d.RegisterWithCodec(6, &dispatchPing{}, failing, nop); err != nil {
+		t.Fatalf("d.RegisterWithCodec error %v", err)
+	}
+	if err := d.Dispatch(nil, dispatchFrame(6, 0)); err != codecErr {
+		t.Errorf("d.Dispatch error %v, want %v", err, codecErr)
+	}
+}
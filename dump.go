@@ -0,0 +1,95 @@
+package netbuffer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Annotation names Size bytes of the readable bytes of a buffer, starting
+// Offset bytes after their beginning, for DumpAnnotated.
+type Annotation struct {
+	Offset int
+	Size   int
+	Name   string
+}
+
+// maxAnnotatedBytes is count of byte shown after an annotation.
+const maxAnnotatedBytes = 16
+
+// String returns the indexes and sizes of this buffer.
+func (b *Buffer) String() string {
+	return fmt.Sprintf("netbuffer.Buffer{readerIndex: %d, writerIndex: %d, "+
+		"prependable: %d, readable: %d, writable: %d, capacity: %d}",
+		b.readerIndex, b.writerIndex,
+		b.prependableBytes(), b.ReadableBytes(), b.WritableBytes(), len(b.buf))
+}
+
+// Format implements fmt.Formatter. %v and %s print String, %+v prints
+// the output of Dump, %x and %X print the readable bytes in hex and %q
+// prints them as a quoted string.
+func (b *Buffer) Format(f fmt.State, verb rune) {
+	readable := b.buf[b.readerIndex:b.writerIndex]
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			_ = b.Dump(f) // fmt ignores errors of a Formatter
+			return
+		}
+		_, _ = io.WriteString(f, b.String())
+	case 's':
+		_, _ = io.WriteString(f, b.String())
+	case 'x':
+		fmt.Fprintf(f, "%x", readable)
+	case 'X':
+		fmt.Fprintf(f, "%X", readable)
+	case 'q':
+		fmt.Fprintf(f, "%q", readable)
+	default:
+		fmt.Fprintf(f, "%%!%c(%s)", verb, b.String())
+	}
+}
+
+// Dump writes the indexes and sizes of this buffer followed by its
+// readable bytes in the format of hexdump -C, with offsets counted from
+// the beginning of the readable bytes.
+func (b *Buffer) Dump(w io.Writer) error {
+	return b.DumpAnnotated(w, nil)
+}
+
+// DumpAnnotated writes the output of Dump followed by one line per
+// annotation, with its offset, size, name and bytes.
+func (b *Buffer) DumpAnnotated(w io.Writer, annotations []Annotation) error {
+	readable := b.buf[b.readerIndex:b.writerIndex]
+	if _, err := fmt.Fprintf(w, "readerIndex %d, writerIndex %d, prependable %d, readable %d, writable %d, capacity %d\n",
+		b.readerIndex, b.writerIndex,
+		b.prependableBytes(), len(readable), b.WritableBytes(), len(b.buf)); err != nil {
+		return err
+	}
+	d := hex.Dumper(w)
+	if _, err := d.Write(readable); err != nil {
+		return err
+	}
+	if err := d.Close(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%08x\n", len(readable)); err != nil {
+		return err
+	}
+
+	for _, a := range annotations {
+		var data string
+		switch {
+		case a.Offset < 0 || a.Size < 0 || a.Offset+a.Size > len(readable):
+			data = "out of range"
+		case a.Size > maxAnnotatedBytes:
+			data = fmt.Sprintf("% x ...", readable[a.Offset:a.Offset+maxAnnotatedBytes])
+		default:
+			data = fmt.Sprintf("% x", readable[a.Offset:a.Offset+a.Size])
+		}
+		if _, err := fmt.Fprintf(w, "%08x  %-5d %s: %s\n", a.Offset, a.Size, a.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package netbuffer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	buf := NewBufferWithSize(32)
+	buf.Append([]byte("xxhello, world!\n012"))
+	buf.Retrieve(2)
+
+	var sb strings.Builder
+	err := buf.DumpAnnotated(&sb, []Annotation{
+		{Offset: 0, Size: 5, Name: "greeting"},
+		{Offset: 0, Size: 17, Name: "all"},
+		{Offset: 16, Size: 2, Name: "bad"},
+	})
+	if err != nil {
+		t.Errorf("buf.DumpAnnotated error %v", err)
+	}
+	want := "readerIndex 10, writerIndex 27, prependable 10, readable 17, writable 13, capacity 40\n" +
+		"00000000  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 0a 30 31  |hello, world!.01|\n" +
+		"00000010  32                                                |2|\n" +
+		"00000011\n" +
+		"00000000  5     greeting: 68 65 6c 6c 6f\n" +
+		"00000000  17    all: 68 65 6c 6c 6f 2c 20 77 6f 72 6c 64 21 0a 30 31 ...\n" +
+		"00000010  2     bad: out of range\n"
+	if sb.String() != want {
+		t.Errorf("buf.DumpAnnotated wrote\n%s\nwant\n%s", sb.String(), want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	buf := NewBufferWithSize(8)
+	buf.Append([]byte("ab"))
+
+	str := "netbuffer.Buffer{readerIndex: 8, writerIndex: 10, prependable: 8, readable: 2, writable: 6, capacity: 16}"
+	for _, c := range []struct {
+		format string
+		want   string
+	}{
+		{"%v", str},
+		{"%s", str},
+		{"%x", "6162"},
+		{"%X", "6162"},
+		{"%q", `"ab"`},
+		{"%d", "%!d(" + str + ")"},
+	} {
+		if got := fmt.Sprintf(c.format, buf); got != c.want {
+			t.Errorf("fmt.Sprintf(%q, buf) = %q, want %q", c.format, got, c.want)
+		}
+	}
+	if got := fmt.Sprintf("%+v", buf); !strings.Contains(got, "|ab|") {
+		t.Errorf("fmt.Sprintf(%q, buf) = %q, want a hex dump", "%+v", got)
+	}
+}
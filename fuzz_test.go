@@ -0,0 +1,409 @@
+//go:build go1.18
+// +build go1.18
+
+package netbuffer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"testing"
+)
+
+// FuzzBuffer runs a sequence of operations decoded from ops against a
+// Buffer and against a plain byte slice holding the readable bytes.
+func FuzzBuffer(f *testing.F) {
+	f.Add([]byte{0, 5, 'a', 'b', 'c', 'd', 'e', 4, 2, 6, 0})
+	f.Add([]byte{3, 1, 2, 0x80, 0, 9, 0x81, 0x01, 10, 7, 3, 5, 1, 100})
+	f.Add([]byte{0, 200, 8, 250, 3, 1, 7, 50, 11, 9, 0, 2, 'x', 'y', 5})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		buf := NewBufferWithSize(16)
+		var model []byte
+		var views []heldView
+
+		next := func() int {
+			if len(ops) == 0 {
+				return 0
+			}
+			c := ops[0]
+			ops = ops[1:]
+			return int(c)
+		}
+		for step := 0; len(ops) > 0; step++ {
+			op, arg := next()%12, next()
+			switch op {
+			case 0: // Append arg bytes of ops
+				n := arg
+				if n > len(ops) {
+					n = len(ops)
+				}
+				buf.Append(ops[:n])
+				model = append(model, ops[:n]...)
+				ops = ops[n:]
+			case 1: // AppendString of a repeated byte, up to 2040 bytes
+				s := string(bytes.Repeat([]byte{byte(step)}, arg*8))
+				buf.AppendString(s)
+				model = append(model, s...)
+			case 2: // typed Append
+				x := uint64(arg) * 0x0101010101010101
+				var p [8]byte
+				binary.BigEndian.PutUint64(p[:], x)
+				switch arg % 3 {
+				case 0:
+					_ = buf.AppendUint16(uint16(x))
+					model = append(model, p[6:]...)
+				case 1:
+					_ = buf.AppendUint32(uint32(x))
+					model = append(model, p[4:]...)
+				default:
+					_ = buf.AppendUint64(x)
+					model = append(model, p[:]...)
+				}
+			case 3: // typed Prepend, possibly more than cheapPrepend
+				for i := 0; i <= arg%4; i++ {
+					x := uint32(arg + i)
+					_ = buf.PrependUint32(x)
+					var p [4]byte
+					binary.BigEndian.PutUint32(p[:], x)
+					model = append(p[:], model...)
+				}
+			case 4: // Retrieve
+				n := arg % (len(model) + 2)
+				buf.Retrieve(n)
+				if n > len(model) {
+					n = len(model)
+				}
+				model = model[n:]
+			case 5:
+				buf.RetrieveAll()
+				model = nil
+			case 6: // typed Read, short or not
+				if arg%2 == 0 {
+					x, err := buf.ReadUint16()
+					if len(model) < 2 {
+						if err != ErrShortBuffer {
+							t.Fatalf("step %d: ReadUint16 of %d bytes error %v", step, len(model), err)
+						}
+						break
+					}
+					if err != nil || x != binary.BigEndian.Uint16(model) {
+						t.Fatalf("step %d: ReadUint16 returned %#x, %v", step, x, err)
+					}
+					model = model[2:]
+				} else {
+					x, err := buf.ReadUint64()
+					if len(model) < 8 {
+						if err != ErrShortBuffer {
+							t.Fatalf("step %d: ReadUint64 of %d bytes error %v", step, len(model), err)
+						}
+						break
+					}
+					if err != nil || x != binary.BigEndian.Uint64(model) {
+						t.Fatalf("step %d: ReadUint64 returned %#x, %v", step, x, err)
+					}
+					model = model[8:]
+				}
+			case 7: // take a View, kept until the end or released now
+				n := arg % (len(model) + 1)
+				var v *View
+				if arg%3 == 0 {
+					v = buf.ReadView(n)
+				} else {
+					v = buf.PeekView(n)
+				}
+				want := string(model[:n])
+				if arg%3 == 0 {
+					model = model[n:]
+				}
+				if arg%2 == 0 {
+					if v.String() != want {
+						t.Fatalf("step %d: View %q, want %q", step, v.String(), want)
+					}
+					v.Release()
+				} else {
+					views = append(views, heldView{v, want})
+				}
+			case 8: // write into the writable bytes
+				buf.EnsureWritableBytes(arg)
+				p := buf.WritableByteSlice()
+				if len(p) < arg {
+					t.Fatalf("step %d: %d writable bytes after EnsureWritableBytes(%d)", step, len(p), arg)
+				}
+				for i := 0; i < arg; i++ {
+					p[i] = byte(i)
+					model = append(model, byte(i))
+				}
+				buf.HasWritten(arg)
+			case 9: // varints
+				if arg%2 == 0 {
+					x := uint64(arg) << uint(arg%57)
+					buf.AppendUvarint(x)
+					model = append(model, encodeUvarint(x)...)
+					break
+				}
+				x, err := buf.ReadUvarint()
+				want, n := binary.Uvarint(model)
+				switch {
+				case n > 0:
+					if err != nil || x != want {
+						t.Fatalf("step %d: ReadUvarint returned %d, %v, want %d", step, x, err, want)
+					}
+					model = model[n:]
+				case err == nil:
+					t.Fatalf("step %d: ReadUvarint of %x succeeded", step, model)
+				}
+			case 10: // checksum frame
+				since := buf.ReadableBytes()
+				buf.AppendString("frame")
+				if err := buf.AppendChecksum(CRC32C, since); err != nil {
+					t.Fatalf("step %d: AppendChecksum error %v", step, err)
+				}
+				sum, _ := buf.Checksum(CRC32C, since, 5)
+				model = append(model, "frame"...)
+				var p [4]byte
+				binary.BigEndian.PutUint32(p[:], uint32(sum))
+				model = append(model, p[:]...)
+				if arg%2 == 0 && since == 0 {
+					if err := buf.StripChecksum(CRC32C, 9); err != nil {
+						t.Fatalf("step %d: StripChecksum error %v", step, err)
+					}
+					model = append(model[:5], model[9:]...)
+				}
+			case 11: // Peek leaves the buffer unchanged
+				p := buf.PeekAsByteSlice(arg % (len(model) + 1))
+				if !bytes.Equal(p, model[:len(p)]) {
+					t.Fatalf("step %d: PeekAsByteSlice %x, want %x", step, p, model[:len(p)])
+				}
+			}
+
+			if got := buf.PeekAllAsByteSlice(); !bytes.Equal(got, model) {
+				t.Fatalf("step %d (op %d): readable bytes %x, want %x", step, op, got, model)
+			}
+			if buf.ReadableBytes() != len(model) {
+				t.Fatalf("step %d: ReadableBytes %d, want %d", step, buf.ReadableBytes(), len(model))
+			}
+		}
+		for i, h := range views {
+			if h.v.String() != h.want {
+				t.Fatalf("view %d changed to %q, want %q", i, h.v.String(), h.want)
+			}
+			h.v.Release()
+		}
+	})
+}
+
+func encodeUvarint(x uint64) []byte {
+	p := make([]byte, binary.MaxVarintLen64)
+	return p[:binary.PutUvarint(p, x)]
+}
+
+func FuzzReadUvarint(f *testing.F) {
+	f.Add([]byte{0x01})
+	f.Add([]byte{0xff, 0x01, 0x02})
+	f.Add([]byte{0x80, 0x80})
+	f.Add(bytes.Repeat([]byte{0xff}, 11))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := NewBuffer()
+		buf.Append(data)
+		want, wantN := binary.Uvarint(data)
+		x, n, err := buf.PeekUvarint()
+		if wantN <= 0 {
+			if err == nil {
+				t.Fatalf("PeekUvarint of %x returned %d, %d", data, x, n)
+			}
+			if _, err := buf.ReadUvarint(); err == nil || buf.ReadableBytes() != len(data) {
+				t.Fatalf("failed ReadUvarint of %x left %d bytes", data, buf.ReadableBytes())
+			}
+			return
+		}
+		if err != nil || x != want || n != wantN {
+			t.Fatalf("PeekUvarint of %x returned %d, %d, %v, want %d, %d", data, x, n, err, want, wantN)
+		}
+		if x, err := buf.ReadUvarint(); err != nil || x != want || buf.ReadableBytes() != len(data)-n {
+			t.Fatalf("ReadUvarint of %x returned %d, %v and left %d bytes", data, x, err, buf.ReadableBytes())
+		}
+	})
+}
+
+func FuzzReadVarint(f *testing.F) {
+	f.Add([]byte{0x01})
+	f.Add([]byte{0xff, 0x01, 0x02})
+	f.Add([]byte{0x80})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := NewBuffer()
+		buf.Append(data)
+		want, wantN := binary.Varint(data)
+		x, err := buf.ReadVarint()
+		if wantN <= 0 {
+			if err == nil || buf.ReadableBytes() != len(data) {
+				t.Fatalf("ReadVarint of %x returned %d, %v and left %d bytes", data, x, err, buf.ReadableBytes())
+			}
+			return
+		}
+		if err != nil || x != want || buf.ReadableBytes() != len(data)-wantN {
+			t.Fatalf("ReadVarint of %x returned %d, %v and left %d bytes", data, x, err, buf.ReadableBytes())
+		}
+		if VarintSize(x) > wantN {
+			t.Fatalf("VarintSize(%d) = %d, more than the %d bytes read", x, VarintSize(x), wantN)
+		}
+	})
+}
+
+func FuzzStripChecksum(f *testing.F) {
+	f.Add([]byte("body\x5d\x5e\x34\x87rest"), uint8(CRC32), 8)
+	f.Add([]byte("abc"), uint8(Adler32), 3)
+	f.Add([]byte("0123456789"), uint8(XXHash64), 10)
+	f.Fuzz(func(t *testing.T, data []byte, kind uint8, n int) {
+		buf := NewBuffer()
+		buf.Append(data)
+		k := ChecksumKind(kind)
+		verr := buf.VerifyChecksum(k, n)
+		err := buf.StripChecksum(k, n)
+		if err != verr {
+			t.Fatalf("StripChecksum error %v, VerifyChecksum error %v", err, verr)
+		}
+		if err != nil {
+			if !bytes.Equal(buf.PeekAllAsByteSlice(), data) {
+				t.Fatalf("failed StripChecksum changed the buffer")
+			}
+			return
+		}
+		want := append(append([]byte(nil), data[:n-k.Size()]...), data[n:]...)
+		if !bytes.Equal(buf.PeekAllAsByteSlice(), want) {
+			t.Fatalf("StripChecksum left %x, want %x", buf.PeekAllAsByteSlice(), want)
+		}
+	})
+}
+
+func FuzzDecompressFrom(f *testing.F) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("hello, hello, hello"))
+	_ = zw.Close()
+	f.Add(gz.Bytes(), uint8(Gzip))
+	f.Add([]byte{0x78, 0x9c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}, uint8(Zlib))
+	f.Add([]byte{0x01, 0x03, 0x00, 0xfc, 0xff, 'a', 'b', 'c'}, uint8(Deflate))
+	f.Fuzz(func(t *testing.T, data []byte, algo uint8) {
+		src := NewBuffer()
+		src.Append(data)
+		dst := NewBuffer()
+		dst.AppendString("x")
+		err := dst.DecompressFrom(src, Compression(algo), 1<<20)
+		if err != nil {
+			if !bytes.Equal(src.PeekAllAsByteSlice(), data) || dst.ReadableBytes() != 1 {
+				t.Fatalf("failed DecompressFrom changed the buffers: %v", err)
+			}
+			return
+		}
+		if src.ReadableBytes() >= len(data) && len(data) > 0 {
+			t.Fatalf("DecompressFrom consumed nothing of %d bytes", len(data))
+		}
+		if dst.ReadableBytes() > 1+1<<20 || dst.PeekAllAsByteSlice()[0] != 'x' {
+			t.Fatalf("DecompressFrom appended %d bytes", dst.ReadableBytes()-1)
+		}
+	})
+}
+
+func FuzzOpen(f *testing.F) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		f.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		f.Fatal(err)
+	}
+	sealed := NewBuffer()
+	sealed.AppendString("secret")
+	if err := sealed.Seal(aead, make([]byte, aead.NonceSize()), nil); err != nil {
+		f.Fatal(err)
+	}
+	frame := append([]byte(nil), sealed.PeekAllAsByteSlice()...)
+	f.Add(frame, len(frame))
+	f.Add(append(frame, "next"...), len(frame))
+	f.Add([]byte("short"), 5)
+	f.Fuzz(func(t *testing.T, data []byte, n int) {
+		buf := NewBuffer()
+		buf.Append(data)
+		switch err := buf.Open(aead, n, nil); err {
+		case nil:
+			want := len(data) - aead.NonceSize() - aead.Overhead()
+			if buf.ReadableBytes() != want || !bytes.Equal(buf.PeekAllAsByteSlice()[n-aead.NonceSize()-aead.Overhead():], data[n:]) {
+				t.Fatalf("Open left %x", buf.PeekAllAsByteSlice())
+			}
+		case ErrShortBuffer:
+			if !bytes.Equal(buf.PeekAllAsByteSlice(), data) {
+				t.Fatalf("Open of a short frame changed the buffer")
+			}
+		case ErrAuthFailed:
+			if !bytes.Equal(buf.PeekAllAsByteSlice(), data[n:]) {
+				t.Fatalf("Open of a forged frame left %d bytes, want %d", buf.ReadableBytes(), len(data)-n)
+			}
+		default:
+			t.Fatalf("Open error %v", err)
+		}
+	})
+}
+
+type fuzzItem struct {
+	ID    uint32
+	Delta int32 `nb:"varint"`
+}
+
+type fuzzMessage struct {
+	Kind  uint16 `nb:"le"`
+	Seq   int    `nb:"i32"`
+	Size  uint64 `nb:"varint"`
+	Name  string `nb:"len=u8"`
+	Token []byte `nb:"len=varint"`
+	Ratio float32
+	OK    bool
+	Items []fuzzItem `nb:"len=u16"`
+	Ports [2]uint16  `nb:"le"`
+	Tags  []string   `nb:"len=u8"`
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	seed := NewBuffer()
+	if err := Marshal(seed, fuzzMessage{
+		Kind: 1, Seq: -2, Size: 300, Name: "name", Token: []byte{1, 2},
+		Ratio: 0.5, OK: true, Items: []fuzzItem{{1, -1}}, Tags: []string{"a", ""},
+	}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed.PeekAllAsByteSlice())
+	f.Add([]byte{})
+	f.Add(make([]byte, 40))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := NewBuffer()
+		buf.Append(data)
+		var m fuzzMessage
+		if err := Unmarshal(buf, &m); err != nil {
+			if !bytes.Equal(buf.PeekAllAsByteSlice(), data) {
+				t.Fatalf("failed Unmarshal changed the buffer: %v", err)
+			}
+			return
+		}
+
+		// Decoding is lenient about bools and varints, so compare the
+		// encodings of the decoded values rather than the input.
+		first := NewBuffer()
+		if err := Marshal(first, m); err != nil {
+			t.Fatalf("Marshal of an unmarshaled value error %v", err)
+		}
+		encoded := append([]byte(nil), first.PeekAllAsByteSlice()...)
+		var m2 fuzzMessage
+		if err := Unmarshal(first, &m2); err != nil || first.ReadableBytes() != 0 {
+			t.Fatalf("Unmarshal of a marshaled value error %v", err)
+		}
+		second := NewBuffer()
+		if err := Marshal(second, m2); err != nil {
+			t.Fatalf("Marshal error %v", err)
+		}
+		if !bytes.Equal(second.PeekAllAsByteSlice(), encoded) {
+			t.Fatalf("round trip changed the encoding")
+		}
+	})
+}
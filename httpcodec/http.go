@@ -0,0 +1,87 @@
+// Package httpcodec parses HTTP/1.1 requests and responses incrementally
+// from a netbuffer.Buffer, and appends them to one, as muduo's
+// HttpContext and HttpResponse do. It is meant for small endpoints, such
+// as health checks and admin pages, served next to a binary protocol on
+// the same reactor or server:
+//
+//	s.SetMessageCallback(func(c *tcpserver.Connection, input *netbuffer.Buffer, t time.Time) {
+//		p := c.Context().(*httpcodec.RequestParser)
+//		for {
+//			req, err := p.Parse(input)
+//			if err == httpcodec.ErrNeedMore {
+//				return
+//			}
+//			...
+//			out := netbuffer.NewBuffer()
+//			_ = httpcodec.AppendResponse(out, &httpcodec.Response{StatusCode: 200, Body: []byte("ok\n")})
+//			c.Send(out.PeekAllAsByteSlice())
+//		}
+//	})
+//
+// Bodies are delimited by Content-Length or chunked transfer coding, and
+// response bodies also by the end of the connection. Other transfer
+// codings, and messages with both a Content-Length and a
+// Transfer-Encoding, are rejected.
+package httpcodec
+
+import (
+	"errors"
+	"net/textproto"
+	"strings"
+)
+
+// Default limits of a parser.
+const (
+	defaultMaxHeaderBytes = 1 << 20 // start line, headers and trailers
+	defaultMaxBodyBytes   = 8 << 20
+)
+
+var (
+	// ErrNeedMore is returned by Parse when the buffer holds no whole
+	// message yet. Parse again once more bytes were appended.
+	ErrNeedMore = errors.New("httpcodec: need more bytes")
+	// ErrHeaderTooLarge is returned when the start line and the headers,
+	// or the trailers, exceed the header limit of the parser.
+	ErrHeaderTooLarge = errors.New("httpcodec: header too large")
+	// ErrBodyTooLarge is returned when a body exceeds the body limit of
+	// the parser.
+	ErrBodyTooLarge = errors.New("httpcodec: body too large")
+	// ErrInvalidStartLine is returned by AppendRequest and
+	// AppendResponse for a start line which would not parse back as
+	// written.
+	ErrInvalidStartLine = errors.New("httpcodec: invalid start line")
+)
+
+// Header holds the header fields of a message, by canonical name.
+type Header = textproto.MIMEHeader
+
+// Request is an HTTP request.
+type Request struct {
+	Method  string
+	Target  string // request target, such as "/health?verbose=1"
+	Proto   string // "HTTP/1.1" or "HTTP/1.0"
+	Header  Header
+	Body    []byte
+	Trailer Header // trailer fields of a chunked body, or nil
+}
+
+// KeepAlive reports whether the connection stays open after the response
+// to r: by default with HTTP/1.1, and with "Connection: keep-alive" with
+// HTTP/1.0.
+func (r *Request) KeepAlive() bool {
+	conn := strings.ToLower(r.Header.Get("Connection"))
+	if r.Proto == "HTTP/1.0" {
+		return conn == "keep-alive"
+	}
+	return conn != "close"
+}
+
+// Response is an HTTP response.
+type Response struct {
+	Proto      string // "HTTP/1.1" if empty when appended
+	StatusCode int
+	Reason     string // the standard reason phrase if empty when appended
+	Header     Header
+	Body       []byte
+	Trailer    Header // trailer fields of a chunked body, or nil
+}
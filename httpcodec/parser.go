@@ -0,0 +1,363 @@
+package httpcodec
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// States of a parser.
+const (
+	stateStartLine = iota
+	stateHeaders
+	stateBody // Content-Length bytes, or bytes until the end of the stream
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd // CRLF after the data of a chunk
+	stateTrailers
+)
+
+const maxChunkSizeLine = 1024
+
+// parser holds what is common to parsing requests and responses: the
+// headers and the body.
+type parser struct {
+	state          int
+	maxHeaderBytes int
+	maxBodyBytes   int
+
+	headerBytes int // of the start line, the headers and the trailers
+	header      Header
+	trailer     Header
+	body        []byte
+	remaining   int  // bytes left of the body or of the chunk
+	untilEOF    bool // the body ends with the stream
+}
+
+func newParser() parser {
+	return parser{maxHeaderBytes: defaultMaxHeaderBytes, maxBodyBytes: defaultMaxBodyBytes}
+}
+
+// SetLimits sets the most bytes of the start line and headers, and of the
+// body, of a message; 1 MiB and 8 MiB by default.
+func (p *parser) SetLimits(maxHeaderBytes, maxBodyBytes int) {
+	p.maxHeaderBytes = maxHeaderBytes
+	p.maxBodyBytes = maxBodyBytes
+}
+
+func (p *parser) reset() {
+	p.state = stateStartLine
+	p.headerBytes = 0
+	p.header = nil
+	p.trailer = nil
+	p.body = nil
+	p.remaining = 0
+	p.untilEOF = false
+}
+
+// line removes the next line from b, without its CRLF. It returns false if
+// b holds no whole line.
+func (p *parser) line(b *netbuffer.Buffer) (string, bool, error) {
+	i := b.FindCRLF()
+	if i < 0 {
+		if p.headerBytes+b.ReadableBytes() > p.maxHeaderBytes {
+			return "", false, ErrHeaderTooLarge
+		}
+		return "", false, nil
+	}
+	p.headerBytes += i + 2
+	if p.headerBytes > p.maxHeaderBytes {
+		return "", false, ErrHeaderTooLarge
+	}
+	line := string(b.PeekAsByteSlice(i))
+	b.Retrieve(i + 2)
+	return line, true, nil
+}
+
+// parse consumes b up to the end of a message, calling startLine with its
+// first line, and reports whether the message is complete. bodyless tells
+// whether the message has no body whatever its headers say; untilEOF
+// whether a message without a length has a body until the end of the
+// stream.
+func (p *parser) parse(b *netbuffer.Buffer, startLine func(line string) error, bodyless func() bool, untilEOF bool) (bool, error) {
+	for {
+		switch p.state {
+		case stateStartLine, stateHeaders, stateTrailers:
+			line, ok, err := p.line(b)
+			if err != nil || !ok {
+				return false, err
+			}
+			switch {
+			case p.state == stateStartLine && line == "" && p.headerBytes == 2:
+				// empty lines before a message are ignored, RFC 7230 3.5
+				p.headerBytes = 0
+			case p.state == stateStartLine:
+				if err := startLine(line); err != nil {
+					return false, err
+				}
+				p.header = make(Header)
+				p.state = stateHeaders
+			case line == "" && p.state == stateTrailers:
+				return true, nil
+			case line == "":
+				if err := p.beginBody(bodyless(), untilEOF); err != nil {
+					return false, err
+				}
+				if p.state == stateStartLine {
+					return true, nil
+				}
+			case p.state == stateTrailers:
+				if p.trailer == nil {
+					p.trailer = make(Header)
+				}
+				if err := addField(p.trailer, line); err != nil {
+					return false, err
+				}
+			default:
+				if err := addField(p.header, line); err != nil {
+					return false, err
+				}
+			}
+
+		case stateBody, stateChunkData:
+			n := b.ReadableBytes()
+			if !p.untilEOF && n > p.remaining {
+				n = p.remaining
+			}
+			if p.untilEOF && len(p.body)+n > p.maxBodyBytes {
+				return false, ErrBodyTooLarge
+			}
+			p.body = append(p.body, b.PeekAsByteSlice(n)...)
+			b.Retrieve(n)
+			if p.untilEOF {
+				return false, nil
+			}
+			if p.remaining -= n; p.remaining > 0 {
+				return false, nil
+			}
+			if p.state == stateBody {
+				return true, nil
+			}
+			p.state = stateChunkEnd
+
+		case stateChunkSize:
+			i := b.FindCRLF()
+			if i < 0 {
+				if b.ReadableBytes() > maxChunkSizeLine {
+					return false, fmt.Errorf("httpcodec: chunk size line longer than %d bytes", maxChunkSizeLine)
+				}
+				return false, nil
+			}
+			line := string(b.PeekAsByteSlice(i))
+			b.Retrieve(i + 2)
+			if j := strings.IndexByte(line, ';'); j >= 0 {
+				line = line[:j] // chunk extensions are ignored
+			}
+			size, err := strconv.ParseUint(strings.TrimSpace(line), 16, 63)
+			if err != nil {
+				return false, fmt.Errorf("httpcodec: malformed chunk size %q", line)
+			}
+			if size > uint64(p.maxBodyBytes-len(p.body)) {
+				return false, ErrBodyTooLarge
+			}
+			if size == 0 {
+				p.state = stateTrailers
+			} else {
+				p.remaining = int(size)
+				p.state = stateChunkData
+			}
+
+		case stateChunkEnd:
+			if b.ReadableBytes() < 2 {
+				return false, nil
+			}
+			if string(b.PeekAsByteSlice(2)) != "\r\n" {
+				return false, fmt.Errorf("httpcodec: chunk data not followed by CRLF")
+			}
+			b.Retrieve(2)
+			p.state = stateChunkSize
+		}
+	}
+}
+
+// beginBody chooses how the body is delimited once the headers are
+// parsed. It leaves the state at stateStartLine if there is no body.
+func (p *parser) beginBody(bodyless, untilEOF bool) error {
+	te, hasTE := p.header["Transfer-Encoding"]
+	cl, hasCL := p.header["Content-Length"]
+	switch {
+	case bodyless:
+		p.state = stateStartLine
+	case hasTE && hasCL:
+		return fmt.Errorf("httpcodec: both Transfer-Encoding and Content-Length")
+	case hasTE:
+		if len(te) != 1 || !strings.EqualFold(strings.TrimSpace(te[0]), "chunked") {
+			return fmt.Errorf("httpcodec: unsupported Transfer-Encoding %q", strings.Join(te, ", "))
+		}
+		p.state = stateChunkSize
+	case hasCL:
+		for _, v := range cl[1:] {
+			if v != cl[0] {
+				return fmt.Errorf("httpcodec: conflicting Content-Length %q and %q", cl[0], v)
+			}
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(cl[0]), 10, 63)
+		if err != nil {
+			return fmt.Errorf("httpcodec: malformed Content-Length %q", cl[0])
+		}
+		if n > uint64(p.maxBodyBytes) {
+			return ErrBodyTooLarge
+		}
+		if n == 0 {
+			p.state = stateStartLine
+		} else {
+			p.remaining = int(n)
+			p.state = stateBody
+		}
+	case untilEOF:
+		p.untilEOF = true
+		p.state = stateBody
+	default:
+		p.state = stateStartLine
+	}
+	return nil
+}
+
+func addField(h Header, line string) error {
+	if line[0] == ' ' || line[0] == '\t' {
+		return fmt.Errorf("httpcodec: obsolete line folding in %q", line)
+	}
+	i := strings.IndexByte(line, ':')
+	if i <= 0 || strings.ContainsAny(line[:i], " \t") {
+		return fmt.Errorf("httpcodec: malformed header line %q", line)
+	}
+	h.Add(line[:i], strings.Trim(line[i+1:], " \t"))
+	return nil
+}
+
+func validProto(proto string) bool {
+	return proto == "HTTP/1.1" || proto == "HTTP/1.0"
+}
+
+// RequestParser parses requests from a Buffer, one after another.
+type RequestParser struct {
+	parser
+	req *Request
+}
+
+// NewRequestParser returns a parser with the default limits.
+func NewRequestParser() *RequestParser {
+	return &RequestParser{parser: newParser()}
+}
+
+// Parse consumes the bytes of a request from b and returns the request
+// once it is complete. Until then it returns ErrNeedMore, keeping what it
+// has parsed so far. The bytes of the next request are left in b. After
+// any other error the connection should be closed.
+func (p *RequestParser) Parse(b *netbuffer.Buffer) (*Request, error) {
+	done, err := p.parse(b, p.startLine, func() bool { return false }, false)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		return nil, ErrNeedMore
+	}
+	req := p.req
+	req.Header, req.Body, req.Trailer = p.header, p.body, p.trailer
+	p.req = nil
+	p.reset()
+	return req, nil
+}
+
+func (p *RequestParser) startLine(line string) error {
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || !validProto(parts[2]) {
+		return fmt.Errorf("httpcodec: malformed request line %q", line)
+	}
+	p.req = &Request{Method: parts[0], Target: parts[1], Proto: parts[2]}
+	return nil
+}
+
+// ResponseParser parses responses from a Buffer, one after another.
+type ResponseParser struct {
+	parser
+	resp   *Response
+	method string
+}
+
+// NewResponseParser returns a parser with the default limits.
+func NewResponseParser() *ResponseParser {
+	return &ResponseParser{parser: newParser()}
+}
+
+// SetRequestMethod tells the method of the request the next response
+// answers, as responses to HEAD have no body.
+func (p *ResponseParser) SetRequestMethod(method string) {
+	p.method = method
+}
+
+// Parse consumes the bytes of a response from b and returns the response
+// once it is complete. Until then it returns ErrNeedMore, keeping what it
+// has parsed so far. A response without Content-Length or chunked body,
+// which is not bodyless, is only complete at the end of the stream: call
+// ParseEOF then.
+func (p *ResponseParser) Parse(b *netbuffer.Buffer) (*Response, error) {
+	done, err := p.parse(b, p.startLine, p.bodyless, true)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		return nil, ErrNeedMore
+	}
+	return p.finish(), nil
+}
+
+// ParseEOF parses the rest of b at the end of the stream. It returns
+// io.EOF if no response was begun, and io.ErrUnexpectedEOF if the
+// response is incomplete.
+func (p *ResponseParser) ParseEOF(b *netbuffer.Buffer) (*Response, error) {
+	resp, err := p.Parse(b)
+	if err != ErrNeedMore {
+		return resp, err
+	}
+	switch {
+	case p.untilEOF:
+		return p.finish(), nil
+	case p.state == stateStartLine && p.headerBytes == 0 && b.ReadableBytes() == 0:
+		return nil, io.EOF
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (p *ResponseParser) finish() *Response {
+	resp := p.resp
+	resp.Header, resp.Body, resp.Trailer = p.header, p.body, p.trailer
+	p.resp = nil
+	p.method = ""
+	p.reset()
+	return resp
+}
+
+func (p *ResponseParser) bodyless() bool {
+	code := p.resp.StatusCode
+	return p.method == "HEAD" || code/100 == 1 || code == 204 || code == 304
+}
+
+func (p *ResponseParser) startLine(line string) error {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !validProto(parts[0]) || len(parts[1]) != 3 {
+		return fmt.Errorf("httpcodec: malformed status line %q", line)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil || code < 100 {
+		return fmt.Errorf("httpcodec: malformed status line %q", line)
+	}
+	p.resp = &Response{Proto: parts[0], StatusCode: code}
+	if len(parts) == 3 {
+		p.resp.Reason = parts[2]
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package httpcodec
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// parseRequests feeds input to a parser a byte at a time, as the slowest
+// peer would send it, and returns the requests parsed.
+func parseRequests(t *testing.T, input string) []*Request {
+	t.Helper()
+	p := NewRequestParser()
+	b := netbuffer.NewBuffer()
+	var reqs []*Request
+	for i := 0; i < len(input); i++ {
+		b.Append([]byte{input[i]})
+		for {
+			req, err := p.Parse(b)
+			if err == ErrNeedMore {
+				break
+			}
+			if err != nil {
+				t.Fatalf("p.Parse error %v at byte %d", err, i)
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	if b.ReadableBytes() != 0 {
+		t.Errorf("%d bytes left unparsed", b.ReadableBytes())
+	}
+	return reqs
+}
+
+func TestParseRequests(t *testing.T) {
+	input := "\r\nGET /health?verbose=1 HTTP/1.1\r\nHost: example.com\r\nAccept: a\r\naccept:  b \r\n\r\n" +
+		"POST /admin HTTP/1.0\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nhello" +
+		"PUT /chunked HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5;ext=1\r\nhello\r\n7\r\n, world\r\n0\r\nChecksum: 42\r\n\r\n"
+	reqs := parseRequests(t, input)
+	want := []*Request{
+		{
+			Method: "GET", Target: "/health?verbose=1", Proto: "HTTP/1.1",
+			Header: Header{"Host": {"example.com"}, "Accept": {"a", "b"}},
+		},
+		{
+			Method: "POST", Target: "/admin", Proto: "HTTP/1.0",
+			Header: Header{"Content-Length": {"5"}, "Connection": {"keep-alive"}},
+			Body:   []byte("hello"),
+		},
+		{
+			Method: "PUT", Target: "/chunked", Proto: "HTTP/1.1",
+			Header:  Header{"Transfer-Encoding": {"chunked"}},
+			Body:    []byte("hello, world"),
+			Trailer: Header{"Checksum": {"42"}},
+		},
+	}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Fatalf("parsed %+v, want %+v", reqs, want)
+	}
+	for i, keepAlive := range []bool{true, true, true} {
+		if reqs[i].KeepAlive() != keepAlive {
+			t.Errorf("request %d: KeepAlive() = %v", i, !keepAlive)
+		}
+	}
+	if (&Request{Proto: "HTTP/1.0", Header: Header{}}).KeepAlive() {
+		t.Errorf("HTTP/1.0 request without Connection header is kept alive")
+	}
+	if (&Request{Proto: "HTTP/1.1", Header: Header{"Connection": {"close"}}}).KeepAlive() {
+		t.Errorf("HTTP/1.1 request with Connection: close is kept alive")
+	}
+}
+
+func TestParseRequestErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"request line", "GET /\r\n\r\n"},
+		{"protocol", "GET / HTTP/2.0\r\n\r\n"},
+		{"header", "GET / HTTP/1.1\r\nNo colon\r\n\r\n"},
+		{"space before colon", "GET / HTTP/1.1\r\nHost : a\r\n\r\n"},
+		{"folding", "GET / HTTP/1.1\r\nA: b\r\n c\r\n\r\n"},
+		{"both lengths", "POST / HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n"},
+		{"transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n"},
+		{"content length", "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n"},
+		{"conflicting lengths", "POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n"},
+		{"chunk size", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nx\r\n"},
+		{"chunk end", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n1\r\nab\r\n"},
+	}
+	for _, c := range cases {
+		b := netbuffer.NewBuffer()
+		b.AppendString(c.input)
+		if req, err := NewRequestParser().Parse(b); err == nil || err == ErrNeedMore {
+			t.Errorf("%s: p.Parse returned %+v, %v", c.name, req, err)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	p := NewRequestParser()
+	p.SetLimits(32, 4)
+	b := netbuffer.NewBuffer()
+	b.AppendString("GET / HTTP/1.1\r\nHost: a long host name")
+	if _, err := p.Parse(b); err != ErrHeaderTooLarge {
+		t.Errorf("p.Parse error %v, want %v", err, ErrHeaderTooLarge)
+	}
+
+	cases := []string{
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\n",
+	}
+	for _, input := range cases {
+		p := NewRequestParser()
+		p.SetLimits(1024, 4)
+		b := netbuffer.NewBuffer()
+		b.AppendString(input)
+		if _, err := p.Parse(b); err != ErrBodyTooLarge {
+			t.Errorf("p.Parse of %q error %v, want %v", input, err, ErrBodyTooLarge)
+		}
+	}
+}
+
+func TestParseResponses(t *testing.T) {
+	p := NewResponseParser()
+	b := netbuffer.NewBuffer()
+	b.AppendString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok" +
+		"HTTP/1.1 204 No Content\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n" + // answers HEAD
+		"HTTP/1.0 500\r\n\r\nuntil the end")
+
+	var got []*Response
+	for i := 0; ; i++ {
+		if i == 2 {
+			p.SetRequestMethod("HEAD")
+		}
+		resp, err := p.Parse(b)
+		if err == ErrNeedMore {
+			break
+		}
+		if err != nil {
+			t.Fatalf("p.Parse error %v", err)
+		}
+		got = append(got, resp)
+	}
+	resp, err := p.ParseEOF(b)
+	if err != nil {
+		t.Fatalf("p.ParseEOF error %v", err)
+	}
+	got = append(got, resp)
+
+	want := []*Response{
+		{Proto: "HTTP/1.1", StatusCode: 200, Reason: "OK", Header: Header{"Content-Length": {"2"}}, Body: []byte("ok")},
+		{Proto: "HTTP/1.1", StatusCode: 204, Reason: "No Content", Header: Header{}},
+		{Proto: "HTTP/1.1", StatusCode: 200, Reason: "OK", Header: Header{"Content-Length": {"10"}}},
+		{Proto: "HTTP/1.0", StatusCode: 500, Header: Header{}, Body: []byte("until the end")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsed %+v, want %+v", got, want)
+	}
+
+	if _, err := p.ParseEOF(b); err != io.EOF {
+		t.Errorf("p.ParseEOF of nothing error %v, want %v", err, io.EOF)
+	}
+	b.AppendString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nabc")
+	if _, err := p.ParseEOF(b); err != io.ErrUnexpectedEOF {
+		t.Errorf("p.ParseEOF of a partial response error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	b = netbuffer.NewBuffer()
+	b.AppendString("HTTP/1.1 2000 OK\r\n\r\n")
+	if _, err := NewResponseParser().Parse(b); err == nil || err == ErrNeedMore {
+		t.Errorf("p.Parse of a malformed status line error %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package httpcodec
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// AppendResponse appends r to b. The Content-Length header is set to the
+// length of r.Body, except for 1xx, 204 and 304 responses, unless r has a
+// chunked Transfer-Encoding, in which case r.Body is appended as a single
+// chunk followed by r.Trailer. If r.Proto or r.Reason holds a CR, LF or
+// NUL, it returns ErrInvalidStartLine and appends nothing.
+func AppendResponse(b *netbuffer.Buffer, r *Response) error {
+	proto := r.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	reason := r.Reason
+	if reason == "" {
+		reason = http.StatusText(r.StatusCode)
+	}
+	if !validStartLineWord(proto) || strings.ContainsAny(reason, "\r\n\x00") {
+		return ErrInvalidStartLine
+	}
+	b.AppendString(proto)
+	b.AppendString(" ")
+	b.AppendString(strconv.Itoa(r.StatusCode))
+	b.AppendString(" ")
+	b.AppendString(reason)
+	b.AppendString("\r\n")
+	code := r.StatusCode
+	appendMessage(b, r.Header, r.Body, r.Trailer, code/100 != 1 && code != 204 && code != 304)
+	return nil
+}
+
+// AppendRequest appends r to b. The Content-Length header is set to the
+// length of r.Body if it is not empty, unless r has a chunked
+// Transfer-Encoding, in which case r.Body is appended as a single chunk
+// followed by r.Trailer. If r.Method, r.Target or r.Proto is empty or
+// holds a space, CR, LF or NUL, it returns ErrInvalidStartLine and
+// appends nothing.
+func AppendRequest(b *netbuffer.Buffer, r *Request) error {
+	proto := r.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	if !validStartLineWord(r.Method) || !validStartLineWord(r.Target) || !validStartLineWord(proto) {
+		return ErrInvalidStartLine
+	}
+	b.AppendString(r.Method)
+	b.AppendString(" ")
+	b.AppendString(r.Target)
+	b.AppendString(" ")
+	b.AppendString(proto)
+	b.AppendString("\r\n")
+	appendMessage(b, r.Header, r.Body, r.Trailer, len(r.Body) > 0)
+	return nil
+}
+
+// validStartLineWord reports whether s can be a space separated word of a
+// start line, so that it cannot end the line or split into more words.
+func validStartLineWord(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \r\n\x00")
+}
+
+// appendMessage appends the headers, sorted by name, and the body.
+func appendMessage(b *netbuffer.Buffer, h Header, body []byte, trailer Header, contentLength bool) {
+	// as the parser does
+	chunked := strings.EqualFold(strings.TrimSpace(getFold(h, "Transfer-Encoding")), "chunked")
+	for _, name := range sortedNames(h) {
+		if strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		appendFields(b, name, h[name])
+	}
+	if !chunked {
+		if contentLength {
+			appendFields(b, "Content-Length", []string{strconv.Itoa(len(body))})
+		}
+		b.AppendString("\r\n")
+		b.Append(body)
+		return
+	}
+
+	b.AppendString("\r\n")
+	if len(body) > 0 {
+		b.AppendString(strconv.FormatInt(int64(len(body)), 16))
+		b.AppendString("\r\n")
+		b.Append(body)
+		b.AppendString("\r\n")
+	}
+	b.AppendString("0\r\n")
+	for _, name := range sortedNames(trailer) {
+		appendFields(b, name, trailer[name])
+	}
+	b.AppendString("\r\n")
+}
+
+// appendFields appends the fields name: values. Control characters, CR
+// and LF among them, are replaced with spaces, as net/http replaces CR and
+// LF, so that a name or value cannot end the field and inject others.
+func appendFields(b *netbuffer.Buffer, name string, values []string) {
+	name = ctlToSpace(name)
+	for _, v := range values {
+		b.AppendString(name)
+		b.AppendString(": ")
+		b.AppendString(ctlToSpace(v))
+		b.AppendString("\r\n")
+	}
+}
+
+func ctlToSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// getFold returns the first value of the field name in h, whose names
+// may not be canonical when h was made literally.
+func getFold(h Header, name string) string {
+	if v := h.Get(name); v != "" {
+		return v
+	}
+	for n, values := range h {
+		if strings.EqualFold(n, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func sortedNames(h Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
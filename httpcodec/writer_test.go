@@ -0,0 +1,113 @@
+package httpcodec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func TestAppendResponse(t *testing.T) {
+	cases := []struct {
+		resp *Response
+		want string
+	}{
+		{
+			&Response{StatusCode: 200, Header: Header{"Content-Type": {"text/plain"}, "Content-Length": {"99"}}, Body: []byte("ok\n")},
+			"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\nok\n",
+		},
+		{
+			&Response{Proto: "HTTP/1.0", StatusCode: 404, Reason: "Gone Fishing"},
+			"HTTP/1.0 404 Gone Fishing\r\nContent-Length: 0\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 204, Header: Header{"B": {"2"}, "A": {"1", "3"}}},
+			"HTTP/1.1 204 No Content\r\nA: 1\r\nA: 3\r\nB: 2\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 304, Header: Header{"Etag": {`"1"`}}},
+			"HTTP/1.1 304 Not Modified\r\nEtag: \"1\"\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 101, Header: Header{"Upgrade": {"websocket"}}},
+			"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 200, Header: Header{"Transfer-Encoding": {"chunked"}}, Body: []byte("0123456789abcdefg"), Trailer: Header{"Checksum": {"1"}}},
+			"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n11\r\n0123456789abcdefg\r\n0\r\nChecksum: 1\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 200, Header: Header{"Transfer-Encoding": {"Chunked"}}, Body: []byte("ab")},
+			"HTTP/1.1 200 OK\r\nTransfer-Encoding: Chunked\r\n\r\n2\r\nab\r\n0\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 200, Header: Header{"content-length": {"9"}, "transfer-encoding": {"chunked"}}, Body: []byte("ab")},
+			"HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n2\r\nab\r\n0\r\n\r\n",
+		},
+		{
+			&Response{StatusCode: 204, Header: Header{"Location": {"/a\r\nSet-Cookie: x=1"}, "X\nY": {"\x00\tz\x7f"}}},
+			"HTTP/1.1 204 No Content\r\nLocation: /a  Set-Cookie: x=1\r\nX Y:  \tz \r\n\r\n",
+		},
+	}
+	for _, c := range cases {
+		b := netbuffer.NewBuffer()
+		if err := AppendResponse(b, c.resp); err != nil {
+			t.Errorf("AppendResponse error %v", err)
+		}
+		if got := string(b.PeekAllAsByteSlice()); got != c.want {
+			t.Errorf("AppendResponse appended %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestAppendRequestRoundTrip(t *testing.T) {
+	reqs := []*Request{
+		{Method: "GET", Target: "/health", Proto: "HTTP/1.1", Header: Header{"Host": {"a"}}},
+		{Method: "POST", Target: "/admin", Proto: "HTTP/1.1", Header: Header{"Content-Length": {"4"}}, Body: []byte("body")},
+		{
+			Method: "POST", Target: "/chunked", Proto: "HTTP/1.1",
+			Header: Header{"Transfer-Encoding": {"chunked"}}, Body: []byte("body"), Trailer: Header{"A": {"b"}},
+		},
+	}
+	b := netbuffer.NewBuffer()
+	for _, req := range reqs {
+		if err := AppendRequest(b, req); err != nil {
+			t.Fatalf("AppendRequest error %v", err)
+		}
+	}
+	p := NewRequestParser()
+	for i, want := range reqs {
+		got, err := p.Parse(b)
+		if err != nil {
+			t.Fatalf("request %d: p.Parse error %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("request %d: parsed %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestAppendInvalidStartLine(t *testing.T) {
+	reqs := []*Request{
+		{Method: "GET", Target: "/ HTTP/1.1\r\nX-Evil: 1\r\n\r\nGET /x"},
+		{Method: "GET", Target: "/a b"},
+		{Method: "GET /", Target: "/"},
+		{Method: "GET", Target: "/\x00"},
+		{Method: "GET", Target: ""},
+		{Method: "GET", Target: "/", Proto: "HTTP/1.1\n"},
+	}
+	b := netbuffer.NewBuffer()
+	for _, req := range reqs {
+		if err := AppendRequest(b, req); err != ErrInvalidStartLine {
+			t.Errorf("AppendRequest(%q %q %q) error %v, want %v", req.Method, req.Target, req.Proto, err, ErrInvalidStartLine)
+		}
+	}
+	for _, reason := range []string{"OK\r\nSet-Cookie: a=b", "OK\n", "O\x00K"} {
+		if err := AppendResponse(b, &Response{StatusCode: 200, Reason: reason}); err != ErrInvalidStartLine {
+			t.Errorf("AppendResponse with reason %q error %v, want %v", reason, err, ErrInvalidStartLine)
+		}
+	}
+	if b.ReadableBytes() != 0 {
+		t.Errorf("failed appends appended %q", b.PeekAllAsByteSlice())
+	}
+}
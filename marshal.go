@@ -0,0 +1,645 @@
+package netbuffer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshal appends the exported fields of the struct v, or of the struct v
+// points to, to b in declaration order. The encoding of a field is chosen
+// by its type and its nb tag, a comma separated list of options:
+//
+//	i8, i16, i32, i64   signed integer of 1, 2, 4 or 8 bytes
+//	u8, u16, u32, u64   unsigned integer of 1, 2, 4 or 8 bytes
+//	f32, f64            IEEE 754 float of 4 or 8 bytes
+//	varint              varint, zig-zag encoded for signed integers
+//	le, be              little or big endian, big endian by default
+//	len=FORMAT          prefix of a string, []byte or slice holding its
+//	                    length, one of u8, u16, u32, u64 or varint;
+//	                    u32 by default
+//	-                   skip the field
+//
+// Integers, floats and bools (one byte) default to their natural size.
+// int and uint default to 8 bytes. Options of a slice or array field also
+// apply to its elements; arrays have no length prefix. Nested structs are
+// encoded field by field.
+//
+// If Marshal returns an error, b is left unchanged.
+func Marshal(b *Buffer, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("netbuffer: Marshal of non-struct type %T", v)
+	}
+	p, err := planFor(rv.Type())
+	if err != nil {
+		return fmt.Errorf("netbuffer: %v", err)
+	}
+	if err := b.appendOrRollback(func() error { return p.encode(b, rv) }); err != nil {
+		return fmt.Errorf("netbuffer: %v", err)
+	}
+	return nil
+}
+
+// Unmarshal parses the readable bytes of b into the struct v points to,
+// in the encoding described by Marshal, and removes the parsed bytes
+// from b.
+//
+// If the readable bytes end in the middle of v, it returns ErrShortBuffer.
+// If Unmarshal returns an error, b is left unchanged.
+func Unmarshal(b *Buffer, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("netbuffer: Unmarshal needs a non-nil pointer to struct, not %T", v)
+	}
+	rv = rv.Elem()
+	p, err := planFor(rv.Type())
+	if err != nil {
+		return fmt.Errorf("netbuffer: %v", err)
+	}
+	d := &decoder{data: b.buf[b.readerIndex:b.writerIndex]}
+	if err := p.decode(d, rv); err != nil {
+		if err == ErrShortBuffer {
+			return err
+		}
+		return fmt.Errorf("netbuffer: %v", err)
+	}
+	b.Retrieve(d.off)
+	return nil
+}
+
+// plans caches a *plan or an error for each struct type.
+var plans sync.Map
+
+// plan encodes and decodes a struct type.
+type plan struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	index int
+	codec codec
+}
+
+// codec encodes and decodes a value of one type with one set of options.
+type codec interface {
+	encode(b *Buffer, v reflect.Value) error
+	decode(d *decoder, v reflect.Value) error
+}
+
+// decoder parses data without consuming a Buffer, so that a failed
+// Unmarshal leaves it unchanged.
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, ErrShortBuffer
+	}
+	p := d.data[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+func planFor(t reflect.Type) (*plan, error) {
+	if cached, ok := plans.Load(t); ok {
+		if err, ok := cached.(error); ok {
+			return nil, err
+		}
+		return cached.(*plan), nil
+	}
+	p, err := buildPlan(t)
+	if err != nil {
+		plans.Store(t, err)
+		return nil, err
+	}
+	plans.Store(t, p)
+	return p, nil
+}
+
+func buildPlan(t reflect.Type) (*plan, error) {
+	p := &plan{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("nb")
+		if sf.PkgPath != "" || tag == "-" {
+			continue
+		}
+		opts, err := parseOptions(tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		c, err := newCodec(sf.Type, opts)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		p.fields = append(p.fields, field{name: sf.Name, index: i, codec: c})
+	}
+	return p, nil
+}
+
+func (p *plan) encode(b *Buffer, v reflect.Value) error {
+	for _, f := range p.fields {
+		if err := f.codec.encode(b, v.Field(f.index)); err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (p *plan) decode(d *decoder, v reflect.Value) error {
+	for _, f := range p.fields {
+		if err := f.codec.decode(d, v.Field(f.index)); err != nil {
+			if err == ErrShortBuffer {
+				return err
+			}
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// options are the parsed nb tag of a field.
+type options struct {
+	format string // i8 ... u64, f32, f64, varint or empty
+	le     bool
+	length string // len= format, or empty
+}
+
+func parseOptions(tag string) (options, error) {
+	var opts options
+	if tag == "" {
+		return opts, nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch opt = strings.TrimSpace(opt); {
+		case opt == "le":
+			opts.le = true
+		case opt == "be":
+			opts.le = false
+		case strings.HasPrefix(opt, "len="):
+			opts.length = strings.TrimPrefix(opt, "len=")
+			if _, ok := intFormats[opts.length]; !ok || opts.length[0] == 'i' {
+				return opts, fmt.Errorf("invalid length format %q", opts.length)
+			}
+		case opt == "f32" || opt == "f64":
+			opts.format = opt
+		default:
+			if _, ok := intFormats[opt]; !ok {
+				return opts, fmt.Errorf("unknown option %q", opt)
+			}
+			opts.format = opt
+		}
+	}
+	return opts, nil
+}
+
+// intFormat is the wire format of an integer.
+type intFormat struct {
+	size   int // 0 for varint
+	signed bool
+	le     bool
+}
+
+var intFormats = map[string]intFormat{
+	"i8": {1, true, false}, "i16": {2, true, false}, "i32": {4, true, false}, "i64": {8, true, false},
+	"u8": {1, false, false}, "u16": {2, false, false}, "u32": {4, false, false}, "u64": {8, false, false},
+	"varint": {0, false, false},
+}
+
+func (f intFormat) order() binary.ByteOrder {
+	if f.le {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// put appends the low f.size bytes of x.
+func (f intFormat) put(b *Buffer, x uint64) {
+	switch f.size {
+	case 0:
+		b.AppendUvarint(x)
+		return
+	case 1:
+		b.ensureWritableBytes(1)
+		b.buf[b.writerIndex] = byte(x)
+	case 2:
+		b.ensureWritableBytes(2)
+		f.order().PutUint16(b.WritableByteSlice(), uint16(x))
+	case 4:
+		b.ensureWritableBytes(4)
+		f.order().PutUint32(b.WritableByteSlice(), uint32(x))
+	case 8:
+		b.ensureWritableBytes(8)
+		f.order().PutUint64(b.WritableByteSlice(), x)
+	}
+	b.HasWritten(f.size)
+}
+
+func (f intFormat) get(d *decoder) (uint64, error) {
+	if f.size == 0 {
+		x, n := binary.Uvarint(d.data[d.off:])
+		if err := varintError(n); err != nil {
+			return 0, err
+		}
+		d.off += n
+		return x, nil
+	}
+	p, err := d.next(f.size)
+	if err != nil {
+		return 0, err
+	}
+	switch f.size {
+	case 1:
+		return uint64(p[0]), nil
+	case 2:
+		return uint64(f.order().Uint16(p)), nil
+	case 4:
+		return uint64(f.order().Uint32(p)), nil
+	default:
+		return f.order().Uint64(p), nil
+	}
+}
+
+func (f intFormat) putInt(b *Buffer, x int64) error {
+	if f.size == 0 {
+		b.AppendVarint(x)
+		return nil
+	}
+	if f.size < 8 {
+		bits := uint(8*f.size - 1)
+		if f.signed && (x < -1<<bits || x >= 1<<bits) || !f.signed && (x < 0 || x >= 1<<(bits+1)) {
+			return fmt.Errorf("%d overflows %d bytes", x, f.size)
+		}
+	} else if !f.signed && x < 0 {
+		return fmt.Errorf("%d overflows an unsigned integer", x)
+	}
+	f.put(b, uint64(x))
+	return nil
+}
+
+func (f intFormat) putUint(b *Buffer, x uint64) error {
+	limit := uint64(math.MaxUint64)
+	if f.size != 0 && f.signed {
+		limit = 1<<uint(8*f.size-1) - 1
+	} else if f.size != 0 && f.size < 8 {
+		limit = 1<<uint(8*f.size) - 1
+	}
+	if x > limit {
+		return fmt.Errorf("%d overflows %d bytes", x, f.size)
+	}
+	f.put(b, x)
+	return nil
+}
+
+func (f intFormat) getInt(d *decoder) (int64, error) {
+	if f.size == 0 {
+		x, n := binary.Varint(d.data[d.off:])
+		if err := varintError(n); err != nil {
+			return 0, err
+		}
+		d.off += n
+		return x, nil
+	}
+	u, err := f.get(d)
+	if err != nil {
+		return 0, err
+	}
+	if !f.signed {
+		if f.size == 8 && u > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", u)
+		}
+		return int64(u), nil
+	}
+	shift := uint(64 - 8*f.size)
+	return int64(u<<shift) >> shift, nil
+}
+
+func (f intFormat) getUint(d *decoder) (uint64, error) {
+	if f.size != 0 && f.signed {
+		x, err := f.getInt(d)
+		if err != nil {
+			return 0, err
+		}
+		if x < 0 {
+			return 0, fmt.Errorf("%d overflows an unsigned integer", x)
+		}
+		return uint64(x), nil
+	}
+	return f.get(d)
+}
+
+func newCodec(t reflect.Type, opts options) (codec, error) {
+	if opts.length != "" {
+		switch t.Kind() {
+		case reflect.String, reflect.Slice:
+		default:
+			return nil, fmt.Errorf("len= on type %s", t)
+		}
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, err := integerFormat(t, opts, true)
+		return intCodec{f}, err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, err := integerFormat(t, opts, false)
+		return uintCodec{f}, err
+	case reflect.Bool:
+		if opts.format != "" {
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t)
+		}
+		return boolCodec{}, nil
+	case reflect.Float32, reflect.Float64:
+		size := t.Size()
+		switch opts.format {
+		case "":
+		case "f32":
+			size = 4
+		case "f64":
+			size = 8
+		default:
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t)
+		}
+		return floatCodec{intFormat{size: int(size), le: opts.le}}, nil
+	case reflect.String:
+		if opts.format != "" {
+			return nil, fmt.Errorf("option %s on type %s", opts.format, t)
+		}
+		return stringCodec{lengthFormat(opts)}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && opts.format == "" {
+			return bytesCodec{lengthFormat(opts)}, nil
+		}
+		elemOpts := opts
+		elemOpts.length = ""
+		elem, err := newCodec(t.Elem(), elemOpts)
+		if err != nil {
+			return nil, err
+		}
+		return sliceCodec{lengthFormat(opts), elem}, nil
+	case reflect.Array:
+		elem, err := newCodec(t.Elem(), opts)
+		if err != nil {
+			return nil, err
+		}
+		return arrayCodec{elem}, nil
+	case reflect.Struct:
+		if opts != (options{}) {
+			return nil, fmt.Errorf("options on struct type %s", t)
+		}
+		return structCodec{t}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func integerFormat(t reflect.Type, opts options, signed bool) (intFormat, error) {
+	if opts.format == "f32" || opts.format == "f64" {
+		return intFormat{}, fmt.Errorf("option %s on type %s", opts.format, t)
+	}
+	f, ok := intFormats[opts.format]
+	if !ok {
+		f = intFormat{size: int(t.Size()), signed: signed}
+		switch t.Kind() {
+		case reflect.Int, reflect.Uint, reflect.Uintptr:
+			// the same on every platform, as netbuffergen writes them
+			f.size = 8
+		}
+	}
+	if opts.format == "varint" {
+		f.signed = signed
+	}
+	f.le = opts.le
+	return f, nil
+}
+
+func lengthFormat(opts options) intFormat {
+	if opts.length == "" {
+		return intFormat{size: 4, le: opts.le}
+	}
+	f := intFormats[opts.length]
+	f.le = opts.le
+	return f
+}
+
+func (f intFormat) getLength(d *decoder) (int, error) {
+	n, err := f.get(d)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)-d.off) {
+		// every element takes at least one byte, except in odd cases
+		// such as struct{}, which are not worth a huge allocation
+		return 0, ErrShortBuffer
+	}
+	return int(n), nil
+}
+
+type intCodec struct{ f intFormat }
+
+func (c intCodec) encode(b *Buffer, v reflect.Value) error {
+	return c.f.putInt(b, v.Int())
+}
+
+func (c intCodec) decode(d *decoder, v reflect.Value) error {
+	x, err := c.f.getInt(d)
+	if err != nil {
+		return err
+	}
+	if v.OverflowInt(x) {
+		return fmt.Errorf("%d overflows %s", x, v.Type())
+	}
+	v.SetInt(x)
+	return nil
+}
+
+type uintCodec struct{ f intFormat }
+
+func (c uintCodec) encode(b *Buffer, v reflect.Value) error {
+	return c.f.putUint(b, v.Uint())
+}
+
+func (c uintCodec) decode(d *decoder, v reflect.Value) error {
+	x, err := c.f.getUint(d)
+	if err != nil {
+		return err
+	}
+	if v.OverflowUint(x) {
+		return fmt.Errorf("%d overflows %s", x, v.Type())
+	}
+	v.SetUint(x)
+	return nil
+}
+
+type boolCodec struct{}
+
+func (boolCodec) encode(b *Buffer, v reflect.Value) error {
+	var x uint64
+	if v.Bool() {
+		x = 1
+	}
+	intFormat{size: 1}.put(b, x)
+	return nil
+}
+
+func (boolCodec) decode(d *decoder, v reflect.Value) error {
+	x, err := intFormat{size: 1}.get(d)
+	if err != nil {
+		return err
+	}
+	v.SetBool(x != 0)
+	return nil
+}
+
+type floatCodec struct{ f intFormat }
+
+func (c floatCodec) encode(b *Buffer, v reflect.Value) error {
+	if c.f.size == 4 {
+		c.f.put(b, uint64(math.Float32bits(float32(v.Float()))))
+	} else {
+		c.f.put(b, math.Float64bits(v.Float()))
+	}
+	return nil
+}
+
+func (c floatCodec) decode(d *decoder, v reflect.Value) error {
+	x, err := c.f.get(d)
+	if err != nil {
+		return err
+	}
+	if c.f.size == 4 {
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+	} else {
+		v.SetFloat(math.Float64frombits(x))
+	}
+	return nil
+}
+
+type stringCodec struct{ length intFormat }
+
+func (c stringCodec) encode(b *Buffer, v reflect.Value) error {
+	s := v.String()
+	if err := c.length.putUint(b, uint64(len(s))); err != nil {
+		return err
+	}
+	b.ensureWritableBytes(len(s))
+	b.HasWritten(copy(b.WritableByteSlice(), s))
+	return nil
+}
+
+func (c stringCodec) decode(d *decoder, v reflect.Value) error {
+	n, err := c.length.getLength(d)
+	if err != nil {
+		return err
+	}
+	p, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	v.SetString(string(p))
+	return nil
+}
+
+type bytesCodec struct{ length intFormat }
+
+func (c bytesCodec) encode(b *Buffer, v reflect.Value) error {
+	p := v.Bytes()
+	if err := c.length.putUint(b, uint64(len(p))); err != nil {
+		return err
+	}
+	b.appendWithLen(p, len(p))
+	return nil
+}
+
+func (c bytesCodec) decode(d *decoder, v reflect.Value) error {
+	n, err := c.length.getLength(d)
+	if err != nil {
+		return err
+	}
+	p, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	v.SetBytes(append([]byte(nil), p...))
+	return nil
+}
+
+type sliceCodec struct {
+	length intFormat
+	elem   codec
+}
+
+func (c sliceCodec) encode(b *Buffer, v reflect.Value) error {
+	if err := c.length.putUint(b, uint64(v.Len())); err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := c.elem.encode(b, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c sliceCodec) decode(d *decoder, v reflect.Value) error {
+	n, err := c.length.getLength(d)
+	if err != nil {
+		return err
+	}
+	s := reflect.MakeSlice(v.Type(), n, n)
+	for i := 0; i < n; i++ {
+		if err := c.elem.decode(d, s.Index(i)); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+type arrayCodec struct{ elem codec }
+
+func (c arrayCodec) encode(b *Buffer, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := c.elem.encode(b, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c arrayCodec) decode(d *decoder, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := c.elem.decode(d, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structCodec looks up the plan of a nested struct when it is used, so
+// that recursive types such as a tree node holding []Node can be planned.
+type structCodec struct{ t reflect.Type }
+
+func (c structCodec) encode(b *Buffer, v reflect.Value) error {
+	p, err := planFor(c.t)
+	if err != nil {
+		return err
+	}
+	return p.encode(b, v)
+}
+
+func (c structCodec) decode(d *decoder, v reflect.Value) error {
+	p, err := planFor(c.t)
+	if err != nil {
+		return err
+	}
+	return p.decode(d, v)
+}
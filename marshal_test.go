@@ -0,0 +1,179 @@
+package netbuffer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type marshalItem struct {
+	ID    uint32
+	Count int16 `nb:"varint"`
+}
+
+type marshalMessage struct {
+	Kind    uint16 `nb:"u16,le"`
+	Seq     int    `nb:"i32"`
+	Name    string `nb:"len=u8"`
+	Payload []byte `nb:"len=varint"`
+	Ratio   float32
+	Scale   float64 `nb:"f32"`
+	OK      bool
+	Items   []marshalItem `nb:"len=u16"`
+	Ports   []uint16      `nb:"le,len=u8"`
+	Pad     [2]uint8
+	Size    uint64 `nb:"varint"`
+	Skipped int    `nb:"-"`
+	hidden  int
+}
+
+func TestMarshal(t *testing.T) {
+	in := marshalMessage{
+		Kind:    0x0102,
+		Seq:     -7,
+		Name:    "hero",
+		Payload: []byte{1, 2, 3},
+		Ratio:   0.5,
+		Scale:   2.25,
+		OK:      true,
+		Items:   []marshalItem{{ID: 1, Count: -1}, {ID: 2, Count: 300}},
+		Ports:   []uint16{80, 443},
+		Pad:     [2]uint8{9, 8},
+		Size:    1 << 40,
+		Skipped: 5,
+		hidden:  6,
+	}
+	buf := NewBuffer()
+	if err := Marshal(buf, &in); err != nil {
+		t.Fatalf("Marshal error %v", err)
+	}
+	if got := buf.PeekAsByteSlice(2); !bytes.Equal(got, []byte{2, 1}) {
+		t.Errorf("Kind is encoded as %v, want little endian", got)
+	}
+	buf.Append([]byte("next"))
+
+	var out marshalMessage
+	if err := Unmarshal(buf, &out); err != nil {
+		t.Fatalf("Unmarshal error %v", err)
+	}
+	in.Skipped, in.hidden = 0, 0
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal got %+v, want %+v", out, in)
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "next" {
+		t.Errorf("after Unmarshal, readable bytes are %q, want %q", got, "next")
+	}
+}
+
+func TestUnmarshalShortBuffer(t *testing.T) {
+	src := NewBuffer()
+	if err := Marshal(src, marshalMessage{Name: "partial", Items: []marshalItem{{ID: 3}}}); err != nil {
+		t.Fatalf("Marshal error %v", err)
+	}
+	data := src.PeekAllAsByteSlice()
+
+	buf := NewBuffer()
+	for i := 0; i < len(data); i++ {
+		buf.Append(data[i : i+1])
+		var out marshalMessage
+		err := Unmarshal(buf, &out)
+		if i < len(data)-1 {
+			if err != ErrShortBuffer {
+				t.Fatalf("Unmarshal of %d bytes error %v, want %v", i+1, err, ErrShortBuffer)
+			}
+			if buf.ReadableBytes() != i+1 {
+				t.Fatalf("after Unmarshal of %d bytes, buf.ReadableBytes() = %d", i+1, buf.ReadableBytes())
+			}
+		} else if err != nil || out.Name != "partial" {
+			t.Errorf("Unmarshal of all bytes = %+v, %v", out, err)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("keep"))
+	tap := &recordingTap{}
+	buf.SetTap(tap)
+	if err := Marshal(buf, struct{ A int8 `nb:"u8"` }{-1}); err == nil {
+		t.Error("Marshal of a negative value as u8 returned no error")
+	}
+	if err := Marshal(buf, struct {
+		A uint16
+		B uint16 `nb:"u8"`
+	}{1, 256}); err == nil {
+		t.Error("Marshal of 256 as u8 returned no error")
+	}
+	if string(buf.PeekAllAsByteSlice()) != "keep" {
+		t.Errorf("after a failed Marshal, readable bytes are %q", buf.PeekAllAsByteSlice())
+	}
+	if len(tap.appended) != 0 {
+		t.Errorf("tap saw appended %q of a failed Marshal", tap.appended)
+	}
+	buf.SetTap(nil)
+	if err := Marshal(buf, struct{ A string `nb:"len=i8"` }{}); err == nil {
+		t.Error("Marshal with len=i8 returned no error")
+	}
+	if err := Marshal(buf, struct{ S string `nb:"u16"` }{}); err == nil {
+		t.Error("Marshal of a string with u16 returned no error")
+	}
+	if err := Marshal(buf, struct{ S []string `nb:"u8,len=u8"` }{}); err == nil {
+		t.Error("Marshal of strings with u8 returned no error")
+	}
+	if err := Marshal(buf, struct{ M map[int]int }{}); err == nil {
+		t.Error("Marshal of a map returned no error")
+	}
+	if err := Marshal(buf, 1); err == nil {
+		t.Error("Marshal of an int returned no error")
+	}
+	if err := Unmarshal(buf, marshalItem{}); err == nil {
+		t.Error("Unmarshal into a non-pointer returned no error")
+	}
+
+	buf.RetrieveAll()
+	buf.Append([]byte{0xff, 0xff})
+	var narrow struct {
+		A int8 `nb:"u16"`
+	}
+	if err := Unmarshal(buf, &narrow); err == nil || err == ErrShortBuffer {
+		t.Errorf("Unmarshal of 65535 into int8 error %v, want an overflow", err)
+	}
+}
+
+type marshalTree struct {
+	Value    uint8
+	Children []marshalTree `nb:"len=u8"`
+}
+
+func TestMarshalRecursive(t *testing.T) {
+	in := marshalTree{1, []marshalTree{{2, nil}, {3, []marshalTree{{4, nil}}}}}
+	buf := NewBuffer()
+	if err := Marshal(buf, in); err != nil {
+		t.Fatalf("Marshal error %v", err)
+	}
+	var out marshalTree
+	if err := Unmarshal(buf, &out); err != nil {
+		t.Fatalf("Unmarshal error %v", err)
+	}
+	if out.Children[1].Children[0].Value != 4 {
+		t.Errorf("Unmarshal got %+v, want %+v", out, in)
+	}
+}
+
+func TestMarshalIntSize(t *testing.T) {
+	in := struct {
+		I int
+		U uint
+		P uintptr
+	}{-1, 2, 3}
+	buf := NewBuffer()
+	if err := Marshal(buf, &in); err != nil {
+		t.Fatalf("Marshal error %v", err)
+	}
+	if n := buf.ReadableBytes(); n != 24 {
+		t.Fatalf("int, uint and uintptr are encoded in %d bytes, want 24", n)
+	}
+	if x, _ := buf.PeekInt64(); x != -1 {
+		t.Errorf("int is encoded as %d, want -1", x)
+	}
+}
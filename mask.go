@@ -0,0 +1,20 @@
+package netbuffer
+
+// Mask XORs in place the n readable bytes of this buffer at offset off
+// with key, repeated, as WebSocket masks and unmasks payloads (RFC 6455,
+// section 5.3). Masking twice with the same key restores the bytes.
+// If off and n exceed the readable bytes, it returns ErrShortBuffer.
+func (b *Buffer) Mask(off, n int, key [4]byte) error {
+	if off < 0 || n < 0 || off+n > b.ReadableBytes() {
+		return ErrShortBuffer
+	}
+	b.unshare()
+	if debug {
+		b.gen++
+	}
+	p := b.buf[b.readerIndex+off : b.readerIndex+off+n]
+	for i := range p {
+		p[i] ^= key[i&3]
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package netbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	buf := NewBuffer()
+	buf.Append([]byte{0x7f, 0x9f, 0x4d, 0x51, 0x58}) // "Hello" masked, RFC 6455 5.7
+	if err := buf.Mask(0, 5, key); err != nil {
+		t.Fatalf("buf.Mask error %v", err)
+	}
+	if got := buf.PeekAllAsByteSlice(); string(got) != "Hello" {
+		t.Errorf("unmasked bytes are %q, want %q", got, "Hello")
+	}
+
+	// views keep the bytes they saw
+	buf.AppendString("abcdef")
+	v := buf.PeekView(buf.ReadableBytes())
+	if err := buf.Mask(5, 6, key); err != nil {
+		t.Fatalf("buf.Mask error %v", err)
+	}
+	if string(v.Bytes()) != "Helloabcdef" {
+		t.Errorf("view bytes changed to %q by buf.Mask", v.Bytes())
+	}
+	v.Release()
+	if err := buf.Mask(5, 6, key); err != nil {
+		t.Fatalf("buf.Mask error %v", err)
+	}
+	if got := buf.PeekAllAsByteSlice(); !bytes.Equal(got, []byte("Helloabcdef")) {
+		t.Errorf("masking twice gives %q, want %q", got, "Helloabcdef")
+	}
+
+	for _, c := range []struct{ off, n int }{{-1, 1}, {0, -1}, {5, 7}, {12, 0}} {
+		if err := buf.Mask(c.off, c.n, key); err != ErrShortBuffer {
+			t.Errorf("buf.Mask(%d, %d) error %v, want %v", c.off, c.n, err, ErrShortBuffer)
+		}
+	}
+}
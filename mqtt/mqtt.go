@@ -0,0 +1,391 @@
+// Package mqtt decodes and encodes MQTT 3.1.1 and MQTT 5 control packets
+// from and to netbuffer.Buffers.
+//
+// A Codec decodes whole packets from the readable bytes of a Buffer,
+// returning netbuffer.ErrShortBuffer and leaving the buffer unchanged
+// until a packet is complete:
+//
+//	codec := mqtt.NewCodec(mqtt.Version5)
+//	for {
+//		p, err := codec.Decode(input)
+//		if err == netbuffer.ErrShortBuffer {
+//			break
+//		}
+//		...
+//		switch p := p.(type) {
+//		case *mqtt.Connect:
+//		...
+//	}
+//
+// The remaining length of a packet, and the variable byte integers of
+// MQTT 5 properties, are encoded as the unsigned varints of
+// Buffer.AppendUvarint, limited to four bytes; decoding rejects those not
+// encoded in the fewest bytes, as the specification requires. Encoded
+// packets get their fixed header prepended with Buffer.PrependUvarint.
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Protocol levels.
+const (
+	Version311 = 4 // MQTT 3.1.1
+	Version5   = 5 // MQTT 5
+)
+
+// maxVarint is the largest variable byte integer, of four bytes.
+const maxVarint = 268435455
+
+var (
+	// ErrMalformedPacket is returned by Decode for a packet which does
+	// not follow the protocol.
+	ErrMalformedPacket = errors.New("mqtt: malformed packet")
+	// ErrPacketTooLarge is returned by Decode for a packet longer than
+	// the limit of the codec.
+	ErrPacketTooLarge = errors.New("mqtt: packet too large")
+	// ErrUnsupportedVersion is returned by Decode for a CONNECT packet of
+	// a protocol level other than 4 and 5.
+	ErrUnsupportedVersion = errors.New("mqtt: unsupported protocol version")
+)
+
+// PacketType is the type of a control packet.
+type PacketType byte
+
+// Packet types.
+const (
+	CONNECT PacketType = iota + 1
+	CONNACK
+	PUBLISH
+	PUBACK
+	PUBREC
+	PUBREL
+	PUBCOMP
+	SUBSCRIBE
+	SUBACK
+	UNSUBSCRIBE
+	UNSUBACK
+	PINGREQ
+	PINGRESP
+	DISCONNECT
+	AUTH // MQTT 5 only
+)
+
+var packetTypeNames = [...]string{
+	"", "CONNECT", "CONNACK", "PUBLISH", "PUBACK", "PUBREC", "PUBREL", "PUBCOMP",
+	"SUBSCRIBE", "SUBACK", "UNSUBSCRIBE", "UNSUBACK", "PINGREQ", "PINGRESP", "DISCONNECT", "AUTH",
+}
+
+func (t PacketType) String() string {
+	if t > 0 && int(t) < len(packetTypeNames) {
+		return packetTypeNames[t]
+	}
+	return fmt.Sprintf("PacketType(%d)", byte(t))
+}
+
+// Packet is a control packet: *Connect, *Connack, *Publish, *PubResponse,
+// *Subscribe, *Suback, *Unsubscribe, *Unsuback, *Pingreq, *Pingresp,
+// *Disconnect or *Auth.
+type Packet interface {
+	Type() PacketType
+	// flags returns the low four bits of the first byte.
+	flags() byte
+	encode(w *writer, version byte)
+	decode(r *reader, flags, version byte)
+}
+
+// Codec decodes and encodes the packets of one connection.
+type Codec struct {
+	version       byte
+	maxPacketSize int
+}
+
+// NewCodec returns a codec for protocol level version, Version311 or
+// Version5, accepting packets of up to the protocol limit of 256 MiB.
+func NewCodec(version byte) *Codec {
+	return &Codec{version: version, maxPacketSize: 1 + 4 + maxVarint}
+}
+
+// Version returns the protocol level of the codec. Decoding a CONNECT
+// packet sets it to the level of the packet.
+func (c *Codec) Version() byte {
+	return c.version
+}
+
+// SetMaxPacketSize sets the longest packet accepted by Decode, in bytes,
+// fixed header included, as the Maximum Packet Size property of MQTT 5.
+func (c *Codec) SetMaxPacketSize(n int) {
+	c.maxPacketSize = n
+}
+
+// Decode removes a packet from the beginning of the readable bytes of b
+// and returns it. If they hold no whole packet, it returns
+// netbuffer.ErrShortBuffer. On error b is left unchanged.
+func (c *Codec) Decode(b *netbuffer.Buffer) (Packet, error) {
+	data := b.PeekAllAsByteSlice()
+	if len(data) < 2 {
+		return nil, netbuffer.ErrShortBuffer
+	}
+	remaining, n := uvarint(data[1:])
+	switch {
+	case n == 0 && len(data) < 1+4:
+		return nil, netbuffer.ErrShortBuffer
+	case n <= 0:
+		return nil, ErrMalformedPacket
+	}
+	size := 1 + n + int(remaining)
+	if size > c.maxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+	if len(data) < size {
+		return nil, netbuffer.ErrShortBuffer
+	}
+
+	p := newPacket(PacketType(data[0] >> 4))
+	if p == nil {
+		return nil, ErrMalformedPacket
+	}
+	flags := data[0] & 0x0f
+	if _, ok := p.(*Publish); !ok && flags != p.flags() {
+		return nil, ErrMalformedPacket
+	}
+	version := c.version
+	if connect, ok := p.(*Connect); ok {
+		v, err := connect.peekVersion(data[1+n : size])
+		if err != nil {
+			return nil, err
+		}
+		version = v
+	}
+	if version != Version5 && p.Type() == AUTH {
+		return nil, ErrMalformedPacket
+	}
+
+	r := &reader{data: data[1+n : size]}
+	p.decode(r, flags, version)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.off != len(r.data) {
+		return nil, ErrMalformedPacket
+	}
+	c.version = version
+	b.Retrieve(size)
+	return p, nil
+}
+
+func newPacket(t PacketType) Packet {
+	switch t {
+	case CONNECT:
+		return &Connect{}
+	case CONNACK:
+		return &Connack{}
+	case PUBLISH:
+		return &Publish{}
+	case PUBACK, PUBREC, PUBREL, PUBCOMP:
+		return &PubResponse{PacketType: t}
+	case SUBSCRIBE:
+		return &Subscribe{}
+	case SUBACK:
+		return &Suback{}
+	case UNSUBSCRIBE:
+		return &Unsubscribe{}
+	case UNSUBACK:
+		return &Unsuback{}
+	case PINGREQ:
+		return &Pingreq{}
+	case PINGRESP:
+		return &Pingresp{}
+	case DISCONNECT:
+		return &Disconnect{}
+	case AUTH:
+		return &Auth{}
+	}
+	return nil
+}
+
+// Encode appends p to b. If p cannot be encoded, such as a string longer
+// than 65535 bytes, b is left unchanged.
+func (c *Codec) Encode(b *netbuffer.Buffer, p Packet) error {
+	body := netbuffer.NewBuffer()
+	w := &writer{b: body}
+	p.encode(w, c.version)
+	if w.err != nil {
+		return w.err
+	}
+	if body.ReadableBytes() > maxVarint {
+		return fmt.Errorf("mqtt: %v packet of %d bytes", p.Type(), body.ReadableBytes())
+	}
+	body.PrependUvarint(uint64(body.ReadableBytes()))
+	if err := body.PrependUint8(byte(p.Type())<<4 | p.flags()); err != nil {
+		return err
+	}
+	b.Append(body.PeekAllAsByteSlice())
+	return nil
+}
+
+// reader reads the fields of a packet. The first error sticks, and makes
+// the next reads return zero values.
+type reader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data)-r.off < n {
+		r.err = ErrMalformedPacket
+		return nil
+	}
+	p := r.data[r.off : r.off+n]
+	r.off += n
+	return p
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = ErrMalformedPacket
+	}
+}
+
+func (r *reader) more() bool {
+	return r.err == nil && r.off < len(r.data)
+}
+
+func (r *reader) byte() byte {
+	if p := r.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if p := r.next(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if p := r.next(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *reader) varint() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := uvarint(r.data[r.off:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.off += n
+	return x
+}
+
+// uvarint parses a variable byte integer from the beginning of p as
+// binary.Uvarint does, and returns a count of byte < 0 for one longer
+// than four bytes or not of the fewest bytes, such as 0x80 0x00.
+func uvarint(p []byte) (uint32, int) {
+	x, n := binary.Uvarint(p)
+	if n > 4 || n > 1 && p[n-1] == 0 {
+		return 0, -1
+	}
+	return uint32(x), n
+}
+
+// binary reads two byte length prefixed binary data, copied.
+func (r *reader) binary() []byte {
+	p := r.next(int(r.uint16()))
+	if p == nil {
+		return nil
+	}
+	return append([]byte{}, p...)
+}
+
+// string reads a UTF-8 encoded string, which must be well-formed and
+// must not hold U+0000.
+func (r *reader) string() string {
+	p := r.next(int(r.uint16()))
+	if !utf8.Valid(p) {
+		r.fail()
+		return ""
+	}
+	for _, c := range p {
+		if c == 0 {
+			r.fail()
+			return ""
+		}
+	}
+	return string(p)
+}
+
+// rest reads the remaining bytes, copied.
+func (r *reader) rest() []byte {
+	return append([]byte{}, r.next(len(r.data)-r.off)...)
+}
+
+// writer appends the fields of a packet. The first error sticks.
+type writer struct {
+	b   *netbuffer.Buffer
+	err error
+}
+
+func (w *writer) byte(x byte) {
+	w.b.Append([]byte{x})
+}
+
+func (w *writer) uint16(x uint16) {
+	var p [2]byte
+	binary.BigEndian.PutUint16(p[:], x)
+	w.b.Append(p[:])
+}
+
+func (w *writer) uint32(x uint32) {
+	var p [4]byte
+	binary.BigEndian.PutUint32(p[:], x)
+	w.b.Append(p[:])
+}
+
+func (w *writer) varint(x uint32) {
+	if x > maxVarint {
+		w.fail(fmt.Errorf("mqtt: variable byte integer %d out of range", x))
+		return
+	}
+	w.b.AppendUvarint(uint64(x))
+}
+
+func (w *writer) binary(p []byte) {
+	if len(p) > 0xffff {
+		w.fail(fmt.Errorf("mqtt: binary data of %d bytes", len(p)))
+		return
+	}
+	w.uint16(uint16(len(p)))
+	w.b.Append(p)
+}
+
+func (w *writer) string(s string) {
+	if len(s) > 0xffff {
+		w.fail(fmt.Errorf("mqtt: string of %d bytes", len(s)))
+		return
+	}
+	w.uint16(uint16(len(s)))
+	w.b.AppendString(s)
+}
+
+func (w *writer) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
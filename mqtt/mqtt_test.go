@@ -0,0 +1,274 @@
+package mqtt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func uint16p(x uint16) *uint16 { return &x }
+func uint32p(x uint32) *uint32 { return &x }
+func bytep(x byte) *byte       { return &x }
+
+var packets311 = []Packet{
+	&Connect{CleanStart: true, KeepAlive: 60, ClientID: "client"},
+	&Connect{KeepAlive: 10, ClientID: "c", Username: "user", Password: []byte("secret"),
+		Will: &Will{QoS: 1, Retain: true, Topic: "will/topic", Payload: []byte("bye")}},
+	&Connack{SessionPresent: true},
+	&Publish{Topic: "a/b", Payload: []byte("hello")},
+	&Publish{Dup: true, QoS: 2, Retain: true, Topic: "a/b", PacketID: 7, Payload: []byte{}},
+	&PubResponse{PacketType: PUBACK, PacketID: 1},
+	&PubResponse{PacketType: PUBREC, PacketID: 2},
+	&PubResponse{PacketType: PUBREL, PacketID: 3},
+	&PubResponse{PacketType: PUBCOMP, PacketID: 4},
+	&Subscribe{PacketID: 5, Subscriptions: []Subscription{{Topic: "a/#", QoS: 1}, {Topic: "b/+", QoS: 2}}},
+	&Suback{PacketID: 5, ReasonCodes: []byte{1, 0x80}},
+	&Unsubscribe{PacketID: 6, Topics: []string{"a/#", "b/+"}},
+	&Unsuback{PacketID: 6},
+	&Pingreq{},
+	&Pingresp{},
+	&Disconnect{},
+}
+
+var packets5 = []Packet{
+	&Connect{CleanStart: true, KeepAlive: 60, ClientID: "client",
+		Properties: Properties{SessionExpiryInterval: uint32p(3600), ReceiveMaximum: uint16p(100),
+			User: []UserProperty{{"a", "1"}, {"a", "2"}}},
+		Will: &Will{QoS: 2, Topic: "will", Payload: []byte("bye"),
+			Properties: Properties{WillDelayInterval: uint32p(5), ContentType: "text/plain"}},
+		Password: []byte{}},
+	&Connack{ReasonCode: 0x87, Properties: Properties{
+		AssignedClientIdentifier: "auto-1", MaximumQoS: bytep(1), ServerKeepAlive: uint16p(30),
+		ReasonString: "not authorized", MaximumPacketSize: uint32p(1 << 20)}},
+	&Publish{QoS: 1, Topic: "t", PacketID: 9, Payload: []byte("x"), Properties: Properties{
+		PayloadFormatIndicator: bytep(1), MessageExpiryInterval: uint32p(10), TopicAlias: uint16p(3),
+		ResponseTopic: "reply", CorrelationData: []byte{1, 2}, SubscriptionIdentifiers: []uint32{1, 268435455}}},
+	&PubResponse{PacketType: PUBACK, PacketID: 1},
+	&PubResponse{PacketType: PUBREC, PacketID: 2, ReasonCode: 0x10},
+	&PubResponse{PacketType: PUBREL, PacketID: 3, ReasonCode: 0x92, Properties: Properties{ReasonString: "gone"}},
+	&PubResponse{PacketType: PUBCOMP, PacketID: 4},
+	&Subscribe{PacketID: 5, Properties: Properties{SubscriptionIdentifiers: []uint32{42}},
+		Subscriptions: []Subscription{{Topic: "a/#", QoS: 1, NoLocal: true, RetainAsPublished: true, RetainHandling: 2}}},
+	&Suback{PacketID: 5, ReasonCodes: []byte{1}},
+	&Unsubscribe{PacketID: 6, Topics: []string{"a/#"}},
+	&Unsuback{PacketID: 6, ReasonCodes: []byte{0, 0x11}},
+	&Pingreq{},
+	&Pingresp{},
+	&Disconnect{},
+	&Disconnect{ReasonCode: 0x04},
+	&Disconnect{Properties: Properties{ServerReference: "other"}},
+	&Auth{ReasonCode: 0x18, Properties: Properties{AuthenticationMethod: "SCRAM", AuthenticationData: []byte{0}}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		version byte
+		packets []Packet
+	}{{Version311, packets311}, {Version5, packets5}} {
+		enc := NewCodec(tc.version)
+		b := netbuffer.NewBuffer()
+		for _, p := range tc.packets {
+			if err := enc.Encode(b, p); err != nil {
+				t.Fatalf("version %d: Encode(%v): %v", tc.version, p.Type(), err)
+			}
+		}
+		// feed byte by byte, checking that incomplete packets are kept
+		data := b.PeekAllAsByteSlice()
+		dec := NewCodec(tc.version)
+		input := netbuffer.NewBuffer()
+		var got []Packet
+		for i := range data {
+			input.Append(data[i : i+1])
+			p, err := dec.Decode(input)
+			if err == netbuffer.ErrShortBuffer {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("version %d: Decode: %v", tc.version, err)
+			}
+			if input.ReadableBytes() != 0 {
+				t.Fatalf("version %d: %d bytes left after %v", tc.version, input.ReadableBytes(), p.Type())
+			}
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, tc.packets) {
+			for i := range got {
+				if i < len(tc.packets) && !reflect.DeepEqual(got[i], tc.packets[i]) {
+					t.Errorf("version %d: packet %d = %+v, want %+v", tc.version, i, got[i], tc.packets[i])
+				}
+			}
+			t.Fatalf("version %d: decoded %d packets, want %d", tc.version, len(got), len(tc.packets))
+		}
+	}
+}
+
+func TestEncodeBytes(t *testing.T) {
+	for _, tc := range []struct {
+		version byte
+		p       Packet
+		want    []byte
+	}{
+		{Version311, &Connect{CleanStart: true, KeepAlive: 60, ClientID: "a"},
+			[]byte{0x10, 13, 0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 60, 0, 1, 'a'}},
+		{Version5, &Connect{CleanStart: true, KeepAlive: 60, ClientID: "a"},
+			[]byte{0x10, 14, 0, 4, 'M', 'Q', 'T', 'T', 5, 0x02, 0, 60, 0, 0, 1, 'a'}},
+		{Version311, &PubResponse{PacketType: PUBREL, PacketID: 0x0102}, []byte{0x62, 2, 1, 2}},
+		{Version5, &PubResponse{PacketType: PUBACK, PacketID: 1, ReasonCode: 0x10}, []byte{0x40, 4, 0, 1, 0x10, 0}},
+		{Version311, &Subscribe{PacketID: 1, Subscriptions: []Subscription{{Topic: "t", QoS: 1}}},
+			[]byte{0x82, 6, 0, 1, 0, 1, 't', 1}},
+		{Version5, &Publish{Topic: "t", Properties: Properties{TopicAlias: uint16p(2)}},
+			[]byte{0x30, 7, 0, 1, 't', 3, 0x23, 0, 2}},
+		{Version311, &Pingreq{}, []byte{0xc0, 0}},
+		{Version5, &Disconnect{}, []byte{0xe0, 0}},
+	} {
+		b := netbuffer.NewBuffer()
+		if err := NewCodec(tc.version).Encode(b, tc.p); err != nil {
+			t.Fatalf("Encode(%v): %v", tc.p.Type(), err)
+		}
+		if got := b.PeekAllAsByteSlice(); !bytes.Equal(got, tc.want) {
+			t.Errorf("version %d: Encode(%v) = % x, want % x", tc.version, tc.p.Type(), got, tc.want)
+		}
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	c := NewCodec(Version311)
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152} {
+		b := netbuffer.NewBuffer()
+		p := &Publish{Topic: "t", Payload: make([]byte, n)}
+		if err := c.Encode(b, p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Decode(b)
+		if err != nil {
+			t.Fatalf("payload of %d bytes: %v", n, err)
+		}
+		if len(got.(*Publish).Payload) != n {
+			t.Fatalf("payload of %d bytes decoded as %d", n, len(got.(*Publish).Payload))
+		}
+	}
+}
+
+func TestDecodeVersionFromConnect(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	c5 := NewCodec(Version5)
+	if err := c5.Encode(b, &Connect{ClientID: "a", Properties: Properties{ReceiveMaximum: uint16p(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c5.Encode(b, &Disconnect{ReasonCode: 0x8e}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCodec(Version311)
+	p, err := c.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version() != Version5 || *p.(*Connect).Properties.ReceiveMaximum != 1 {
+		t.Fatalf("version %d, packet %+v", c.Version(), p)
+	}
+	p, err = c.Decode(b)
+	if err != nil || p.(*Disconnect).ReasonCode != 0x8e {
+		t.Fatalf("Decode = %+v, %v", p, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version byte
+		data    []byte
+		err     error
+	}{
+		{"empty", Version311, nil, netbuffer.ErrShortBuffer},
+		{"short remaining length", Version311, []byte{0x30, 0x80, 0x80}, netbuffer.ErrShortBuffer},
+		{"short body", Version311, []byte{0x30, 5, 0, 1, 't'}, netbuffer.ErrShortBuffer},
+		{"remaining length of 5 bytes", Version311, []byte{0x30, 0x80, 0x80, 0x80, 0x80, 1}, ErrMalformedPacket},
+		{"remaining length not of the fewest bytes", Version311, []byte{0xc0, 0x80, 0x00}, ErrMalformedPacket},
+		{"type 0", Version311, []byte{0x00, 0}, ErrMalformedPacket},
+		{"AUTH in 3.1.1", Version311, []byte{0xf0, 0}, ErrMalformedPacket},
+		{"SUBSCRIBE flags", Version311, []byte{0x80, 6, 0, 1, 0, 1, 't', 1}, ErrMalformedPacket},
+		{"PUBREL flags", Version311, []byte{0x60, 2, 0, 1}, ErrMalformedPacket},
+		{"PINGREQ flags", Version311, []byte{0xc1, 0}, ErrMalformedPacket},
+		{"PUBLISH QoS 3", Version311, []byte{0x36, 5, 0, 1, 't', 0, 1}, ErrMalformedPacket},
+		{"PUBLISH packet ID 0", Version311, []byte{0x32, 5, 0, 1, 't', 0, 0}, ErrMalformedPacket},
+		{"trailing bytes", Version311, []byte{0x40, 3, 0, 1, 0}, ErrMalformedPacket},
+		{"NUL in string", Version311, []byte{0x30, 3, 0, 1, 0}, ErrMalformedPacket},
+		{"invalid UTF-8", Version311, []byte{0x30, 3, 0, 1, 0xff}, ErrMalformedPacket},
+		{"empty SUBSCRIBE", Version311, []byte{0x82, 2, 0, 1}, ErrMalformedPacket},
+		{"SUBSCRIBE reserved options", Version311, []byte{0x82, 6, 0, 1, 0, 1, 't', 0x04}, ErrMalformedPacket},
+		{"CONNECT reserved flag", Version311,
+			[]byte{0x10, 12, 0, 4, 'M', 'Q', 'T', 'T', 4, 0x01, 0, 60, 0, 0}, ErrMalformedPacket},
+		{"CONNECT level 3", Version311,
+			[]byte{0x10, 12, 0, 4, 'M', 'Q', 'T', 'T', 3, 0x02, 0, 60, 0, 0}, ErrUnsupportedVersion},
+		{"CONNECT MQIsdp", Version311,
+			[]byte{0x10, 14, 0, 6, 'M', 'Q', 'I', 's', 'd', 'p', 3, 0x02, 0, 60, 0, 0}, ErrUnsupportedVersion},
+		{"duplicate property", Version5, []byte{0x30, 9, 0, 1, 't', 6, 0x23, 0, 1, 0x23, 0, 1}, ErrMalformedPacket},
+		{"unknown property", Version5, []byte{0x30, 5, 0, 1, 't', 1, 0x7f}, ErrMalformedPacket},
+		{"short property", Version5, []byte{0x30, 6, 0, 1, 't', 2, 0x23, 0}, ErrMalformedPacket},
+		{"properties past end", Version5, []byte{0x30, 5, 0, 1, 't', 9, 0}, ErrMalformedPacket},
+		{"property length not of the fewest bytes", Version5, []byte{0x30, 5, 0, 1, 't', 0x80, 0x00}, ErrMalformedPacket},
+		{"subscription ID not of the fewest bytes", Version5, []byte{0x30, 7, 0, 1, 't', 3, 0x0b, 0x81, 0x00}, ErrMalformedPacket},
+	} {
+		b := netbuffer.NewBuffer()
+		b.Append(tc.data)
+		if _, err := NewCodec(tc.version).Decode(b); err != tc.err {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		if !bytes.Equal(b.PeekAllAsByteSlice(), tc.data) {
+			t.Errorf("%s: buffer changed", tc.name)
+		}
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	c := NewCodec(Version311)
+	c.SetMaxPacketSize(10)
+	b := netbuffer.NewBuffer()
+	if err := c.Encode(b, &Publish{Topic: "t", Payload: make([]byte, 6)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Decode(b); err != ErrPacketTooLarge {
+		t.Fatalf("Decode of 11 bytes: %v", err)
+	}
+	b.RetrieveAll()
+	if err := c.Encode(b, &Publish{Topic: "t", Payload: make([]byte, 5)}); err != nil {
+		t.Fatal(err)
+	}
+	// the size is checked from the fixed header, before the body arrives
+	c.SetMaxPacketSize(9)
+	if _, err := c.Decode(b); err != ErrPacketTooLarge {
+		t.Fatalf("Decode of 10 bytes with limit 9: %v", err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		version byte
+		p       Packet
+	}{
+		{Version311, &Auth{}},
+		{Version311, &Publish{QoS: 3, Topic: "t"}},
+		{Version311, &Connect{Will: &Will{QoS: 3}}},
+		{Version311, &Publish{Topic: string(make([]byte, 65536))}},
+		{Version5, &Publish{Topic: "t", Properties: Properties{SubscriptionIdentifiers: []uint32{1 << 28}}}},
+	} {
+		b := netbuffer.NewBuffer()
+		if err := NewCodec(tc.version).Encode(b, tc.p); err == nil {
+			t.Errorf("Encode(%+v) succeeded", tc.p)
+		}
+		if b.ReadableBytes() != 0 {
+			t.Errorf("Encode(%+v) appended %d bytes", tc.p, b.ReadableBytes())
+		}
+	}
+}
+
+func TestPacketTypeString(t *testing.T) {
+	if s := PUBREL.String(); s != "PUBREL" {
+		t.Fatalf("PUBREL.String() = %q", s)
+	}
+	if s := PacketType(0).String(); s != "PacketType(0)" {
+		t.Fatalf("PacketType(0).String() = %q", s)
+	}
+}
@@ -0,0 +1,512 @@
+package mqtt
+
+import "fmt"
+
+// Connect is a CONNECT packet. Its protocol level is the version of the
+// codec encoding it.
+type Connect struct {
+	CleanStart bool // Clean Session in MQTT 3.1.1
+	KeepAlive  uint16
+	Properties Properties
+	ClientID   string
+	Will       *Will
+	Username   string // absent if empty
+	Password   []byte // absent if nil
+}
+
+// Will is the will message of a CONNECT packet.
+type Will struct {
+	QoS        byte
+	Retain     bool
+	Properties Properties
+	Topic      string
+	Payload    []byte
+}
+
+// Type returns CONNECT.
+func (p *Connect) Type() PacketType { return CONNECT }
+
+func (p *Connect) flags() byte { return 0 }
+
+// peekVersion returns the protocol level of the CONNECT packet data.
+func (p *Connect) peekVersion(data []byte) (byte, error) {
+	r := &reader{data: data}
+	if r.string() != "MQTT" {
+		if r.err != nil {
+			return 0, ErrMalformedPacket
+		}
+		return 0, ErrUnsupportedVersion
+	}
+	switch v := r.byte(); {
+	case r.err != nil:
+		return 0, ErrMalformedPacket
+	case v != Version311 && v != Version5:
+		return 0, ErrUnsupportedVersion
+	default:
+		return v, nil
+	}
+}
+
+func (p *Connect) encode(w *writer, version byte) {
+	w.string("MQTT")
+	w.byte(version)
+	var flags byte
+	if p.CleanStart {
+		flags |= 0x02
+	}
+	if p.Will != nil {
+		if p.Will.QoS > 2 {
+			w.fail(fmt.Errorf("mqtt: will QoS %d", p.Will.QoS))
+			return
+		}
+		flags |= 0x04 | p.Will.QoS<<3
+		if p.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if p.Password != nil {
+		flags |= 0x40
+	}
+	if p.Username != "" {
+		flags |= 0x80
+	}
+	w.byte(flags)
+	w.uint16(p.KeepAlive)
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+	w.string(p.ClientID)
+	if p.Will != nil {
+		if version == Version5 {
+			p.Will.Properties.encode(w)
+		}
+		w.string(p.Will.Topic)
+		w.binary(p.Will.Payload)
+	}
+	if p.Username != "" {
+		w.string(p.Username)
+	}
+	if p.Password != nil {
+		w.binary(p.Password)
+	}
+}
+
+func (p *Connect) decode(r *reader, _, version byte) {
+	r.string()
+	r.byte()
+	flags := r.byte()
+	willQoS := flags >> 3 & 0x03
+	if flags&0x01 != 0 || willQoS > 2 || flags&0x04 == 0 && flags&0x38 != 0 {
+		r.fail()
+		return
+	}
+	p.CleanStart = flags&0x02 != 0
+	p.KeepAlive = r.uint16()
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+	p.ClientID = r.string()
+	if flags&0x04 != 0 {
+		p.Will = &Will{QoS: willQoS, Retain: flags&0x20 != 0}
+		if version == Version5 {
+			p.Will.Properties.decode(r)
+		}
+		p.Will.Topic = r.string()
+		p.Will.Payload = r.binary()
+	}
+	if flags&0x80 != 0 {
+		p.Username = r.string()
+	}
+	if flags&0x40 != 0 {
+		p.Password = r.binary()
+	}
+}
+
+// Connack is a CONNACK packet. ReasonCode is the return code in MQTT 3.1.1.
+type Connack struct {
+	SessionPresent bool
+	ReasonCode     byte
+	Properties     Properties
+}
+
+// Type returns CONNACK.
+func (p *Connack) Type() PacketType { return CONNACK }
+
+func (p *Connack) flags() byte { return 0 }
+
+func (p *Connack) encode(w *writer, version byte) {
+	if p.SessionPresent {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+	w.byte(p.ReasonCode)
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+}
+
+func (p *Connack) decode(r *reader, _, version byte) {
+	flags := r.byte()
+	if flags&^0x01 != 0 {
+		r.fail()
+		return
+	}
+	p.SessionPresent = flags != 0
+	p.ReasonCode = r.byte()
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+}
+
+// Publish is a PUBLISH packet. PacketID is absent at QoS 0.
+type Publish struct {
+	Dup        bool
+	QoS        byte
+	Retain     bool
+	Topic      string
+	PacketID   uint16
+	Properties Properties
+	Payload    []byte
+}
+
+// Type returns PUBLISH.
+func (p *Publish) Type() PacketType { return PUBLISH }
+
+func (p *Publish) flags() byte {
+	flags := p.QoS << 1
+	if p.Dup {
+		flags |= 0x08
+	}
+	if p.Retain {
+		flags |= 0x01
+	}
+	return flags
+}
+
+func (p *Publish) encode(w *writer, version byte) {
+	if p.QoS > 2 {
+		w.fail(fmt.Errorf("mqtt: PUBLISH QoS %d", p.QoS))
+		return
+	}
+	w.string(p.Topic)
+	if p.QoS > 0 {
+		w.uint16(p.PacketID)
+	}
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+	w.b.Append(p.Payload)
+}
+
+func (p *Publish) decode(r *reader, flags, version byte) {
+	p.Dup = flags&0x08 != 0
+	p.QoS = flags >> 1 & 0x03
+	p.Retain = flags&0x01 != 0
+	if p.QoS > 2 || p.QoS == 0 && p.Dup {
+		r.fail()
+		return
+	}
+	p.Topic = r.string()
+	if p.QoS > 0 {
+		if p.PacketID = r.uint16(); p.PacketID == 0 {
+			r.fail()
+		}
+	}
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+	p.Payload = r.rest()
+}
+
+// PubResponse is a PUBACK, PUBREC, PUBREL or PUBCOMP packet, as told by
+// PacketType. ReasonCode and Properties are MQTT 5 only.
+type PubResponse struct {
+	PacketType PacketType
+	PacketID   uint16
+	ReasonCode byte
+	Properties Properties
+}
+
+// Type returns the PacketType of p.
+func (p *PubResponse) Type() PacketType { return p.PacketType }
+
+func (p *PubResponse) flags() byte {
+	if p.PacketType == PUBREL {
+		return 0x02
+	}
+	return 0
+}
+
+func (p *PubResponse) encode(w *writer, version byte) {
+	w.uint16(p.PacketID)
+	if version == Version5 {
+		encodeReason(w, p.ReasonCode, &p.Properties)
+	}
+}
+
+func (p *PubResponse) decode(r *reader, _, version byte) {
+	p.PacketID = r.uint16()
+	if version == Version5 {
+		p.ReasonCode = decodeReason(r, &p.Properties)
+	}
+}
+
+// encodeReason appends a reason code and properties, leaving out both
+// for Success without properties, as PUBACK, DISCONNECT and others do.
+func encodeReason(w *writer, code byte, props *Properties) {
+	if code == 0 && props.empty() {
+		return
+	}
+	w.byte(code)
+	props.encode(w)
+}
+
+// decodeReason reads an optional reason code and optional properties.
+func decodeReason(r *reader, props *Properties) byte {
+	if !r.more() {
+		return 0
+	}
+	code := r.byte()
+	if r.more() {
+		props.decode(r)
+	}
+	return code
+}
+
+// Subscription is a topic filter of a SUBSCRIBE packet with its options.
+// NoLocal, RetainAsPublished and RetainHandling are MQTT 5 only.
+type Subscription struct {
+	Topic             string
+	QoS               byte
+	NoLocal           bool
+	RetainAsPublished bool
+	RetainHandling    byte
+}
+
+// Subscribe is a SUBSCRIBE packet.
+type Subscribe struct {
+	PacketID      uint16
+	Properties    Properties
+	Subscriptions []Subscription
+}
+
+// Type returns SUBSCRIBE.
+func (p *Subscribe) Type() PacketType { return SUBSCRIBE }
+
+func (p *Subscribe) flags() byte { return 0x02 }
+
+func (p *Subscribe) encode(w *writer, version byte) {
+	w.uint16(p.PacketID)
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+	for _, s := range p.Subscriptions {
+		w.string(s.Topic)
+		options := s.QoS
+		if version == Version5 {
+			if s.NoLocal {
+				options |= 0x04
+			}
+			if s.RetainAsPublished {
+				options |= 0x08
+			}
+			options |= s.RetainHandling << 4
+		}
+		w.byte(options)
+	}
+}
+
+func (p *Subscribe) decode(r *reader, _, version byte) {
+	if p.PacketID = r.uint16(); p.PacketID == 0 {
+		r.fail()
+	}
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+	for r.more() {
+		s := Subscription{Topic: r.string()}
+		options := r.byte()
+		reserved := byte(0xfc)
+		if version == Version5 {
+			reserved = 0xc0
+		}
+		s.QoS = options & 0x03
+		s.NoLocal = options&0x04 != 0
+		s.RetainAsPublished = options&0x08 != 0
+		s.RetainHandling = options >> 4 & 0x03
+		if options&reserved != 0 || s.QoS > 2 || s.RetainHandling > 2 {
+			r.fail()
+		}
+		p.Subscriptions = append(p.Subscriptions, s)
+	}
+	if len(p.Subscriptions) == 0 {
+		r.fail()
+	}
+}
+
+// Suback is a SUBACK packet. ReasonCodes are the return codes in MQTT
+// 3.1.1.
+type Suback struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []byte
+}
+
+// Type returns SUBACK.
+func (p *Suback) Type() PacketType { return SUBACK }
+
+func (p *Suback) flags() byte { return 0 }
+
+func (p *Suback) encode(w *writer, version byte) {
+	w.uint16(p.PacketID)
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+	w.b.Append(p.ReasonCodes)
+}
+
+func (p *Suback) decode(r *reader, _, version byte) {
+	p.PacketID = r.uint16()
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+	p.ReasonCodes = r.rest()
+}
+
+// Unsubscribe is an UNSUBSCRIBE packet.
+type Unsubscribe struct {
+	PacketID   uint16
+	Properties Properties
+	Topics     []string
+}
+
+// Type returns UNSUBSCRIBE.
+func (p *Unsubscribe) Type() PacketType { return UNSUBSCRIBE }
+
+func (p *Unsubscribe) flags() byte { return 0x02 }
+
+func (p *Unsubscribe) encode(w *writer, version byte) {
+	w.uint16(p.PacketID)
+	if version == Version5 {
+		p.Properties.encode(w)
+	}
+	for _, topic := range p.Topics {
+		w.string(topic)
+	}
+}
+
+func (p *Unsubscribe) decode(r *reader, _, version byte) {
+	if p.PacketID = r.uint16(); p.PacketID == 0 {
+		r.fail()
+	}
+	if version == Version5 {
+		p.Properties.decode(r)
+	}
+	for r.more() {
+		p.Topics = append(p.Topics, r.string())
+	}
+	if len(p.Topics) == 0 {
+		r.fail()
+	}
+}
+
+// Unsuback is an UNSUBACK packet. Properties and ReasonCodes are MQTT 5
+// only.
+type Unsuback struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []byte
+}
+
+// Type returns UNSUBACK.
+func (p *Unsuback) Type() PacketType { return UNSUBACK }
+
+func (p *Unsuback) flags() byte { return 0 }
+
+func (p *Unsuback) encode(w *writer, version byte) {
+	w.uint16(p.PacketID)
+	if version == Version5 {
+		p.Properties.encode(w)
+		w.b.Append(p.ReasonCodes)
+	}
+}
+
+func (p *Unsuback) decode(r *reader, _, version byte) {
+	p.PacketID = r.uint16()
+	if version == Version5 {
+		p.Properties.decode(r)
+		p.ReasonCodes = r.rest()
+	}
+}
+
+// Pingreq is a PINGREQ packet.
+type Pingreq struct{}
+
+// Type returns PINGREQ.
+func (p *Pingreq) Type() PacketType { return PINGREQ }
+
+func (p *Pingreq) flags() byte { return 0 }
+
+func (p *Pingreq) encode(w *writer, version byte) {}
+
+func (p *Pingreq) decode(r *reader, _, version byte) {}
+
+// Pingresp is a PINGRESP packet.
+type Pingresp struct{}
+
+// Type returns PINGRESP.
+func (p *Pingresp) Type() PacketType { return PINGRESP }
+
+func (p *Pingresp) flags() byte { return 0 }
+
+func (p *Pingresp) encode(w *writer, version byte) {}
+
+func (p *Pingresp) decode(r *reader, _, version byte) {}
+
+// Disconnect is a DISCONNECT packet. ReasonCode and Properties are MQTT 5
+// only.
+type Disconnect struct {
+	ReasonCode byte
+	Properties Properties
+}
+
+// Type returns DISCONNECT.
+func (p *Disconnect) Type() PacketType { return DISCONNECT }
+
+func (p *Disconnect) flags() byte { return 0 }
+
+func (p *Disconnect) encode(w *writer, version byte) {
+	if version == Version5 {
+		encodeReason(w, p.ReasonCode, &p.Properties)
+	}
+}
+
+func (p *Disconnect) decode(r *reader, _, version byte) {
+	if version == Version5 {
+		p.ReasonCode = decodeReason(r, &p.Properties)
+	}
+}
+
+// Auth is an AUTH packet, of MQTT 5.
+type Auth struct {
+	ReasonCode byte
+	Properties Properties
+}
+
+// Type returns AUTH.
+func (p *Auth) Type() PacketType { return AUTH }
+
+func (p *Auth) flags() byte { return 0 }
+
+func (p *Auth) encode(w *writer, version byte) {
+	if version != Version5 {
+		w.fail(fmt.Errorf("mqtt: AUTH packet in MQTT 3.1.1"))
+		return
+	}
+	encodeReason(w, p.ReasonCode, &p.Properties)
+}
+
+func (p *Auth) decode(r *reader, _, version byte) {
+	p.ReasonCode = decodeReason(r, &p.Properties)
+}
@@ -0,0 +1,274 @@
+package mqtt
+
+import (
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Property identifiers of MQTT 5, section 2.2.2.2.
+const (
+	propPayloadFormatIndicator          = 0x01
+	propMessageExpiryInterval           = 0x02
+	propContentType                     = 0x03
+	propResponseTopic                   = 0x08
+	propCorrelationData                 = 0x09
+	propSubscriptionIdentifier          = 0x0b
+	propSessionExpiryInterval           = 0x11
+	propAssignedClientIdentifier        = 0x12
+	propServerKeepAlive                 = 0x13
+	propAuthenticationMethod            = 0x15
+	propAuthenticationData              = 0x16
+	propRequestProblemInformation       = 0x17
+	propWillDelayInterval               = 0x18
+	propRequestResponseInformation      = 0x19
+	propResponseInformation             = 0x1a
+	propServerReference                 = 0x1c
+	propReasonString                    = 0x1f
+	propReceiveMaximum                  = 0x21
+	propTopicAliasMaximum               = 0x22
+	propTopicAlias                      = 0x23
+	propMaximumQoS                      = 0x24
+	propRetainAvailable                 = 0x25
+	propUserProperty                    = 0x26
+	propMaximumPacketSize               = 0x27
+	propWildcardSubscriptionAvailable   = 0x28
+	propSubscriptionIdentifierAvailable = 0x29
+	propSharedSubscriptionAvailable     = 0x2a
+)
+
+// UserProperty is a name and value pair of a User Property.
+type UserProperty struct {
+	Name, Value string
+}
+
+// Properties are the properties of an MQTT 5 packet. Nil integer fields,
+// empty strings and nil binary data are absent. Properties are not
+// checked against the type of the packet carrying them, and are not
+// encoded for MQTT 3.1.1.
+type Properties struct {
+	PayloadFormatIndicator          *byte
+	MessageExpiryInterval           *uint32
+	ContentType                     string
+	ResponseTopic                   string
+	CorrelationData                 []byte
+	SubscriptionIdentifiers         []uint32 // one in SUBSCRIBE, any in PUBLISH
+	SessionExpiryInterval           *uint32
+	AssignedClientIdentifier        string
+	ServerKeepAlive                 *uint16
+	AuthenticationMethod            string
+	AuthenticationData              []byte
+	RequestProblemInformation       *byte
+	WillDelayInterval               *uint32
+	RequestResponseInformation      *byte
+	ResponseInformation             string
+	ServerReference                 string
+	ReasonString                    string
+	ReceiveMaximum                  *uint16
+	TopicAliasMaximum               *uint16
+	TopicAlias                      *uint16
+	MaximumQoS                      *byte
+	RetainAvailable                 *byte
+	User                            []UserProperty
+	MaximumPacketSize               *uint32
+	WildcardSubscriptionAvailable   *byte
+	SubscriptionIdentifierAvailable *byte
+	SharedSubscriptionAvailable     *byte
+}
+
+// encode appends the properties, preceded by their length.
+func (p *Properties) encode(w *writer) {
+	props := &writer{b: netbuffer.NewBuffer()}
+	p.encodeFields(props)
+	if props.err != nil {
+		w.fail(props.err)
+		return
+	}
+	w.varint(uint32(props.b.ReadableBytes()))
+	w.b.Append(props.b.PeekAllAsByteSlice())
+}
+
+// empty reports whether no property is set, so that packets may leave
+// out the property length.
+func (p *Properties) empty() bool {
+	props := &writer{b: netbuffer.NewBuffer()}
+	p.encodeFields(props)
+	return props.err == nil && props.b.ReadableBytes() == 0
+}
+
+func (p *Properties) encodeFields(w *writer) {
+	putByte := func(id byte, v *byte) {
+		if v != nil {
+			w.byte(id)
+			w.byte(*v)
+		}
+	}
+	putUint16 := func(id byte, v *uint16) {
+		if v != nil {
+			w.byte(id)
+			w.uint16(*v)
+		}
+	}
+	putUint32 := func(id byte, v *uint32) {
+		if v != nil {
+			w.byte(id)
+			w.uint32(*v)
+		}
+	}
+	putString := func(id byte, v string) {
+		if v != "" {
+			w.byte(id)
+			w.string(v)
+		}
+	}
+	putBinary := func(id byte, v []byte) {
+		if v != nil {
+			w.byte(id)
+			w.binary(v)
+		}
+	}
+
+	putByte(propPayloadFormatIndicator, p.PayloadFormatIndicator)
+	putUint32(propMessageExpiryInterval, p.MessageExpiryInterval)
+	putString(propContentType, p.ContentType)
+	putString(propResponseTopic, p.ResponseTopic)
+	putBinary(propCorrelationData, p.CorrelationData)
+	for _, id := range p.SubscriptionIdentifiers {
+		w.byte(propSubscriptionIdentifier)
+		w.varint(id)
+	}
+	putUint32(propSessionExpiryInterval, p.SessionExpiryInterval)
+	putString(propAssignedClientIdentifier, p.AssignedClientIdentifier)
+	putUint16(propServerKeepAlive, p.ServerKeepAlive)
+	putString(propAuthenticationMethod, p.AuthenticationMethod)
+	putBinary(propAuthenticationData, p.AuthenticationData)
+	putByte(propRequestProblemInformation, p.RequestProblemInformation)
+	putUint32(propWillDelayInterval, p.WillDelayInterval)
+	putByte(propRequestResponseInformation, p.RequestResponseInformation)
+	putString(propResponseInformation, p.ResponseInformation)
+	putString(propServerReference, p.ServerReference)
+	putString(propReasonString, p.ReasonString)
+	putUint16(propReceiveMaximum, p.ReceiveMaximum)
+	putUint16(propTopicAliasMaximum, p.TopicAliasMaximum)
+	putUint16(propTopicAlias, p.TopicAlias)
+	putByte(propMaximumQoS, p.MaximumQoS)
+	putByte(propRetainAvailable, p.RetainAvailable)
+	for _, u := range p.User {
+		w.byte(propUserProperty)
+		w.string(u.Name)
+		w.string(u.Value)
+	}
+	putUint32(propMaximumPacketSize, p.MaximumPacketSize)
+	putByte(propWildcardSubscriptionAvailable, p.WildcardSubscriptionAvailable)
+	putByte(propSubscriptionIdentifierAvailable, p.SubscriptionIdentifierAvailable)
+	putByte(propSharedSubscriptionAvailable, p.SharedSubscriptionAvailable)
+}
+
+// decode reads the properties, preceded by their length. A property other
+// than a Subscription Identifier or a User Property may appear only once.
+func (p *Properties) decode(r *reader) {
+	n := int(r.varint())
+	data := r.next(n)
+	if r.err != nil {
+		return
+	}
+	props := &reader{data: data}
+	var seen [propSharedSubscriptionAvailable + 1]bool
+	for props.more() {
+		id := props.byte()
+		if int(id) >= len(seen) || seen[id] {
+			r.fail()
+			return
+		}
+		if id != propSubscriptionIdentifier && id != propUserProperty {
+			seen[id] = true
+		}
+		if !p.decodeField(props, id) {
+			r.fail()
+			return
+		}
+	}
+	if props.err != nil {
+		r.fail()
+	}
+}
+
+// decodeField reads the value of property id, and reports whether id is
+// known.
+func (p *Properties) decodeField(r *reader, id byte) bool {
+	getByte := func() *byte {
+		v := r.byte()
+		return &v
+	}
+	getUint16 := func() *uint16 {
+		v := r.uint16()
+		return &v
+	}
+	getUint32 := func() *uint32 {
+		v := r.uint32()
+		return &v
+	}
+
+	switch id {
+	case propPayloadFormatIndicator:
+		p.PayloadFormatIndicator = getByte()
+	case propMessageExpiryInterval:
+		p.MessageExpiryInterval = getUint32()
+	case propContentType:
+		p.ContentType = r.string()
+	case propResponseTopic:
+		p.ResponseTopic = r.string()
+	case propCorrelationData:
+		p.CorrelationData = r.binary()
+	case propSubscriptionIdentifier:
+		v := r.varint()
+		if v == 0 {
+			r.fail()
+		}
+		p.SubscriptionIdentifiers = append(p.SubscriptionIdentifiers, v)
+	case propSessionExpiryInterval:
+		p.SessionExpiryInterval = getUint32()
+	case propAssignedClientIdentifier:
+		p.AssignedClientIdentifier = r.string()
+	case propServerKeepAlive:
+		p.ServerKeepAlive = getUint16()
+	case propAuthenticationMethod:
+		p.AuthenticationMethod = r.string()
+	case propAuthenticationData:
+		p.AuthenticationData = r.binary()
+	case propRequestProblemInformation:
+		p.RequestProblemInformation = getByte()
+	case propWillDelayInterval:
+		p.WillDelayInterval = getUint32()
+	case propRequestResponseInformation:
+		p.RequestResponseInformation = getByte()
+	case propResponseInformation:
+		p.ResponseInformation = r.string()
+	case propServerReference:
+		p.ServerReference = r.string()
+	case propReasonString:
+		p.ReasonString = r.string()
+	case propReceiveMaximum:
+		p.ReceiveMaximum = getUint16()
+	case propTopicAliasMaximum:
+		p.TopicAliasMaximum = getUint16()
+	case propTopicAlias:
+		p.TopicAlias = getUint16()
+	case propMaximumQoS:
+		p.MaximumQoS = getByte()
+	case propRetainAvailable:
+		p.RetainAvailable = getByte()
+	case propUserProperty:
+		name := r.string()
+		p.User = append(p.User, UserProperty{Name: name, Value: r.string()})
+	case propMaximumPacketSize:
+		p.MaximumPacketSize = getUint32()
+	case propWildcardSubscriptionAvailable:
+		p.WildcardSubscriptionAvailable = getByte()
+	case propSubscriptionIdentifierAvailable:
+		p.SubscriptionIdentifierAvailable = getByte()
+	case propSharedSubscriptionAvailable:
+		p.SharedSubscriptionAvailable = getByte()
+	default:
+		return false
+	}
+	return true
+}
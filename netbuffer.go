@@ -11,10 +11,19 @@ const (
 )
 
 // Buffer wraps a buffer for net data.
+//
+// 8 bytes are kept before the readable bytes for the Prepend functions.
+// Prepending more moves the readable bytes, as appending past the
+// writable bytes does, so slices returned by PeekAsByteSlice before are
+// no longer the readable bytes.
 type Buffer struct {
 	buf         []byte
 	readerIndex int
 	writerIndex int
+	pin         *pin // shared with Views of buf, nil if none was taken
+	gen         uint64
+	aliases     []alias
+	tap         Tap
 }
 
 // NewBuffer returns a buffer with default length.
@@ -55,9 +64,19 @@ func (b *Buffer) WritableByteSlice() []byte {
 
 // Append adds data to this buffer.
 func (b *Buffer) Append(data []byte) {
+	if debug {
+		b.CheckAlias(data)
+	}
 	b.appendWithLen(data, len(data))
 }
 
+// AppendString adds the bytes of s to this buffer.
+func (b *Buffer) AppendString(s string) {
+	b.ensureWritableBytes(len(s))
+	copy(b.buf[b.writerIndex:], s)
+	b.HasWritten(len(s))
+}
+
 // appendWithLen adds length byte in data to this buffer.
 func (b *Buffer) appendWithLen(data []byte, length int) {
 	b.ensureWritableBytes(length)
@@ -65,6 +84,12 @@ func (b *Buffer) appendWithLen(data []byte, length int) {
 	b.HasWritten(length)
 }
 
+// EnsureWritableBytes makes room for length bytes, so that appending them
+// does not allocate memory.
+func (b *Buffer) EnsureWritableBytes(length int) {
+	b.ensureWritableBytes(length)
+}
+
 func (b *Buffer) ensureWritableBytes(length int) {
 	if b.WritableBytes() < length {
 		b.makeSpace(length)
@@ -74,6 +99,9 @@ func (b *Buffer) ensureWritableBytes(length int) {
 // HasWritten add length of the content of buffer when necessary
 func (b *Buffer) HasWritten(length int) {
 	b.writerIndex += length
+	if b.tap != nil {
+		b.tap.Appended(b.buf[b.writerIndex-length : b.writerIndex])
+	}
 }
 
 // AppendInt64 appends a int64 to this buffer.
@@ -176,20 +204,65 @@ func (b *Buffer) prependInteger(x interface{}) error {
 
 func (b *Buffer) prepend(data []byte) {
 	length := len(data)
+	b.ensurePrependableBytes(length)
+	b.unshare()
 	b.readerIndex -= length
 	copy(b.buf[b.readerIndex:b.readerIndex+length], data)
+	if debug {
+		b.mustValidate()
+	}
+}
+
+// ensurePrependableBytes moves the readable bytes towards the end of buf
+// when less than length bytes can be prepended.
+func (b *Buffer) ensurePrependableBytes(length int) {
+	if b.prependableBytes() >= length {
+		return
+	}
+	if debug {
+		b.gen++
+	}
+	readable := b.ReadableBytes()
+	if b.shared() || b.WritableBytes()+b.prependableBytes() < length {
+		buf := make([]byte, length+readable+b.WritableBytes())
+		copy(buf[length:], b.buf[b.readerIndex:b.writerIndex])
+		b.buf = buf
+		b.pin = nil
+	} else {
+		copy(b.buf[length:length+readable], b.buf[b.readerIndex:b.writerIndex])
+	}
+	b.readerIndex = length
+	b.writerIndex = length + readable
 }
 
 // Retrieve removes length readable bytes.
 func (b *Buffer) Retrieve(length int) {
 	if length < b.ReadableBytes() {
+		if b.tap != nil {
+			b.tap.Retrieved(b.buf[b.readerIndex : b.readerIndex+length])
+		}
+		if debug {
+			b.poison(b.buf[b.readerIndex : b.readerIndex+length])
+		}
 		b.readerIndex += length
 	} else {
 		b.RetrieveAll()
 	}
 }
 
+// RetrieveAll removes all readable bytes.
 func (b *Buffer) RetrieveAll() {
+	if b.tap != nil && b.writerIndex > b.readerIndex {
+		b.tap.Retrieved(b.buf[b.readerIndex:b.writerIndex])
+	}
+	if debug {
+		b.poison(b.buf[b.readerIndex:b.writerIndex])
+		b.gen++
+	}
+	if b.shared() {
+		b.buf = make([]byte, len(b.buf))
+		b.pin = nil
+	}
 	b.readerIndex = cheapPrepend
 	b.writerIndex = cheapPrepend
 }
@@ -278,7 +351,31 @@ func (b *Buffer) PeekAllAsByteSlice() []byte {
 // PeekAsByteSlice returns a byte slice which contains length count bytes.
 // You MUST NOT modify the content of the returned slice.
 func (b *Buffer) PeekAsByteSlice(length int) []byte {
-	return b.buf[b.readerIndex:b.readerIndex+length]
+	p := b.buf[b.readerIndex : b.readerIndex+length]
+	if debug {
+		b.recordAlias(p, b.readerIndex)
+	}
+	return p
+}
+
+// FindCRLF returns the offset of the first "\r\n" in the readable bytes of
+// this buffer, or -1 if there is none.
+func (b *Buffer) FindCRLF() int {
+	return b.FindCRLFFrom(0)
+}
+
+// FindCRLFFrom returns the offset of the first "\r\n" in the readable
+// bytes of this buffer at or after offset start, or -1 if there is none.
+// Offsets count from the beginning of the readable bytes.
+func (b *Buffer) FindCRLFFrom(start int) int {
+	if start < 0 || start > b.ReadableBytes() {
+		return -1
+	}
+	i := bytes.Index(b.buf[b.readerIndex+start:b.writerIndex], []byte("\r\n"))
+	if i < 0 {
+		return -1
+	}
+	return start + i
 }
 
 // PeekInt64 parses a int64 from the beginning of the readable bytes of this buffer.
@@ -337,7 +434,13 @@ func (b *Buffer) PeekUint8() (x uint8, err error) {
 	return
 }
 
+// peekInteger returns ErrShortBuffer if fewer than s bytes are readable,
+// instead of parsing the stale bytes after them, or panicking past the
+// end of buf.
 func (b *Buffer) peekInteger(s int, x interface{}) error {
+	if b.ReadableBytes() < s {
+		return ErrShortBuffer
+	}
 	buf := &bytes.Buffer{}
 	if _, err := buf.Write(b.buf[b.readerIndex:b.readerIndex+s]); err != nil {
 		return err
@@ -434,14 +537,38 @@ func (b *Buffer) ReadUint8() (x uint8, err error) {
 }
 
 func (b *Buffer) makeSpace(length int) {
+	if debug {
+		b.gen++
+	}
 	writable := b.WritableBytes()
-	if writable+b.prependableBytes() >= length+cheapPrepend {
+	if b.shared() {
+		// Views still point into buf, so move the readable bytes
+		// to new storage instead of compacting in place.
+		buf := make([]byte, cheapPrepend+b.ReadableBytes()+length)
+		readable := copy(buf[cheapPrepend:], b.buf[b.readerIndex:b.writerIndex])
+		b.buf = buf
+		b.pin = nil
+		b.readerIndex = cheapPrepend
+		b.writerIndex = b.readerIndex + readable
+	} else if writable+b.prependableBytes() >= length+cheapPrepend {
 		readable := b.ReadableBytes()
 		copy(b.buf[cheapPrepend:cheapPrepend+readable], b.buf[b.readerIndex:b.writerIndex])
+		if debug {
+			b.poison(b.buf[cheapPrepend+readable : b.writerIndex])
+		}
 		b.readerIndex = cheapPrepend
 		b.writerIndex = b.readerIndex + readable
+	} else if debug {
+		// always move, so that aliases of the old storage can be poisoned
+		buf := make([]byte, len(b.buf)+length-writable)
+		copy(buf, b.buf)
+		b.poison(b.buf)
+		b.buf = buf
 	} else {
 		more := length - writable
 		b.buf = append(b.buf, make([]byte, more)...)
 	}
+	if debug {
+		b.mustValidate()
+	}
 }
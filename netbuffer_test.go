@@ -787,3 +787,124 @@ func TestRetrieveToByteSlice(t *testing.T) {
 		t.Errorf("retrieveToByteSlice, result is %+v, want %+v", result, []byte(s))
 	}
 }
+
+func TestPrependMoreThanCheapPrepend(t *testing.T) {
+	buf := NewBufferWithSize(4)
+	buf.Append([]byte("ab"))
+	if err := buf.PrependUint64(1); err != nil {
+		t.Errorf("buf.PrependUint64 error %v", err)
+	}
+	if err := buf.PrependUint32(2); err != nil {
+		t.Errorf("buf.PrependUint32 error %v", err)
+	}
+	if buf.ReadableBytes() != 14 {
+		t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 14)
+	}
+	x, err := buf.ReadUint32()
+	if err != nil || x != 2 {
+		t.Errorf("buf.ReadUint32() = %d, %v, want 2", x, err)
+	}
+	y, err := buf.ReadUint64()
+	if err != nil || y != 1 {
+		t.Errorf("buf.ReadUint64() = %d, %v, want 1", y, err)
+	}
+	if string(buf.PeekAllAsByteSlice()) != "ab" {
+		t.Errorf("buf.PeekAllAsByteSlice() = %q, want %q", buf.PeekAllAsByteSlice(), "ab")
+	}
+}
+
+func TestPrependMovesReadableBytes(t *testing.T) {
+	// room after the readable bytes: moved in place
+	buf := NewBufferWithSize(64)
+	buf.Append([]byte("body"))
+	storage := &buf.buf[0]
+	buf.prepend([]byte("0123456789"))
+	if &buf.buf[0] != storage {
+		t.Error("prepend reallocated although the buffer had room")
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "0123456789body" {
+		t.Errorf("readable bytes are %q, want %q", got, "0123456789body")
+	}
+
+	// a View of the storage: moved to new storage
+	v := buf.PeekView(4)
+	buf.prepend([]byte("abcdefghij"))
+	if v.String() != "0123" {
+		t.Errorf("v.String() = %q, want %q", v.String(), "0123")
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "abcdefghij0123456789body" {
+		t.Errorf("readable bytes are %q, want %q", got, "abcdefghij0123456789body")
+	}
+	v.Release()
+}
+
+func TestPeekShortBuffer(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte{1, 2, 3})
+	if _, err := buf.PeekUint32(); err != ErrShortBuffer {
+		t.Errorf("buf.PeekUint32() error %v, want %v", err, ErrShortBuffer)
+	}
+	if _, err := buf.ReadInt64(); err != ErrShortBuffer {
+		t.Errorf("buf.ReadInt64() error %v, want %v", err, ErrShortBuffer)
+	}
+	if buf.ReadableBytes() != 3 {
+		t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 3)
+	}
+}
+
+func TestPeekShortBufferStaleBytes(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	buf.RetrieveAll()
+	for _, c := range []struct {
+		name string
+		peek func() error
+	}{
+		{"PeekUint16", func() error { _, err := buf.PeekUint16(); return err }},
+		{"PeekInt32", func() error { _, err := buf.PeekInt32(); return err }},
+		{"PeekUint64", func() error { _, err := buf.PeekUint64(); return err }},
+		{"ReadInt64", func() error { _, err := buf.ReadInt64(); return err }},
+	} {
+		// the retrieved bytes are still in buf, after the readable one
+		buf.RetrieveAll()
+		buf.Append([]byte{9})
+		if err := c.peek(); err != ErrShortBuffer {
+			t.Errorf("buf.%s() error %v, want %v", c.name, err, ErrShortBuffer)
+		}
+		if buf.ReadableBytes() != 1 {
+			t.Errorf("after buf.%s(), buf.ReadableBytes() = %d, want 1", c.name, buf.ReadableBytes())
+		}
+	}
+	if _, err := NewBufferWithSize(0).PeekUint64(); err != ErrShortBuffer {
+		t.Errorf("PeekUint64 of an empty buffer error %v, want %v", err, ErrShortBuffer)
+	}
+}
+
+func TestAppendString(t *testing.T) {
+	buf := NewBufferWithSize(2)
+	buf.EnsureWritableBytes(100)
+	if buf.WritableBytes() < 100 {
+		t.Errorf("after buf.EnsureWritableBytes(100), buf.WritableBytes() = %d", buf.WritableBytes())
+	}
+	buf.AppendString("hello")
+	if s := buf.retrieveAllAsString(); s != "hello" {
+		t.Errorf("after buf.AppendString, readable bytes are %q, want %q", s, "hello")
+	}
+}
+
+func TestFindCRLF(t *testing.T) {
+	buf := NewBuffer()
+	buf.AppendString("xGET / HTTP/1.1\r\nHost: a\r\n\r")
+	buf.Retrieve(1)
+	if i := buf.FindCRLF(); i != 14 {
+		t.Errorf("buf.FindCRLF() = %d, want %d", i, 14)
+	}
+	cases := []struct{ start, want int }{
+		{0, 14}, {14, 14}, {15, 23}, {24, -1}, {26, -1}, {27, -1}, {-1, -1},
+	}
+	for _, c := range cases {
+		if i := buf.FindCRLFFrom(c.start); i != c.want {
+			t.Errorf("buf.FindCRLFFrom(%d) = %d, want %d", c.start, i, c.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package pcap records the bytes flowing through netbuffer.Buffers to a
+// pcapng file, as one TCP connection with synthetic IPv4 and TCP headers,
+// so that the traffic can be inspected in Wireshark.
+//
+// Tap the input buffer of a connection with Recorder.Input and its
+// output buffer with Recorder.Output:
+//
+//	rec, err := pcap.NewRecorder(f, nil, nil)
+//	...
+//	input.SetTap(rec.Input())
+//	output.SetTap(rec.Output())
+//
+// Bytes appended to the input buffer are recorded as sent by the remote
+// peer, bytes retrieved from the output buffer, that is written to the
+// connection, as sent by the local end.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Direction is the direction of recorded bytes.
+type Direction int
+
+// Directions of recorded bytes.
+const (
+	Inbound  Direction = iota // from the remote peer to the local end
+	Outbound                  // from the local end to the remote peer
+)
+
+// pcapng block types and constants, see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+const (
+	blockSectionHeader  = 0x0a0d0d0a
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1a2b3c4d
+	linkTypeRaw         = 101 // raw IPv4 or IPv6 packets
+	ipv4HeaderLen       = 20
+	tcpHeaderLen        = 20
+	maxSegment          = 65535 - ipv4HeaderLen - tcpHeaderLen
+	tcpFlagFin          = 0x01
+	tcpFlagSyn          = 0x02
+	tcpFlagPsh          = 0x08
+	tcpFlagAck          = 0x10
+	defaultWindow       = 65535
+	defaultLocalPort    = 8000
+	defaultRemotePort   = 50000
+	initialSeq          = 1000
+)
+
+var (
+	defaultLocal  = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: defaultLocalPort}
+	defaultRemote = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: defaultRemotePort}
+
+	// ErrNotIPv4 is returned by NewRecorder for an address which is not IPv4.
+	ErrNotIPv4 = errors.New("pcap: address is not IPv4")
+)
+
+// endpoint is one side of the recorded connection.
+type endpoint struct {
+	ip   [4]byte
+	port uint16
+	seq  uint32 // next sequence number sent by this side
+}
+
+// Recorder writes a pcapng file. It is safe for concurrent use, so the
+// input and output buffers of a connection may be used by different
+// goroutines.
+type Recorder struct {
+	mu        sync.Mutex
+	w         io.Writer
+	err       error       // first write error, returned by Record and Close
+	endpoints [2]endpoint // indexed by the Direction they send in
+	ipID      uint16
+	now       func() time.Time
+}
+
+// NewRecorder writes the pcapng header and a TCP handshake to w and
+// returns a Recorder of a connection between local and remote, which
+// default to 10.0.0.1:8000 and 10.0.0.2:50000 if nil.
+func NewRecorder(w io.Writer, local, remote *net.TCPAddr) (*Recorder, error) {
+	r := &Recorder{w: w, now: time.Now}
+	if local == nil {
+		local = defaultLocal
+	}
+	if remote == nil {
+		remote = defaultRemote
+	}
+	for i, addr := range []*net.TCPAddr{remote, local} { // Inbound is sent by remote
+		ip := addr.IP.To4()
+		if ip == nil {
+			return nil, ErrNotIPv4
+		}
+		copy(r.endpoints[i].ip[:], ip)
+		r.endpoints[i].port = uint16(addr.Port)
+		r.endpoints[i].seq = uint32(initialSeq * (i + 1))
+	}
+
+	r.writeHeader()
+	r.segment(Inbound, tcpFlagSyn, nil)
+	r.segment(Outbound, tcpFlagSyn|tcpFlagAck, nil)
+	r.segment(Inbound, tcpFlagAck, nil)
+	return r, r.err
+}
+
+// Record writes p as sent in direction dir.
+func (r *Recorder) Record(dir Direction, p []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(p) > 0 && r.err == nil {
+		n := len(p)
+		if n > maxSegment {
+			n = maxSegment
+		}
+		r.segment(dir, tcpFlagPsh|tcpFlagAck, p[:n])
+		p = p[n:]
+	}
+	return r.err
+}
+
+// Close records the end of the connection. It does not close the
+// underlying writer.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.segment(Outbound, tcpFlagFin|tcpFlagAck, nil)
+	r.segment(Inbound, tcpFlagFin|tcpFlagAck, nil)
+	r.segment(Outbound, tcpFlagAck, nil)
+	return r.err
+}
+
+// Input returns a Tap for the input buffer of the connection, which
+// records appended bytes as Inbound.
+func (r *Recorder) Input() netbuffer.Tap {
+	return tap{r: r, dir: Inbound}
+}
+
+// Output returns a Tap for the output buffer of the connection, which
+// records retrieved bytes as Outbound.
+func (r *Recorder) Output() netbuffer.Tap {
+	return tap{r: r, dir: Outbound}
+}
+
+// tap records one direction. Errors are kept by the Recorder and
+// returned by Record and Close.
+type tap struct {
+	r   *Recorder
+	dir Direction
+}
+
+func (t tap) Appended(p []byte) {
+	if t.dir == Inbound {
+		_ = t.r.Record(t.dir, p)
+	}
+}
+
+func (t tap) Retrieved(p []byte) {
+	if t.dir == Outbound {
+		_ = t.r.Record(t.dir, p)
+	}
+}
+
+func (r *Recorder) write(p []byte) {
+	if r.err == nil {
+		_, r.err = r.w.Write(p)
+	}
+}
+
+func (r *Recorder) writeHeader() {
+	shb := make([]byte, 28)
+	le := binary.LittleEndian
+	le.PutUint32(shb[0:], blockSectionHeader)
+	le.PutUint32(shb[4:], uint32(len(shb)))
+	le.PutUint32(shb[8:], byteOrderMagic)
+	le.PutUint16(shb[12:], 1) // major version
+	le.PutUint16(shb[14:], 0) // minor version
+	le.PutUint64(shb[16:], ^uint64(0))
+	le.PutUint32(shb[24:], uint32(len(shb)))
+	r.write(shb)
+
+	idb := make([]byte, 20)
+	le.PutUint32(idb[0:], blockInterface)
+	le.PutUint32(idb[4:], uint32(len(idb)))
+	le.PutUint16(idb[8:], linkTypeRaw)
+	le.PutUint32(idb[12:], 0) // no snap length limit
+	le.PutUint32(idb[16:], uint32(len(idb)))
+	r.write(idb)
+}
+
+// segment writes a TCP segment with flags and payload sent in direction
+// dir as an enhanced packet block.
+func (r *Recorder) segment(dir Direction, flags byte, payload []byte) {
+	src := &r.endpoints[dir]
+	dst := &r.endpoints[1-dir]
+	packetLen := ipv4HeaderLen + tcpHeaderLen + len(payload)
+	padded := (packetLen + 3) &^ 3
+	block := make([]byte, 28+padded+4)
+	le := binary.LittleEndian
+	be := binary.BigEndian
+
+	le.PutUint32(block[0:], blockEnhancedPacket)
+	le.PutUint32(block[4:], uint32(len(block)))
+	le.PutUint32(block[8:], 0) // interface
+	usec := uint64(r.now().UnixNano() / int64(time.Microsecond))
+	le.PutUint32(block[12:], uint32(usec>>32))
+	le.PutUint32(block[16:], uint32(usec))
+	le.PutUint32(block[20:], uint32(packetLen))
+	le.PutUint32(block[24:], uint32(packetLen))
+	le.PutUint32(block[len(block)-4:], uint32(len(block)))
+
+	ip := block[28 : 28+ipv4HeaderLen]
+	ip[0] = 0x45 // version 4, 5 words of header
+	be.PutUint16(ip[2:], uint16(packetLen))
+	be.PutUint16(ip[4:], r.ipID)
+	r.ipID++
+	be.PutUint16(ip[6:], 0x4000) // don't fragment
+	ip[8] = 64                   // TTL
+	ip[9] = 6                    // TCP
+	copy(ip[12:16], src.ip[:])
+	copy(ip[16:20], dst.ip[:])
+	be.PutUint16(ip[10:], checksum(ip, 0))
+
+	tcp := block[28+ipv4HeaderLen : 28+packetLen]
+	be.PutUint16(tcp[0:], src.port)
+	be.PutUint16(tcp[2:], dst.port)
+	be.PutUint32(tcp[4:], src.seq)
+	if flags&tcpFlagAck != 0 {
+		be.PutUint32(tcp[8:], dst.seq)
+	}
+	tcp[12] = tcpHeaderLen / 4 << 4
+	tcp[13] = flags
+	be.PutUint16(tcp[14:], defaultWindow)
+	copy(tcp[tcpHeaderLen:], payload)
+
+	// pseudo header: addresses, protocol and TCP length
+	var sum uint32
+	for i := 12; i < 20; i += 2 {
+		sum += uint32(be.Uint16(ip[i:]))
+	}
+	sum += 6 + uint32(len(tcp))
+	be.PutUint16(tcp[16:], checksum(tcp, sum))
+
+	src.seq += uint32(len(payload))
+	if flags&(tcpFlagSyn|tcpFlagFin) != 0 {
+		src.seq++
+	}
+	r.write(block)
+}
+
+// checksum returns the Internet checksum of p, starting from sum.
+func checksum(p []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(p); i += 2 {
+		sum += uint32(p[i])<<8 | uint32(p[i+1])
+	}
+	if len(p)%2 == 1 {
+		sum += uint32(p[len(p)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,187 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+type packet struct {
+	usec     uint64
+	src, dst string
+	seq, ack uint32
+	flags    byte
+	payload  string
+}
+
+// parse parses a pcapng file written by a Recorder and verifies its
+// block structure and checksums.
+func parse(t *testing.T, data []byte) []packet {
+	t.Helper()
+	le := binary.LittleEndian
+	be := binary.BigEndian
+	var packets []packet
+	for i := 0; len(data) > 0; i++ {
+		if len(data) < 12 {
+			t.Fatalf("block %d: truncated", i)
+		}
+		typ, size := le.Uint32(data), int(le.Uint32(data[4:]))
+		if size%4 != 0 || size > len(data) || le.Uint32(data[size-4:]) != uint32(size) {
+			t.Fatalf("block %d: invalid length %d", i, size)
+		}
+		block := data[:size]
+		data = data[size:]
+		switch {
+		case i == 0:
+			if typ != blockSectionHeader || le.Uint32(block[8:]) != byteOrderMagic {
+				t.Fatalf("first block is not a section header")
+			}
+			continue
+		case i == 1:
+			if typ != blockInterface || le.Uint16(block[8:]) != linkTypeRaw {
+				t.Fatalf("second block is not a raw interface description")
+			}
+			continue
+		case typ != blockEnhancedPacket:
+			t.Fatalf("block %d: type %#x", i, typ)
+		}
+
+		n := int(le.Uint32(block[20:]))
+		if n != int(le.Uint32(block[24:])) {
+			t.Fatalf("block %d: captured length %d differs from original", i, n)
+		}
+		ip := block[28 : 28+ipv4HeaderLen]
+		tcp := block[28+ipv4HeaderLen : 28+n]
+		if int(be.Uint16(ip[2:])) != n || ip[9] != 6 {
+			t.Fatalf("block %d: bad IPv4 header", i)
+		}
+		if checksum(ip, 0) != 0 {
+			t.Errorf("block %d: bad IPv4 checksum", i)
+		}
+		var sum uint32
+		for j := 12; j < 20; j += 2 {
+			sum += uint32(be.Uint16(ip[j:]))
+		}
+		if checksum(tcp, sum+6+uint32(len(tcp))) != 0 {
+			t.Errorf("block %d: bad TCP checksum", i)
+		}
+		packets = append(packets, packet{
+			usec:    uint64(le.Uint32(block[12:]))<<32 | uint64(le.Uint32(block[16:])),
+			src:     (&net.TCPAddr{IP: net.IP(ip[12:16]), Port: int(be.Uint16(tcp[0:]))}).String(),
+			dst:     (&net.TCPAddr{IP: net.IP(ip[16:20]), Port: int(be.Uint16(tcp[2:]))}).String(),
+			seq:     be.Uint32(tcp[4:]),
+			ack:     be.Uint32(tcp[8:]),
+			flags:   tcp[13],
+			payload: string(tcp[tcpHeaderLen:]),
+		})
+	}
+	return packets
+}
+
+func TestRecorder(t *testing.T) {
+	var out bytes.Buffer
+	r, err := NewRecorder(&out, nil, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder error %v", err)
+	}
+	r.now = func() time.Time { return time.Unix(1, 2000) }
+
+	input := netbuffer.NewBuffer()
+	output := netbuffer.NewBuffer()
+	input.SetTap(r.Input())
+	output.SetTap(r.Output())
+
+	input.AppendString("ping")
+	input.RetrieveAll()          // not recorded
+	output.AppendString("pong!") // not recorded until written
+	output.Retrieve(5)
+	input.AppendString("bye")
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close error %v", err)
+	}
+
+	packets := parse(t, out.Bytes())
+	const (
+		local  = "10.0.0.1:8000"
+		remote = "10.0.0.2:50000"
+		pa     = tcpFlagPsh | tcpFlagAck
+		fa     = tcpFlagFin | tcpFlagAck
+	)
+	want := []packet{
+		{src: remote, dst: local, seq: 1000, flags: tcpFlagSyn},
+		{src: local, dst: remote, seq: 2000, ack: 1001, flags: tcpFlagSyn | tcpFlagAck},
+		{src: remote, dst: local, seq: 1001, ack: 2001, flags: tcpFlagAck},
+		{src: remote, dst: local, seq: 1001, ack: 2001, flags: pa, payload: "ping"},
+		{src: local, dst: remote, seq: 2001, ack: 1005, flags: pa, payload: "pong!"},
+		{src: remote, dst: local, seq: 1005, ack: 2006, flags: pa, payload: "bye"},
+		{src: local, dst: remote, seq: 2006, ack: 1008, flags: fa},
+		{src: remote, dst: local, seq: 1008, ack: 2007, flags: fa},
+		{src: local, dst: remote, seq: 2007, ack: 1009, flags: tcpFlagAck},
+	}
+	if len(packets) != len(want) {
+		t.Fatalf("got %d packets, want %d", len(packets), len(want))
+	}
+	for i := range want {
+		got := packets[i]
+		if i >= 3 && got.usec != 1000000+2 {
+			t.Errorf("packet %d: timestamp %d usec, want %d", i, got.usec, 1000002)
+		}
+		got.usec = 0
+		if got != want[i] {
+			t.Errorf("packet %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestRecorderLargePayload(t *testing.T) {
+	var out bytes.Buffer
+	r, err := NewRecorder(&out,
+		&net.TCPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 80},
+		&net.TCPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 1234})
+	if err != nil {
+		t.Fatalf("NewRecorder error %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789"), 10000)
+	if err := r.Record(Outbound, payload); err != nil {
+		t.Fatalf("Record error %v", err)
+	}
+
+	packets := parse(t, out.Bytes())[3:]
+	if len(packets) != 2 {
+		t.Fatalf("got %d packets, want 2", len(packets))
+	}
+	if len(packets[0].payload) != maxSegment {
+		t.Errorf("first segment has %d bytes, want %d", len(packets[0].payload), maxSegment)
+	}
+	if got := packets[0].payload + packets[1].payload; got != string(payload) {
+		t.Errorf("segments do not add up to the payload")
+	}
+	if packets[1].seq != packets[0].seq+maxSegment {
+		t.Errorf("second segment seq %d, want %d", packets[1].seq, packets[0].seq+maxSegment)
+	}
+	if packets[0].src != "192.168.1.1:80" || packets[0].dst != "192.168.1.2:1234" {
+		t.Errorf("segment from %s to %s", packets[0].src, packets[0].dst)
+	}
+}
+
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestRecorderErrors(t *testing.T) {
+	if _, err := NewRecorder(&bytes.Buffer{}, &net.TCPAddr{IP: net.IPv6loopback, Port: 1}, nil); err != ErrNotIPv4 {
+		t.Errorf("NewRecorder with IPv6 address error %v, want %v", err, ErrNotIPv4)
+	}
+	if _, err := NewRecorder(failingWriter{}, nil, nil); err != errWrite {
+		t.Errorf("NewRecorder with failing writer error %v, want %v", err, errWrite)
+	}
+}
@@ -0,0 +1,88 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// AppendTag appends the tag of a field numbered num of wire type typ.
+func AppendTag(b *netbuffer.Buffer, num Number, typ Type) {
+	b.AppendUvarint(uint64(num)<<3 | uint64(typ))
+}
+
+// AppendVarint appends a VarintType field, of an int32, int64, uint32,
+// uint64, bool or enum value. Negative int32 and int64 values are
+// converted to uint64, taking 10 bytes.
+func AppendVarint(b *netbuffer.Buffer, num Number, x uint64) {
+	AppendTag(b, num, VarintType)
+	b.AppendUvarint(x)
+}
+
+// AppendSint appends a zig-zag encoded VarintType field, of a sint32 or
+// sint64 value.
+func AppendSint(b *netbuffer.Buffer, num Number, x int64) {
+	AppendVarint(b, num, EncodeZigZag(x))
+}
+
+// AppendFixed32 appends a Fixed32Type field, of a fixed32 or sfixed32
+// value.
+func AppendFixed32(b *netbuffer.Buffer, num Number, x uint32) {
+	AppendTag(b, num, Fixed32Type)
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], x)
+	b.Append(p[:])
+}
+
+// AppendFixed64 appends a Fixed64Type field, of a fixed64 or sfixed64
+// value.
+func AppendFixed64(b *netbuffer.Buffer, num Number, x uint64) {
+	AppendTag(b, num, Fixed64Type)
+	var p [8]byte
+	binary.LittleEndian.PutUint64(p[:], x)
+	b.Append(p[:])
+}
+
+// AppendFloat appends a float field.
+func AppendFloat(b *netbuffer.Buffer, num Number, x float32) {
+	AppendFixed32(b, num, math.Float32bits(x))
+}
+
+// AppendDouble appends a double field.
+func AppendDouble(b *netbuffer.Buffer, num Number, x float64) {
+	AppendFixed64(b, num, math.Float64bits(x))
+}
+
+// AppendBytes appends a BytesType field of payload p.
+func AppendBytes(b *netbuffer.Buffer, num Number, p []byte) {
+	AppendTag(b, num, BytesType)
+	b.AppendUvarint(uint64(len(p)))
+	b.Append(p)
+}
+
+// AppendString appends a BytesType field of payload s.
+func AppendString(b *netbuffer.Buffer, num Number, s string) {
+	AppendTag(b, num, BytesType)
+	b.AppendUvarint(uint64(len(s)))
+	b.AppendString(s)
+}
+
+// AppendMessage appends a BytesType field holding the nested message
+// which fn appends to the Buffer it is passed. If fn returns an error, b
+// is left unchanged.
+func AppendMessage(b *netbuffer.Buffer, num Number, fn func(*netbuffer.Buffer) error) error {
+	m := netbuffer.NewBuffer()
+	if err := fn(m); err != nil {
+		return err
+	}
+	m.PrependUvarint(uint64(m.ReadableBytes()))
+	AppendTag(b, num, BytesType)
+	b.Append(m.PeekAllAsByteSlice())
+	return nil
+}
+
+// AppendRaw appends f as it was read, tag included.
+func AppendRaw(b *netbuffer.Buffer, f Field) {
+	b.Append(f.Raw)
+}
@@ -0,0 +1,173 @@
+package protowire
+
+import (
+	"encoding/binary"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Field is a field of a message.
+type Field struct {
+	Num  Number
+	Type Type
+	// Varint is the value of a VarintType, Fixed32Type or Fixed64Type
+	// field.
+	Varint uint64
+	// Bytes is the payload of a BytesType field, or the fields inside a
+	// group.
+	Bytes []byte
+	// Raw is the whole field, tag included.
+	Raw []byte
+}
+
+// Iterator walks the fields of a message. Bytes and Raw of its fields
+// alias the bytes iterated over: with a Buffer, they are valid until the
+// Buffer is next modified.
+type Iterator struct {
+	data  []byte
+	off   int
+	field Field
+	err   error
+}
+
+// NewIterator returns an iterator over the readable bytes of b, holding
+// one whole message. It does not modify b.
+func NewIterator(b *netbuffer.Buffer) *Iterator {
+	return NewBytesIterator(b.PeekAllAsByteSlice())
+}
+
+// NewBytesIterator returns an iterator over the message p, such as the
+// Bytes of a field holding a nested message.
+func NewBytesIterator(p []byte) *Iterator {
+	return &Iterator{data: p}
+}
+
+// Next advances to the next field and reports whether there is one. It
+// returns false at the end of the message, or on error.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.off == len(it.data) {
+		return false
+	}
+	f, n, err := parseField(it.data[it.off:], 0)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if f.Type == EndGroupType {
+		it.err = ErrInvalidField
+		return false
+	}
+	it.field = f
+	it.off += n
+	return true
+}
+
+// Field returns the field Next advanced to.
+func (it *Iterator) Field() Field {
+	return it.field
+}
+
+// Offset returns count of byte before the field Next is to advance to.
+func (it *Iterator) Offset() int {
+	return it.off
+}
+
+// Err returns the error which stopped the iteration, or nil at the end
+// of the message. A message ending inside a field returns
+// netbuffer.ErrShortBuffer.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// parseTag parses a tag at the beginning of p, and returns it with its
+// count of byte.
+func parseTag(p []byte) (Number, Type, int, error) {
+	x, n, err := parseVarint(p)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	num, typ := x>>3, Type(x&7)
+	if num < uint64(MinNumber) || num > uint64(MaxNumber) || typ > Fixed32Type {
+		return 0, 0, 0, ErrInvalidField
+	}
+	return Number(num), typ, n, nil
+}
+
+func parseVarint(p []byte) (uint64, int, error) {
+	x, n := binary.Uvarint(p)
+	switch {
+	case n == 0:
+		return 0, 0, netbuffer.ErrShortBuffer
+	case n < 0:
+		return 0, 0, ErrInvalidField
+	}
+	return x, n, nil
+}
+
+// parseField parses the field at the beginning of p, nested in depth
+// groups, and returns it with its count of byte.
+func parseField(p []byte, depth int) (Field, int, error) {
+	var f Field
+	num, typ, n, err := parseTag(p)
+	if err != nil {
+		return f, 0, err
+	}
+	f.Num, f.Type = num, typ
+
+	switch typ {
+	case VarintType:
+		x, m, err := parseVarint(p[n:])
+		if err != nil {
+			return f, 0, err
+		}
+		f.Varint = x
+		n += m
+	case Fixed32Type:
+		if len(p)-n < 4 {
+			return f, 0, netbuffer.ErrShortBuffer
+		}
+		f.Varint = uint64(binary.LittleEndian.Uint32(p[n:]))
+		n += 4
+	case Fixed64Type:
+		if len(p)-n < 8 {
+			return f, 0, netbuffer.ErrShortBuffer
+		}
+		f.Varint = binary.LittleEndian.Uint64(p[n:])
+		n += 8
+	case BytesType:
+		length, m, err := parseVarint(p[n:])
+		if err != nil {
+			return f, 0, err
+		}
+		n += m
+		if uint64(len(p)-n) < length {
+			return f, 0, netbuffer.ErrShortBuffer
+		}
+		f.Bytes = p[n : n+int(length) : n+int(length)]
+		n += int(length)
+	case StartGroupType:
+		if depth == maxGroupDepth {
+			return f, 0, ErrInvalidField
+		}
+		start := n
+		for {
+			inner, m, err := parseField(p[n:], depth+1)
+			if err != nil {
+				return f, 0, err
+			}
+			if inner.Type == EndGroupType {
+				if inner.Num != num {
+					return f, 0, ErrInvalidField
+				}
+				f.Bytes = p[start:n:n]
+				n += m
+				break
+			}
+			n += m
+		}
+	case EndGroupType:
+		// the caller matches it with its start
+	}
+	f.Raw = p[:n:n]
+	return f, n, nil
+}
@@ -0,0 +1,211 @@
+package protowire
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func collect(t *testing.T, it *Iterator) []Field {
+	var fields []Field
+	for it.Next() {
+		fields = append(fields, it.Field())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	return fields
+}
+
+func TestAppend(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fn   func(b *netbuffer.Buffer)
+		want []byte
+	}{
+		// examples of the Protocol Buffers encoding documentation
+		{"varint", func(b *netbuffer.Buffer) { AppendVarint(b, 1, 150) }, []byte{0x08, 0x96, 0x01}},
+		{"string", func(b *netbuffer.Buffer) { AppendString(b, 2, "testing") },
+			[]byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{"sint", func(b *netbuffer.Buffer) { AppendSint(b, 1, -2) }, []byte{0x08, 0x03}},
+		{"negative int", func(b *netbuffer.Buffer) { AppendVarint(b, 1, math.MaxUint64) },
+			[]byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"fixed32", func(b *netbuffer.Buffer) { AppendFixed32(b, 3, 0x01020304) }, []byte{0x1d, 4, 3, 2, 1}},
+		{"fixed64", func(b *netbuffer.Buffer) { AppendFixed64(b, 3, 1) }, []byte{0x19, 1, 0, 0, 0, 0, 0, 0, 0}},
+		{"large number", func(b *netbuffer.Buffer) { AppendVarint(b, MaxNumber, 0) },
+			[]byte{0xf8, 0xff, 0xff, 0xff, 0x0f, 0}},
+		{"message", func(b *netbuffer.Buffer) {
+			_ = AppendMessage(b, 3, func(m *netbuffer.Buffer) error {
+				AppendVarint(m, 1, 150)
+				return nil
+			})
+		}, []byte{0x1a, 0x03, 0x08, 0x96, 0x01}},
+	} {
+		b := netbuffer.NewBuffer()
+		tc.fn(b)
+		if got := b.PeekAllAsByteSlice(); !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: % x, want % x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	AppendVarint(b, 1, 150)
+	AppendSint(b, 2, math.MinInt64)
+	AppendFixed32(b, 3, 7)
+	AppendFloat(b, 4, 1.5)
+	AppendDouble(b, 5, -2.25)
+	AppendBytes(b, 6, []byte{})
+	AppendString(b, 7, "hello")
+	if err := AppendMessage(b, 8, func(m *netbuffer.Buffer) error {
+		AppendString(m, 1, "inner")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	size := b.ReadableBytes()
+
+	fields := collect(t, NewIterator(b))
+	if b.ReadableBytes() != size {
+		t.Fatalf("iterating modified the buffer")
+	}
+	if len(fields) != 8 {
+		t.Fatalf("%d fields, want 8", len(fields))
+	}
+	for i, f := range fields {
+		if f.Num != Number(i+1) {
+			t.Fatalf("field %d numbered %d", i, f.Num)
+		}
+	}
+	switch {
+	case fields[0].Type != VarintType || fields[0].Varint != 150:
+		t.Errorf("field 1 = %+v", fields[0])
+	case DecodeZigZag(fields[1].Varint) != math.MinInt64:
+		t.Errorf("field 2 = %+v", fields[1])
+	case fields[2].Type != Fixed32Type || fields[2].Varint != 7:
+		t.Errorf("field 3 = %+v", fields[2])
+	case math.Float32frombits(uint32(fields[3].Varint)) != 1.5:
+		t.Errorf("field 4 = %+v", fields[3])
+	case fields[4].Type != Fixed64Type || math.Float64frombits(fields[4].Varint) != -2.25:
+		t.Errorf("field 5 = %+v", fields[4])
+	case fields[5].Type != BytesType || len(fields[5].Bytes) != 0:
+		t.Errorf("field 6 = %+v", fields[5])
+	case string(fields[6].Bytes) != "hello":
+		t.Errorf("field 7 = %+v", fields[6])
+	}
+	inner := collect(t, NewBytesIterator(fields[7].Bytes))
+	if len(inner) != 1 || string(inner[0].Bytes) != "inner" {
+		t.Errorf("field 8 = %+v", inner)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	in := netbuffer.NewBuffer()
+	AppendVarint(in, 1, 42)
+	AppendString(in, 3, "old")
+	AppendFixed64(in, 2, 9)
+	AppendString(in, 3, "older")
+
+	out := netbuffer.NewBuffer()
+	it := NewIterator(in)
+	for it.Next() {
+		f := it.Field()
+		if f.Num == 3 && f.Type == BytesType {
+			AppendString(out, 3, "new")
+			continue
+		}
+		AppendRaw(out, f)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if it.Offset() != in.ReadableBytes() {
+		t.Fatalf("Offset() = %d at the end of %d bytes", it.Offset(), in.ReadableBytes())
+	}
+
+	want := netbuffer.NewBuffer()
+	AppendVarint(want, 1, 42)
+	AppendString(want, 3, "new")
+	AppendFixed64(want, 2, 9)
+	AppendString(want, 3, "new")
+	if !bytes.Equal(out.PeekAllAsByteSlice(), want.PeekAllAsByteSlice()) {
+		t.Fatalf("rewritten % x, want % x", out.PeekAllAsByteSlice(), want.PeekAllAsByteSlice())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	AppendTag(b, 1, StartGroupType)
+	AppendVarint(b, 2, 5)
+	AppendTag(b, 3, StartGroupType)
+	AppendTag(b, 3, EndGroupType)
+	AppendTag(b, 1, EndGroupType)
+	AppendVarint(b, 4, 6)
+
+	fields := collect(t, NewIterator(b))
+	if len(fields) != 2 || fields[0].Type != StartGroupType || fields[1].Varint != 6 {
+		t.Fatalf("fields = %+v", fields)
+	}
+	if len(fields[0].Raw) != b.ReadableBytes()-2 {
+		t.Fatalf("group of %d bytes", len(fields[0].Raw))
+	}
+	inner := collect(t, NewBytesIterator(fields[0].Bytes))
+	if len(inner) != 2 || inner[0].Varint != 5 || inner[1].Num != 3 {
+		t.Fatalf("group fields = %+v", inner)
+	}
+}
+
+func TestIteratorErrors(t *testing.T) {
+	deep := netbuffer.NewBuffer()
+	for i := 0; i <= maxGroupDepth; i++ {
+		AppendTag(deep, 1, StartGroupType)
+	}
+	for i := 0; i <= maxGroupDepth; i++ {
+		AppendTag(deep, 1, EndGroupType)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated tag", []byte{0x80}, netbuffer.ErrShortBuffer},
+		{"truncated varint", []byte{0x08, 0x96}, netbuffer.ErrShortBuffer},
+		{"truncated fixed32", []byte{0x1d, 1, 2, 3}, netbuffer.ErrShortBuffer},
+		{"truncated fixed64", []byte{0x19, 1, 2, 3, 4, 5, 6, 7}, netbuffer.ErrShortBuffer},
+		{"truncated bytes", []byte{0x12, 3, 'a', 'b'}, netbuffer.ErrShortBuffer},
+		{"unterminated group", []byte{0x0b, 0x10, 1}, netbuffer.ErrShortBuffer},
+		{"field number 0", []byte{0x00, 1}, ErrInvalidField},
+		{"wire type 6", []byte{0x0e}, ErrInvalidField},
+		{"wire type 7", []byte{0x0f}, ErrInvalidField},
+		{"varint of 11 bytes", []byte{0x08, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, ErrInvalidField},
+		{"end group", []byte{0x0c}, ErrInvalidField},
+		{"mismatched group", []byte{0x0b, 0x14}, ErrInvalidField},
+		{"groups too deep", deep.PeekAllAsByteSlice(), ErrInvalidField},
+	} {
+		it := NewBytesIterator(tc.data)
+		for it.Next() {
+		}
+		if it.Err() != tc.err {
+			t.Errorf("%s: Err() = %v, want %v", tc.name, it.Err(), tc.err)
+		}
+	}
+}
+
+func TestZigZag(t *testing.T) {
+	for _, tc := range []struct {
+		x int64
+		z uint64
+	}{{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2147483647, 4294967294}, {-2147483648, 4294967295},
+		{math.MaxInt64, math.MaxUint64 - 1}, {math.MinInt64, math.MaxUint64}} {
+		if z := EncodeZigZag(tc.x); z != tc.z {
+			t.Errorf("EncodeZigZag(%d) = %d, want %d", tc.x, z, tc.z)
+		}
+		if x := DecodeZigZag(tc.z); x != tc.x {
+			t.Errorf("DecodeZigZag(%d) = %d, want %d", tc.z, x, tc.x)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package protowire reads and writes the Protocol Buffers wire format
+// directly against netbuffer.Buffers, without generated code or the
+// protobuf runtime, for programs such as gateways which look at or
+// rewrite a few fields of messages and pass the rest through.
+//
+// An Iterator walks the fields of a message in the readable bytes of a
+// Buffer; the Append functions append fields to a Buffer. Rewriting field
+// 3 of a message, keeping the others byte for byte:
+//
+//	it := protowire.NewIterator(in)
+//	for it.Next() {
+//		f := it.Field()
+//		if f.Num == 3 && f.Type == protowire.BytesType {
+//			protowire.AppendString(out, 3, rewrite(string(f.Bytes)))
+//			continue
+//		}
+//		protowire.AppendRaw(out, f)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Field values are not interpreted beyond their wire type: the caller
+// knows whether a varint is an int32, a uint64, a bool or a zig-zag
+// encoded sint64.
+package protowire
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Number is the number of a field.
+type Number int32
+
+// Valid field numbers.
+const (
+	MinNumber Number = 1
+	MaxNumber Number = 1<<29 - 1
+)
+
+// Type is the wire type of a field.
+type Type int8
+
+// Wire types.
+const (
+	VarintType     Type = 0
+	Fixed64Type    Type = 1
+	BytesType      Type = 2
+	StartGroupType Type = 3
+	EndGroupType   Type = 4
+	Fixed32Type    Type = 5
+)
+
+func (t Type) String() string {
+	switch t {
+	case VarintType:
+		return "varint"
+	case Fixed64Type:
+		return "fixed64"
+	case BytesType:
+		return "bytes"
+	case StartGroupType:
+		return "start group"
+	case EndGroupType:
+		return "end group"
+	case Fixed32Type:
+		return "fixed32"
+	}
+	return fmt.Sprintf("Type(%d)", int8(t))
+}
+
+// maxGroupDepth is the deepest nesting of groups the Iterator skips.
+const maxGroupDepth = 100
+
+// ErrInvalidField is returned by an Iterator for a field of an invalid
+// number or wire type, a varint longer than 10 bytes, or an unmatched
+// group.
+var ErrInvalidField = errors.New("protowire: invalid field")
+
+// EncodeZigZag returns the zig-zag encoding of x, as sint32 and sint64
+// fields are encoded.
+func EncodeZigZag(x int64) uint64 {
+	return uint64(x<<1) ^ uint64(x>>63)
+}
+
+// DecodeZigZag returns the value of the zig-zag encoded x.
+func DecodeZigZag(x uint64) int64 {
+	return int64(x>>1) ^ -int64(x&1)
+}
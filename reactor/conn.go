@@ -0,0 +1,218 @@
+//go:build linux
+// +build linux
+
+package reactor
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Conn is a connection served by a loop of a Reactor. Its methods must
+// be called on its loop, that is from the callbacks, except Do.
+type Conn struct {
+	l      *loop
+	fd     int
+	remote net.Addr
+	input  *netbuffer.Buffer
+	output *netbuffer.Buffer
+
+	connected     bool
+	shuttingDown  bool // Shutdown was called
+	writeShut     bool // the write side is closed
+	writeComplete bool // a write complete callback is queued
+	context       interface{}
+}
+
+func newConn(l *loop, fd int, remote net.Addr) *Conn {
+	return &Conn{
+		l:         l,
+		fd:        fd,
+		remote:    remote,
+		input:     netbuffer.NewBufferWithSize(minFillRead),
+		output:    netbuffer.NewBufferWithSize(0),
+		connected: true,
+	}
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Connected reports whether the connection is established, and not
+// closed.
+func (c *Conn) Connected() bool {
+	return c.connected
+}
+
+// SetContext attaches v to the connection.
+func (c *Conn) SetContext(v interface{}) {
+	c.context = v
+}
+
+// Context returns the value attached by SetContext.
+func (c *Conn) Context() interface{} {
+	return c.context
+}
+
+// Output returns the output buffer. Bytes appended to it are written by
+// the next Send, or when the loop next finds the socket writable.
+func (c *Conn) Output() *netbuffer.Buffer {
+	return c.output
+}
+
+// Send appends p to the output buffer and writes as much of it as the
+// socket takes; the rest is written when the socket is writable again.
+// Bytes sent after Shutdown or on a closed connection are dropped.
+func (c *Conn) Send(p []byte) {
+	if !c.connected || c.shuttingDown {
+		return
+	}
+	c.output.Append(p)
+	c.handleWrite()
+}
+
+// Shutdown closes the write side of the connection once the output
+// buffer has been written.
+func (c *Conn) Shutdown() {
+	if !c.connected || c.shuttingDown {
+		return
+	}
+	c.shuttingDown = true
+	c.handleWrite()
+}
+
+// Close closes the connection, dropping the output buffer.
+func (c *Conn) Close() {
+	c.handleClose()
+}
+
+// Do runs f with c on the loop of c. It may be called from any goroutine.
+// f is not run if c is closed meanwhile.
+func (c *Conn) Do(f func(c *Conn)) {
+	c.l.queue(func() {
+		if c.connected {
+			f(c)
+		}
+	})
+}
+
+func (c *Conn) handleEvent(events uint32) {
+	if events&(syscall.EPOLLERR|syscall.EPOLLHUP) != 0 && events&syscall.EPOLLIN == 0 {
+		c.handleClose()
+		return
+	}
+	if events&(syscall.EPOLLIN|syscall.EPOLLRDHUP) != 0 {
+		c.handleRead()
+	}
+	if events&syscall.EPOLLOUT != 0 && c.connected {
+		c.handleWrite()
+	}
+}
+
+// handleRead reads until the socket would block, since epoll is edge
+// triggered, and calls the message callback after each read.
+func (c *Conn) handleRead() {
+	for c.connected {
+		n, err := c.readv()
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			return
+		}
+		if err != nil || n == 0 {
+			c.handleClose()
+			return
+		}
+		if cb := c.l.r.messageCallback; cb != nil {
+			cb(c, c.input)
+		} else {
+			c.input.RetrieveAll()
+		}
+	}
+}
+
+// readv reads into the writable bytes of the input buffer, and into the
+// spill buffer of the loop for what does not fit, which is then appended.
+func (c *Conn) readv() (int, error) {
+	if c.input.WritableBytes() < minFillRead && c.input.ReadableBytes() == 0 {
+		c.input.EnsureWritableBytes(minFillRead)
+	}
+	writable := c.input.WritableByteSlice()
+	var iov [2]syscall.Iovec
+	cnt := 0
+	if len(writable) > 0 {
+		iov[0].Base = &writable[0]
+		iov[0].SetLen(len(writable))
+		cnt++
+	}
+	iov[cnt].Base = &c.l.spill[0]
+	iov[cnt].SetLen(len(c.l.spill))
+	cnt++
+
+	r, _, errno := syscall.Syscall(syscall.SYS_READV, uintptr(c.fd), uintptr(unsafe.Pointer(&iov[0])), uintptr(cnt))
+	if errno != 0 {
+		return 0, errno
+	}
+	n := int(r)
+	if n <= len(writable) {
+		c.input.HasWritten(n)
+	} else {
+		c.input.HasWritten(len(writable))
+		c.input.Append(c.l.spill[:n-len(writable)])
+	}
+	return n, nil
+}
+
+// handleWrite writes the output buffer until it is empty or the socket
+// would block.
+func (c *Conn) handleWrite() {
+	wrote := false
+	for c.output.ReadableBytes() > 0 {
+		n, err := syscall.Write(c.fd, c.output.PeekAllAsByteSlice())
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			return
+		}
+		if err != nil {
+			c.handleClose()
+			return
+		}
+		c.output.Retrieve(n)
+		wrote = true
+	}
+	if wrote && c.l.r.writeCompleteCallback != nil && !c.writeComplete {
+		// called after the current callback returns, as muduo queues it
+		c.writeComplete = true
+		c.l.queue(func() {
+			c.writeComplete = false
+			if c.connected {
+				c.l.r.writeCompleteCallback(c)
+			}
+		})
+	}
+	if c.shuttingDown && !c.writeShut {
+		c.writeShut = true
+		syscall.Shutdown(c.fd, syscall.SHUT_WR)
+	}
+}
+
+func (c *Conn) handleClose() {
+	if !c.connected {
+		return
+	}
+	c.connected = false
+	syscall.EpollCtl(c.l.epfd, syscall.EPOLL_CTL_DEL, c.fd, nil)
+	syscall.Close(c.fd)
+	delete(c.l.conns, c.fd)
+	if cb := c.l.r.connectionCallback; cb != nil {
+		cb(c)
+	}
+}
@@ -0,0 +1,29 @@
+// Package reactor is an edge-triggered epoll reactor for Linux which
+// reads from sockets directly into netbuffer.Buffers, without a goroutine
+// per connection.
+//
+// A Reactor runs a few loops, each a goroutine waiting on its own epoll
+// instance. The first loop also accepts connections, which are handed to
+// the loops in turn. As in muduo's readFd, a read is a readv into the
+// writable bytes of the input buffer of a connection plus a 64 KiB spill
+// buffer shared by the connections of the loop, so that input buffers
+// start small and grow only as needed. Writes drain the output buffer
+// until the socket would block, and resume when epoll reports it
+// writable.
+//
+//	r, err := reactor.New(4)
+//	...
+//	addr, err := r.Listen("127.0.0.1:9000")
+//	r.SetMessageCallback(func(c *reactor.Conn, input *netbuffer.Buffer) {
+//		c.Send(input.PeekAllAsByteSlice())
+//		input.RetrieveAll()
+//	})
+//	go r.Run()
+//	...
+//	r.Stop()
+//
+// Callbacks run on the loop goroutine of their connection, which owns its
+// buffers. From other goroutines, reach a connection with Conn.Do.
+//
+// The package is only built on Linux.
+package reactor
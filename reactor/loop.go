@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package reactor
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// loop is an event loop: a goroutine waiting on an epoll instance, which
+// owns the connections registered with it.
+type loop struct {
+	r         *Reactor
+	epfd      int
+	wakefd    int // eventfd, readable when pending has work or stopping
+	listeners map[int]bool
+	conns     map[int]*Conn
+	spill     []byte
+	stopping  int32
+
+	mu      sync.Mutex
+	pending []func() // functions to run on the loop, queued by other goroutines
+	closed  bool     // wakefd is closed, and its number may be reused
+}
+
+func newLoop(r *Reactor) (*loop, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wakefd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		syscall.Close(epfd)
+		return nil, errno
+	}
+	l := &loop{
+		r:         r,
+		epfd:      epfd,
+		wakefd:    int(wakefd),
+		listeners: make(map[int]bool),
+		conns:     make(map[int]*Conn),
+		spill:     make([]byte, spillSize),
+	}
+	if err := l.add(l.wakefd, syscall.EPOLLIN); err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// add registers fd for edge-triggered events.
+func (l *loop) add(fd int, events uint32) error {
+	ev := syscall.EpollEvent{Events: events | epollET, Fd: int32(fd)}
+	return syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+}
+
+// queue runs f on the loop goroutine.
+func (l *loop) queue(f func()) {
+	l.mu.Lock()
+	l.pending = append(l.pending, f)
+	l.mu.Unlock()
+	l.wake()
+}
+
+// wake interrupts the epoll wait of the loop. It may be called from any
+// goroutine, also after close, when it does nothing.
+func (l *loop) wake() {
+	var one [8]byte
+	binary.LittleEndian.PutUint64(one[:], 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		syscall.Write(l.wakefd, one[:]) // EAGAIN means a wakeup is pending already
+	}
+}
+
+func (l *loop) stop() {
+	atomic.StoreInt32(&l.stopping, 1)
+	l.wake()
+}
+
+func (l *loop) run() error {
+	events := make([]syscall.EpollEvent, maxEvents)
+	for atomic.LoadInt32(&l.stopping) == 0 {
+		n, err := syscall.EpollWait(l.epfd, events, -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			l.shutdown()
+			return err
+		}
+		for _, ev := range events[:n] {
+			fd := int(ev.Fd)
+			switch {
+			case fd == l.wakefd:
+				var buf [8]byte
+				syscall.Read(l.wakefd, buf[:])
+			case l.listeners[fd]:
+				l.accept(fd)
+			default:
+				if c := l.conns[fd]; c != nil {
+					c.handleEvent(ev.Events)
+				}
+			}
+		}
+		l.runPending()
+	}
+	l.shutdown()
+	return nil
+}
+
+func (l *loop) runPending() {
+	for {
+		l.mu.Lock()
+		pending := l.pending
+		l.pending = nil
+		l.mu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for _, f := range pending {
+			f()
+		}
+	}
+}
+
+// accept accepts the pending connections of listener fd, until it would
+// block.
+func (l *loop) accept(fd int) {
+	for {
+		nfd, sa, err := syscall.Accept4(fd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		if err == syscall.EINTR || err == syscall.ECONNABORTED {
+			continue
+		}
+		if err != nil {
+			// EAGAIN, or out of file descriptors, which the next
+			// connection attempt retries
+			return
+		}
+		syscall.SetsockoptInt(nfd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
+		owner := l.r.nextLoop()
+		c := newConn(owner, nfd, tcpAddrOf(sa))
+		if owner == l {
+			owner.establish(c)
+		} else {
+			owner.queue(func() { owner.establish(c) })
+		}
+	}
+}
+
+func (l *loop) establish(c *Conn) {
+	if atomic.LoadInt32(&l.stopping) != 0 {
+		syscall.Close(c.fd)
+		return
+	}
+	if err := l.add(c.fd, syscall.EPOLLIN|syscall.EPOLLOUT|syscall.EPOLLRDHUP); err != nil {
+		syscall.Close(c.fd)
+		return
+	}
+	l.conns[c.fd] = c
+	if cb := l.r.connectionCallback; cb != nil {
+		cb(c)
+	}
+	// bytes may have arrived before the registration
+	c.handleRead()
+}
+
+// shutdown closes the connections and listeners of the loop, on its
+// goroutine.
+func (l *loop) shutdown() {
+	l.runPending()
+	for _, c := range l.conns {
+		c.handleClose()
+	}
+	for fd := range l.listeners {
+		syscall.Close(fd)
+		delete(l.listeners, fd)
+	}
+}
+
+// close releases the epoll instance and the eventfd.
+func (l *loop) close() {
+	if l.epfd >= 0 {
+		syscall.Close(l.epfd)
+		l.epfd = -1
+	}
+	l.mu.Lock()
+	if !l.closed {
+		syscall.Close(l.wakefd)
+		l.closed = true
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,190 @@
+//go:build linux
+// +build linux
+
+package reactor
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+const (
+	epollET     = 1 << 31 // syscall.EPOLLET is negative
+	maxEvents   = 128     // events taken by one epoll_wait
+	spillSize   = 64 << 10
+	minFillRead = 1024 // least writable bytes kept in an input buffer
+)
+
+// ErrRunning is returned by Listen after Run was called.
+var ErrRunning = errors.New("reactor: already running")
+
+// ConnectionCallback is called on the loop of c when c is established and
+// when it is closed; Connected tells which.
+type ConnectionCallback func(c *Conn)
+
+// MessageCallback is called on the loop of c after bytes were read into
+// input, the input buffer of c.
+type MessageCallback func(c *Conn, input *netbuffer.Buffer)
+
+// WriteCompleteCallback is called on the loop of c when its output buffer
+// has been written to the socket entirely.
+type WriteCompleteCallback func(c *Conn)
+
+// Reactor runs event loops serving the connections accepted from its
+// listeners. Set the callbacks and listen before calling Run.
+type Reactor struct {
+	loops   []*loop
+	next    uint32 // loop of the next accepted connection
+	running int32
+
+	connectionCallback    ConnectionCallback
+	messageCallback       MessageCallback
+	writeCompleteCallback WriteCompleteCallback
+}
+
+// New returns a reactor with n event loops, at least one.
+func New(n int) (*Reactor, error) {
+	if n < 1 {
+		n = 1
+	}
+	r := &Reactor{}
+	for i := 0; i < n; i++ {
+		l, err := newLoop(r)
+		if err != nil {
+			r.closeLoops()
+			return nil, err
+		}
+		r.loops = append(r.loops, l)
+	}
+	return r, nil
+}
+
+// SetConnectionCallback sets the callback for established and closed
+// connections.
+func (r *Reactor) SetConnectionCallback(cb ConnectionCallback) {
+	r.connectionCallback = cb
+}
+
+// SetMessageCallback sets the callback for received bytes. By default
+// they are discarded.
+func (r *Reactor) SetMessageCallback(cb MessageCallback) {
+	r.messageCallback = cb
+}
+
+// SetWriteCompleteCallback sets the callback for emptied output buffers.
+func (r *Reactor) SetWriteCompleteCallback(cb WriteCompleteCallback) {
+	r.writeCompleteCallback = cb
+}
+
+// Listen listens on the TCP address addr, such as "127.0.0.1:9000" or
+// ":0", and returns the address listened on. Connections are accepted
+// once Run is called.
+func (r *Reactor) Listen(addr string) (net.Addr, error) {
+	if atomic.LoadInt32(&r.running) != 0 {
+		return nil, ErrRunning
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	family, sa := sockaddr(tcpAddr)
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := listen(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	bound, err := syscall.Getsockname(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	acceptor := r.loops[0]
+	if err := acceptor.add(fd, syscall.EPOLLIN); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	acceptor.listeners[fd] = true
+	return tcpAddrOf(bound), nil
+}
+
+func listen(fd int, sa syscall.Sockaddr) error {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return err
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return err
+	}
+	return syscall.Listen(fd, syscall.SOMAXCONN)
+}
+
+// Run runs the event loops until Stop is called.
+func (r *Reactor) Run() error {
+	if !atomic.CompareAndSwapInt32(&r.running, 0, 1) {
+		return ErrRunning
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(r.loops))
+	for i, l := range r.loops {
+		wg.Add(1)
+		go func(i int, l *loop) {
+			defer wg.Done()
+			errs[i] = l.run()
+		}(i, l)
+	}
+	wg.Wait()
+	r.closeLoops()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop makes the loops close their connections and listeners and return,
+// after which Run returns.
+func (r *Reactor) Stop() {
+	for _, l := range r.loops {
+		l.stop()
+	}
+}
+
+func (r *Reactor) closeLoops() {
+	for _, l := range r.loops {
+		l.close()
+	}
+}
+
+// nextLoop returns the loop of a newly accepted connection.
+func (r *Reactor) nextLoop() *loop {
+	return r.loops[(atomic.AddUint32(&r.next, 1)-1)%uint32(len(r.loops))]
+}
+
+func sockaddr(a *net.TCPAddr) (int, syscall.Sockaddr) {
+	if ip4 := a.IP.To4(); ip4 != nil || a.IP == nil {
+		sa := &syscall.SockaddrInet4{Port: a.Port}
+		copy(sa.Addr[:], ip4)
+		return syscall.AF_INET, sa
+	}
+	sa := &syscall.SockaddrInet6{Port: a.Port}
+	copy(sa.Addr[:], a.IP.To16())
+	return syscall.AF_INET6, sa
+}
+
+func tcpAddrOf(sa syscall.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	}
+	return nil
+}
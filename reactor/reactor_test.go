@@ -0,0 +1,196 @@
+//go:build linux
+// +build linux
+
+package reactor
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// startReactor runs a reactor of n loops listening on a loopback port
+// after setup has set its callbacks. The returned function stops it.
+func startReactor(t *testing.T, n int, setup func(r *Reactor)) (string, func()) {
+	t.Helper()
+	r, err := New(n)
+	if err != nil {
+		t.Fatalf("New error %v", err)
+	}
+	setup(r)
+	addr, err := r.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("r.Listen error %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run()
+	}()
+	return addr.String(), func() {
+		r.Stop()
+		if err := <-done; err != nil {
+			t.Errorf("r.Run error %v", err)
+		}
+	}
+}
+
+func echo(r *Reactor) {
+	r.SetMessageCallback(func(c *Conn, input *netbuffer.Buffer) {
+		c.Send(input.PeekAllAsByteSlice())
+		input.RetrieveAll()
+	})
+}
+
+func TestEcho(t *testing.T) {
+	var mu sync.Mutex
+	up, down := 0, 0
+	addr, stop := startReactor(t, 2, func(r *Reactor) {
+		echo(r)
+		r.SetConnectionCallback(func(c *Conn) {
+			mu.Lock()
+			defer mu.Unlock()
+			if c.Connected() {
+				up++
+			} else {
+				down++
+			}
+		})
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Errorf("net.Dial error %v", err)
+				return
+			}
+			defer client.Close()
+			// large enough to go through the spill buffer and to make
+			// writes block
+			msg := bytes.Repeat([]byte{byte(i)}, 1<<20+i)
+			go func() {
+				if _, err := client.Write(msg); err != nil {
+					t.Errorf("client.Write error %v", err)
+				}
+			}()
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(client, got); err != nil || !bytes.Equal(got, msg) {
+				t.Errorf("client %d: echo differs, read error %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if up != 8 || down != 8 {
+		t.Errorf("connection callback called %d times up and %d times down, want 8 and 8", up, down)
+	}
+}
+
+func TestShutdownAndDo(t *testing.T) {
+	conns := make(chan *Conn, 1)
+	completed := make(chan struct{}, 1)
+	addr, stop := startReactor(t, 1, func(r *Reactor) {
+		r.SetConnectionCallback(func(c *Conn) {
+			if c.Connected() {
+				conns <- c
+			}
+		})
+		r.SetWriteCompleteCallback(func(c *Conn) {
+			select {
+			case completed <- struct{}{}:
+			default:
+			}
+		})
+	})
+	defer stop()
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	defer client.Close()
+	c := <-conns
+
+	// Send from another goroutine goes through Do
+	c.Do(func(c *Conn) {
+		c.Send([]byte("hello"))
+		c.Shutdown()
+		c.Send([]byte("dropped"))
+	})
+	got, err := ioutil.ReadAll(client)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("client read %q, %v, want %q", got, err, "hello")
+	}
+	select {
+	case <-completed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("write complete callback not called")
+	}
+}
+
+func TestStopClosesConnections(t *testing.T) {
+	connected := make(chan struct{}, 1)
+	addr, stop := startReactor(t, 1, func(r *Reactor) {
+		r.SetConnectionCallback(func(c *Conn) {
+			if c.Connected() {
+				connected <- struct{}{}
+			}
+		})
+	})
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	defer client.Close()
+	<-connected
+	stop()
+
+	if _, err := ioutil.ReadAll(client); err != nil {
+		t.Errorf("client read error %v after Stop", err)
+	}
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Errorf("net.Dial after Stop succeeded")
+	}
+}
+
+func TestStopWhileClosing(t *testing.T) {
+	r, err := New(2)
+	if err != nil {
+		t.Fatalf("New error %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run()
+	}()
+	// Stop wakes the loops while Run closes their eventfds
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("r.Run error %v", err)
+				}
+				r.Stop()
+				return
+			default:
+				r.Stop()
+			}
+		}
+	}()
+	<-stopped
+}
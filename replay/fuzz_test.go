@@ -0,0 +1,52 @@
+//go:build go1.18
+// +build go1.18
+
+package replay
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func FuzzReplayer(f *testing.F) {
+	f.Add([]byte(header + "\x03abc\x00\x01d"))
+	f.Add([]byte(header + "\xff\xff\xff\xff\x0f"))
+	f.Add([]byte(header[:5]))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var chunks [][]byte
+		buf := netbuffer.NewBuffer()
+		p := NewReplayer(bytes.NewReader(data))
+		for {
+			before := buf.ReadableBytes()
+			n, err := p.Next(buf)
+			if err != nil {
+				if buf.ReadableBytes() != before {
+					t.Fatalf("failed Next appended %d bytes", buf.ReadableBytes()-before)
+				}
+				if err == io.EOF {
+					break
+				}
+				return
+			}
+			chunks = append(chunks, append([]byte(nil), buf.PeekAllAsByteSlice()[before:before+n]...))
+		}
+
+		// a valid recording written back replays the same chunks
+		var out bytes.Buffer
+		r := NewRecorder(&out)
+		for _, c := range chunks {
+			r.Appended(c)
+		}
+		buf = netbuffer.NewBuffer()
+		p = NewReplayer(&out)
+		for i, c := range chunks {
+			before := buf.ReadableBytes()
+			if n, err := p.Next(buf); err != nil || !bytes.Equal(buf.PeekAllAsByteSlice()[before:before+n], c) {
+				t.Fatalf("chunk %d written back replays as %x, %v, want %x", i, buf.PeekAllAsByteSlice()[before:], err, c)
+			}
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Package replay records the chunks appended to a netbuffer.Buffer and
+// replays them into another Buffer, so that a decoder sees the same
+// partial frames in a test as it saw in production.
+//
+// Record the input buffer of a connection with a Recorder as its Tap:
+//
+//	rec := replay.NewRecorder(f)
+//	input.SetTap(rec)
+//
+// and replay the file in a test, decoding after every chunk:
+//
+//	err := replay.NewReplayer(f).ReplayAll(buf, func(buf *netbuffer.Buffer) error {
+//		return decodeAll(buf)
+//	})
+//
+// The file holds a header, then each chunk as its uvarint length followed
+// by its bytes.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// header begins every recording, with the version in its last byte.
+const header = "netbuffer replay\x01"
+
+// maxChunk limits the length of a chunk read back. The chunk is read as
+// its bytes arrive, so that a corrupt length in a recording does not
+// allocate more than the bytes which follow it.
+const maxChunk = 1 << 30
+
+var (
+	// ErrBadHeader is returned by a Replayer when the recording does not
+	// begin with the header of a supported version.
+	ErrBadHeader = errors.New("replay: bad header")
+	// ErrBadChunk is returned by a Replayer for a truncated or corrupt
+	// chunk.
+	ErrBadChunk = errors.New("replay: bad chunk")
+)
+
+// Recorder writes the chunks appended to the buffers it taps. It is a
+// netbuffer.Tap which ignores retrieved bytes, and is safe for concurrent
+// use.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	err     error // first write error
+	started bool
+}
+
+// NewRecorder returns a Recorder writing to w. The header is written
+// with the first chunk.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Appended records p as one chunk.
+func (r *Recorder) Appended(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		r.started = true
+		r.write([]byte(header))
+	}
+	var n [binary.MaxVarintLen64]byte
+	r.write(n[:binary.PutUvarint(n[:], uint64(len(p)))])
+	r.write(p)
+}
+
+// Retrieved does nothing.
+func (r *Recorder) Retrieved(p []byte) {}
+
+// Err returns the first error writing the recording, or nil.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(p []byte) {
+	if r.err == nil {
+		_, r.err = r.w.Write(p)
+	}
+}
+
+// Replayer reads a recording written by a Recorder.
+type Replayer struct {
+	r       *bufio.Reader
+	started bool
+	chunk   bytes.Buffer // the chunk being read
+}
+
+// NewReplayer returns a Replayer reading from r.
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{r: bufio.NewReader(r)}
+}
+
+// Next appends the next chunk of the recording to b and returns its
+// length. At the end of the recording it returns io.EOF.
+func (p *Replayer) Next(b *netbuffer.Buffer) (int, error) {
+	if !p.started {
+		h := make([]byte, len(header))
+		if _, err := io.ReadFull(p.r, h); err != nil {
+			if err == io.EOF {
+				// an empty recording, nothing was appended
+				return 0, io.EOF
+			}
+			return 0, ErrBadHeader
+		}
+		if string(h) != header {
+			return 0, ErrBadHeader
+		}
+		p.started = true
+	}
+
+	n, err := binary.ReadUvarint(p.r)
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil || n > maxChunk {
+		return 0, ErrBadChunk
+	}
+	p.chunk.Reset()
+	if _, err := io.CopyN(&p.chunk, p.r, int64(n)); err != nil {
+		return 0, ErrBadChunk
+	}
+	b.Append(p.chunk.Bytes())
+	return int(n), nil
+}
+
+// ReplayAll appends the chunks of the recording to b one by one, calling
+// fn after each. It stops at the first error of fn, and returns nil at
+// the end of the recording.
+func (p *Replayer) ReplayAll(b *netbuffer.Buffer, fn func(b *netbuffer.Buffer) error) error {
+	for {
+		if _, err := p.Next(b); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+}
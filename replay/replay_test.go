@@ -0,0 +1,106 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var rec bytes.Buffer
+	r := NewRecorder(&rec)
+	input := netbuffer.NewBuffer()
+	input.SetTap(r)
+
+	chunks := []string{"\x00\x03ab", "c\x00", "\x02de", "", "\x00\x01f"}
+	for _, c := range chunks {
+		input.AppendString(c)
+		input.Retrieve(1) // not recorded
+	}
+	if err := input.AppendUint16(0x0001); err != nil {
+		t.Fatalf("input.AppendUint16 error %v", err)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Recorder error %v", err)
+	}
+
+	calls := 0
+	var frames []string
+	buf := netbuffer.NewBuffer()
+	err := NewReplayer(bytes.NewReader(rec.Bytes())).ReplayAll(buf, func(b *netbuffer.Buffer) error {
+		calls++
+		for b.ReadableBytes() >= 2 {
+			n, _ := b.PeekUint16()
+			if b.ReadableBytes() < 2+int(n) {
+				break
+			}
+			frames = append(frames, string(b.PeekAsByteSlice(2 + int(n))[2:]))
+			b.Retrieve(2 + int(n))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayAll error %v", err)
+	}
+	if calls != len(chunks)+1 {
+		t.Errorf("replayed %d chunks, want %d", calls, len(chunks)+1)
+	}
+	if want := []string{"abc", "de", "f"}; len(frames) != len(want) || frames[0] != want[0] || frames[1] != want[1] || frames[2] != want[2] {
+		t.Errorf("decoded frames %q, want %q", frames, want)
+	}
+	if string(buf.PeekAllAsByteSlice()) != "\x00\x01" {
+		t.Errorf("left %q in the buffer, want %q", buf.PeekAllAsByteSlice(), "\x00\x01")
+	}
+
+	// Next replays the chunks with their lengths
+	p := NewReplayer(bytes.NewReader(rec.Bytes()))
+	buf = netbuffer.NewBuffer()
+	for i, c := range append(chunks, "\x00\x01") {
+		n, err := p.Next(buf)
+		if err != nil || n != len(c) {
+			t.Fatalf("chunk %d: Next returned %d, %v, want %d, nil", i, n, err, len(c))
+		}
+	}
+	if _, err := p.Next(buf); err != io.EOF {
+		t.Errorf("Next at the end returned %v, want io.EOF", err)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	buf := netbuffer.NewBuffer()
+	if _, err := NewReplayer(bytes.NewReader(nil)).Next(buf); err != io.EOF {
+		t.Errorf("Next of an empty recording returned %v, want io.EOF", err)
+	}
+	if _, err := NewReplayer(bytes.NewReader([]byte("netbuffer replay\x09\x01a"))).Next(buf); err != ErrBadHeader {
+		t.Errorf("Next of an unknown version returned %v, want %v", err, ErrBadHeader)
+	}
+	if _, err := NewReplayer(bytes.NewReader([]byte(header + "\x05ab"))).Next(buf); err != ErrBadChunk {
+		t.Errorf("Next of a truncated chunk returned %v, want %v", err, ErrBadChunk)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := NewReplayer(bytes.NewReader([]byte(header + "\x80\x80\x80\x80\x04ab"))).Next(buf); err != ErrBadChunk {
+		t.Errorf("Next of a truncated 1 GiB chunk returned %v, want %v", err, ErrBadChunk)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Next of a truncated 1 GiB chunk allocated %d bytes", n)
+	}
+	if buf.ReadableBytes() != 0 {
+		t.Errorf("failed Next appended %d bytes", buf.ReadableBytes())
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := NewReplayer(bytes.NewReader([]byte(header+"\x01a\x01b"))).ReplayAll(buf, func(*netbuffer.Buffer) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("ReplayAll returned %v after %d calls, want %v after 1", err, calls, errStop)
+	}
+}
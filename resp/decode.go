@@ -0,0 +1,242 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+const (
+	maxLine  = 64 << 10  // longest line other than a bulk string
+	maxBulk  = 512 << 20 // longest bulk string, as Redis' proto-max-bulk-len
+	maxDepth = 128       // deepest nesting of aggregates
+)
+
+// errShort is returned by parse when the data ends inside the value.
+var errShort = errors.New("resp: short")
+
+// Decode removes one value from the beginning of the readable bytes of b
+// and returns it. If they hold no whole value, it returns
+// netbuffer.ErrShortBuffer and leaves b unchanged. Release the value when
+// done with its bulk strings.
+func Decode(b *netbuffer.Buffer) (Value, error) {
+	data := b.PeekAllAsByteSlice()
+	// check the value is whole before allocating anything for it
+	p := parser{data: data}
+	if _, err := p.parse(0); err != nil {
+		if err == errShort {
+			return Value{}, netbuffer.ErrShortBuffer
+		}
+		return Value{}, err
+	}
+	n := p.off
+
+	p = parser{data: data, build: true}
+	v, err := p.parse(0)
+	if err != nil {
+		return Value{}, err
+	}
+	if p.bulks {
+		v.view = b.PeekView(n)
+	}
+	b.Retrieve(n)
+	return v, nil
+}
+
+// parser parses a value from data at off, advancing off. Unless build is
+// set, it only checks the value, without allocating.
+type parser struct {
+	data  []byte
+	off   int
+	build bool
+	bulks bool // a bulk string of data was referenced
+}
+
+// line returns the next line, without its CRLF.
+func (p *parser) line() ([]byte, error) {
+	rest := p.data[p.off:]
+	limit := rest
+	if len(limit) > maxLine+2 {
+		limit = limit[:maxLine+2]
+	}
+	i := bytes.Index(limit, []byte("\r\n"))
+	if i < 0 {
+		if len(rest) > maxLine+2 {
+			return nil, fmt.Errorf("resp: line longer than %d bytes", maxLine)
+		}
+		return nil, errShort
+	}
+	p.off += i + 2
+	return rest[:i], nil
+}
+
+func parseInt(line []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("resp: malformed integer %q", line)
+	}
+	return n, nil
+}
+
+// length parses the length of a bulk string or an aggregate, which may
+// be -1 for a RESP2 null.
+func length(line []byte, max int64) (int, error) {
+	n, err := parseInt(line)
+	if err != nil {
+		return 0, err
+	}
+	if n < -1 || n > max {
+		return 0, fmt.Errorf("resp: invalid length %d", n)
+	}
+	return int(n), nil
+}
+
+// bulk returns the next n bytes, followed by CRLF.
+func (p *parser) bulk(n int) ([]byte, error) {
+	if len(p.data)-p.off < n+2 {
+		return nil, errShort
+	}
+	data := p.data[p.off : p.off+n : p.off+n]
+	if p.data[p.off+n] != '\r' || p.data[p.off+n+1] != '\n' {
+		return nil, fmt.Errorf("resp: bulk string of %d bytes not followed by CRLF", n)
+	}
+	p.off += n + 2
+	p.bulks = true
+	return data, nil
+}
+
+func (p *parser) parse(depth int) (Value, error) {
+	if depth > maxDepth {
+		return Value{}, fmt.Errorf("resp: aggregates nested deeper than %d", maxDepth)
+	}
+	if p.off >= len(p.data) {
+		return Value{}, errShort
+	}
+	kind := Kind(p.data[p.off])
+	p.off++
+	line, err := p.line()
+	if err != nil {
+		return Value{}, err
+	}
+	v := Value{Kind: kind}
+
+	switch kind {
+	case SimpleString, Error:
+		if p.build {
+			v.Str = string(line)
+		}
+	case BigNumber:
+		if len(line) == 0 {
+			return Value{}, fmt.Errorf("resp: empty big number")
+		}
+		if p.build {
+			v.Str = string(line)
+		}
+	case Integer:
+		if v.Int, err = parseInt(line); err != nil {
+			return Value{}, err
+		}
+	case Null:
+		if len(line) != 0 {
+			return Value{}, fmt.Errorf("resp: malformed null %q", line)
+		}
+	case Boolean:
+		switch string(line) {
+		case "t":
+			v.Int = 1
+		case "f":
+		default:
+			return Value{}, fmt.Errorf("resp: malformed boolean %q", line)
+		}
+	case Double:
+		if v.Float, err = parseDouble(line); err != nil {
+			return Value{}, err
+		}
+
+	case BulkString, BulkError, VerbatimString:
+		n, err := length(line, maxBulk)
+		if err != nil {
+			return Value{}, err
+		}
+		if n < 0 {
+			if kind != BulkString {
+				return Value{}, fmt.Errorf("resp: null %c", kind)
+			}
+			v.IsNull = true
+			break
+		}
+		if v.Bulk, err = p.bulk(n); err != nil {
+			return Value{}, err
+		}
+		if kind == VerbatimString {
+			if n < 4 || v.Bulk[3] != ':' {
+				return Value{}, fmt.Errorf("resp: verbatim string without format")
+			}
+			if p.build {
+				v.Str = string(v.Bulk[:3])
+			}
+			v.Bulk = v.Bulk[4:]
+		}
+		if !p.build {
+			v.Bulk = nil
+		}
+
+	case Array, Set, Push, Map:
+		max := int64(math.MaxInt32)
+		if kind == Map {
+			// n pairs are doubled below
+			max /= 2
+		}
+		n, err := length(line, max)
+		if err != nil {
+			return Value{}, err
+		}
+		if n < 0 {
+			if kind != Array {
+				return Value{}, fmt.Errorf("resp: null %c", kind)
+			}
+			v.IsNull = true
+			break
+		}
+		if kind == Map {
+			n *= 2
+		}
+		if p.build {
+			// the check pass made sure data holds n values
+			v.Elems = make([]Value, n)
+		}
+		for i := 0; i < n; i++ {
+			elem, err := p.parse(depth + 1)
+			if err != nil {
+				return Value{}, err
+			}
+			if p.build {
+				v.Elems[i] = elem
+			}
+		}
+
+	default:
+		return Value{}, fmt.Errorf("resp: unknown type byte %q", byte(kind))
+	}
+	return v, nil
+}
+
+func parseDouble(line []byte) (float64, error) {
+	switch string(line) {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(string(line), 64)
+	if err != nil {
+		return 0, fmt.Errorf("resp: malformed double %q", line)
+	}
+	return f, nil
+}
@@ -0,0 +1,174 @@
+package resp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// AppendCommand appends a command, an array of bulk strings, to b, as a
+// client sends it.
+func AppendCommand(b *netbuffer.Buffer, args ...string) {
+	appendHeader(b, Array, len(args))
+	for _, arg := range args {
+		appendHeader(b, BulkString, len(arg))
+		b.AppendString(arg)
+		b.AppendString("\r\n")
+	}
+}
+
+// AppendCommandBytes is AppendCommand with arguments of type []byte.
+func AppendCommandBytes(b *netbuffer.Buffer, args ...[]byte) {
+	appendHeader(b, Array, len(args))
+	for _, arg := range args {
+		AppendBulkString(b, arg)
+	}
+}
+
+// AppendSimpleString appends s, which must not contain CR or LF.
+func AppendSimpleString(b *netbuffer.Buffer, s string) {
+	appendLine(b, SimpleString, s)
+}
+
+// AppendError appends the error message msg, which must not contain CR
+// or LF.
+func AppendError(b *netbuffer.Buffer, msg string) {
+	appendLine(b, Error, msg)
+}
+
+// AppendInteger appends n.
+func AppendInteger(b *netbuffer.Buffer, n int64) {
+	appendLine(b, Integer, strconv.FormatInt(n, 10))
+}
+
+// AppendBulkString appends p as a bulk string.
+func AppendBulkString(b *netbuffer.Buffer, p []byte) {
+	appendHeader(b, BulkString, len(p))
+	b.Append(p)
+	b.AppendString("\r\n")
+}
+
+// AppendNullBulkString appends the RESP2 null, "$-1".
+func AppendNullBulkString(b *netbuffer.Buffer) {
+	appendHeader(b, BulkString, -1)
+}
+
+// AppendAggregateHeader appends the header of an aggregate of kind Array,
+// Set, Push or Map, followed by n elements, or n pairs for a Map, to be
+// appended next.
+func AppendAggregateHeader(b *netbuffer.Buffer, kind Kind, n int) {
+	appendHeader(b, kind, n)
+}
+
+// AppendValue appends v, and its elements. If v or one of its elements
+// cannot be encoded, such as a SimpleString holding CR or LF, it returns
+// an error and appends nothing.
+func AppendValue(b *netbuffer.Buffer, v Value) error {
+	if err := checkValue(v); err != nil {
+		return err
+	}
+	appendValue(b, v)
+	return nil
+}
+
+// checkValue returns an error if v or one of its elements cannot be
+// encoded.
+func checkValue(v Value) error {
+	switch v.Kind {
+	case SimpleString, Error, BigNumber:
+		if strings.ContainsAny(v.Str, "\r\n") {
+			return fmt.Errorf("resp: %c value holds CR or LF", v.Kind)
+		}
+	case Integer, Null, Boolean, Double, BulkString, BulkError:
+	case VerbatimString:
+		if len(v.Str) != 3 {
+			return fmt.Errorf("resp: verbatim string format %q is not 3 bytes", v.Str)
+		}
+	case Array, Set, Push, Map:
+		if v.Kind == Map && len(v.Elems)%2 != 0 {
+			return fmt.Errorf("resp: map of %d keys and values", len(v.Elems))
+		}
+		for _, elem := range v.Elems {
+			if err := checkValue(elem); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("resp: unknown kind %q", byte(v.Kind))
+	}
+	return nil
+}
+
+// appendValue appends v, checked by checkValue.
+func appendValue(b *netbuffer.Buffer, v Value) {
+	switch v.Kind {
+	case SimpleString, Error, BigNumber:
+		appendLine(b, v.Kind, v.Str)
+	case Integer:
+		AppendInteger(b, v.Int)
+	case Null:
+		appendLine(b, v.Kind, "")
+	case Boolean:
+		if v.Int != 0 {
+			appendLine(b, v.Kind, "t")
+		} else {
+			appendLine(b, v.Kind, "f")
+		}
+	case Double:
+		appendLine(b, v.Kind, formatDouble(v.Float))
+
+	case BulkString, BulkError, VerbatimString:
+		if v.IsNull && v.Kind == BulkString {
+			AppendNullBulkString(b)
+			break
+		}
+		if v.Kind == VerbatimString {
+			appendHeader(b, v.Kind, 4+len(v.Bulk))
+			b.AppendString(v.Str)
+			b.AppendString(":")
+		} else {
+			appendHeader(b, v.Kind, len(v.Bulk))
+		}
+		b.Append(v.Bulk)
+		b.AppendString("\r\n")
+
+	case Array, Set, Push, Map:
+		if v.IsNull && v.Kind == Array {
+			appendHeader(b, Array, -1)
+			break
+		}
+		n := len(v.Elems)
+		if v.Kind == Map {
+			n /= 2
+		}
+		appendHeader(b, v.Kind, n)
+		for _, elem := range v.Elems {
+			appendValue(b, elem)
+		}
+	}
+}
+
+func appendLine(b *netbuffer.Buffer, kind Kind, s string) {
+	b.Append([]byte{byte(kind)})
+	b.AppendString(s)
+	b.AppendString("\r\n")
+}
+
+func appendHeader(b *netbuffer.Buffer, kind Kind, n int) {
+	appendLine(b, kind, strconv.Itoa(n))
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
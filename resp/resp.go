@@ -0,0 +1,82 @@
+// Package resp decodes and encodes the Redis serialization protocol,
+// RESP2 and RESP3, from and to netbuffer.Buffers.
+//
+// Decode takes one whole value from the readable bytes of a Buffer, or
+// returns netbuffer.ErrShortBuffer and leaves the buffer unchanged, so it
+// can be called after each read:
+//
+//	for {
+//		v, err := resp.Decode(input)
+//		if err == netbuffer.ErrShortBuffer {
+//			break
+//		}
+//		...
+//		v.Release()
+//	}
+//
+// Bulk strings of a decoded value are not copied: they alias the storage
+// of the buffer, which a netbuffer.View keeps from being reused until the
+// value is released.
+package resp
+
+import (
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Kind is the type of a value, as given by its first byte.
+type Kind byte
+
+// RESP2 kinds.
+const (
+	SimpleString Kind = '+'
+	Error        Kind = '-'
+	Integer      Kind = ':'
+	BulkString   Kind = '$'
+	Array        Kind = '*'
+)
+
+// RESP3 kinds.
+const (
+	Null           Kind = '_'
+	Boolean        Kind = '#'
+	Double         Kind = ','
+	BigNumber      Kind = '('
+	BulkError      Kind = '!'
+	VerbatimString Kind = '='
+	Map            Kind = '%'
+	Set            Kind = '~'
+	Push           Kind = '>'
+)
+
+// Value is a RESP value. Which fields are used depends on Kind.
+type Value struct {
+	Kind Kind
+	// Str holds a SimpleString, an Error, the digits of a BigNumber, and
+	// the format of a VerbatimString, such as "txt".
+	Str string
+	// Bulk holds a BulkString, a BulkError and the text of a
+	// VerbatimString. In a decoded value it must not be modified, nor
+	// used after Release.
+	Bulk []byte
+	// Int holds an Integer, and a Boolean as 0 or 1.
+	Int int64
+	// Float holds a Double.
+	Float float64
+	// Elems holds the elements of an Array, a Set or a Push, and the keys
+	// and values of a Map in turn.
+	Elems []Value
+	// IsNull reports a RESP2 null bulk string or null array, "$-1" and
+	// "*-1", of Kind BulkString or Array.
+	IsNull bool
+
+	view *netbuffer.View // keeps the bulk strings of a decoded value
+}
+
+// Release tells the buffer a value was decoded from that its bulk
+// strings are no longer used. It does nothing for other values.
+func (v *Value) Release() {
+	if v.view != nil {
+		v.view.Release()
+		v.view = nil
+	}
+}
@@ -0,0 +1,186 @@
+package resp
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func TestAppendCommand(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	AppendCommand(b, "SET", "key", "")
+	AppendCommandBytes(b, []byte("GET"), []byte("key"))
+	want := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$0\r\n\r\n*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"
+	if got := string(b.PeekAllAsByteSlice()); got != want {
+		t.Errorf("appended %q, want %q", got, want)
+	}
+}
+
+func TestAppendReplies(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	AppendSimpleString(b, "OK")
+	AppendError(b, "ERR unknown command")
+	AppendInteger(b, -42)
+	AppendBulkString(b, []byte("a\r\nb"))
+	AppendNullBulkString(b)
+	AppendAggregateHeader(b, Map, 1)
+	AppendSimpleString(b, "k")
+	AppendInteger(b, 1)
+	want := "+OK\r\n-ERR unknown command\r\n:-42\r\n$4\r\na\r\nb\r\n$-1\r\n%1\r\n+k\r\n:1\r\n"
+	if got := string(b.PeekAllAsByteSlice()); got != want {
+		t.Errorf("appended %q, want %q", got, want)
+	}
+}
+
+// testValue holds every kind of value.
+var testValue = Value{Kind: Array, Elems: []Value{
+	{Kind: SimpleString, Str: "OK"},
+	{Kind: Error, Str: "ERR bad"},
+	{Kind: Integer, Int: math.MinInt64},
+	{Kind: BulkString, Bulk: []byte("bulk\r\nwith CRLF")},
+	{Kind: BulkString, Bulk: []byte{}},
+	{Kind: BulkString, IsNull: true},
+	{Kind: Array, IsNull: true},
+	{Kind: Null},
+	{Kind: Boolean, Int: 1},
+	{Kind: Boolean},
+	{Kind: Double, Float: 3.25},
+	{Kind: Double, Float: math.Inf(-1)},
+	{Kind: BigNumber, Str: "3492890328409238509324850943850943825024385"},
+	{Kind: BulkError, Bulk: []byte("SYNTAX invalid")},
+	{Kind: VerbatimString, Str: "txt", Bulk: []byte("Some string")},
+	{Kind: Map, Elems: []Value{
+		{Kind: SimpleString, Str: "first"}, {Kind: Integer, Int: 1},
+		{Kind: BulkString, Bulk: []byte("second")}, {Kind: Set, Elems: []Value{{Kind: Integer, Int: 2}}},
+	}},
+	{Kind: Push, Elems: []Value{{Kind: BulkString, Bulk: []byte("message")}}},
+	{Kind: Array, Elems: []Value{}},
+}}
+
+// clearViews drops the views of decoded values so that they compare
+// equal to testValue.
+func clearViews(v *Value) {
+	v.view = nil
+	for i := range v.Elems {
+		clearViews(&v.Elems[i])
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	encoded := netbuffer.NewBuffer()
+	if err := AppendValue(encoded, testValue); err != nil {
+		t.Fatalf("AppendValue error %v", err)
+	}
+	data := append([]byte(nil), encoded.PeekAllAsByteSlice()...)
+
+	// fed a byte at a time, the value is only decoded once whole
+	b := netbuffer.NewBuffer()
+	for i := 0; i < len(data)-1; i++ {
+		b.Append(data[i : i+1])
+		if _, err := Decode(b); err != netbuffer.ErrShortBuffer {
+			t.Fatalf("Decode of %d bytes error %v, want %v", i+1, err, netbuffer.ErrShortBuffer)
+		}
+		if b.ReadableBytes() != i+1 {
+			t.Fatalf("Decode of a partial value left %d bytes, want %d", b.ReadableBytes(), i+1)
+		}
+	}
+	b.Append(data[len(data)-1:])
+	b.AppendString("+next\r\n")
+	v, err := Decode(b)
+	if err != nil {
+		t.Fatalf("Decode error %v", err)
+	}
+	if b.ReadableBytes() != len("+next\r\n") {
+		t.Errorf("Decode left %d bytes, want %d", b.ReadableBytes(), len("+next\r\n"))
+	}
+
+	// bulk strings survive later writes to the buffer until released
+	bulk := v.Elems[3].Bulk
+	b.RetrieveAll()
+	b.Append(make([]byte, 4096))
+	if string(bulk) != "bulk\r\nwith CRLF" {
+		t.Errorf("bulk string changed to %q by a write to the buffer", bulk)
+	}
+	v.Release()
+	clearViews(&v)
+	if !reflect.DeepEqual(v, testValue) {
+		t.Errorf("decoded %+v, want %+v", v, testValue)
+	}
+}
+
+func TestDecodeWithoutBulkStrings(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	b.AppendString(":1\r\n")
+	v, err := Decode(b)
+	if err != nil || v.Kind != Integer || v.Int != 1 || v.view != nil {
+		t.Errorf("Decode returned %+v, %v", v, err)
+	}
+	v.Release()
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []string{
+		"?\r\n",
+		":x\r\n",
+		"$-2\r\n",
+		"$3\r\nabcd\r\n",
+		"$536870913\r\n",
+		"*-2\r\n",
+		"%-1\r\n",
+		"%2147483647\r\n",
+		"!-1\r\n",
+		"#x\r\n",
+		",one\r\n",
+		"_x\r\n",
+		"(\r\n",
+		"=3\r\ntxt\r\n",
+		"*1\r\n:x\r\n",
+	}
+	for _, input := range cases {
+		b := netbuffer.NewBuffer()
+		b.AppendString(input)
+		if v, err := Decode(b); err == nil || err == netbuffer.ErrShortBuffer {
+			t.Errorf("Decode of %q returned %+v, %v", input, v, err)
+		}
+	}
+
+	deep := netbuffer.NewBuffer()
+	for i := 0; i <= maxDepth+1; i++ {
+		deep.AppendString("*1\r\n")
+	}
+	deep.AppendString(":1\r\n")
+	if _, err := Decode(deep); err == nil || err == netbuffer.ErrShortBuffer {
+		t.Errorf("Decode of deeply nested arrays error %v", err)
+	}
+
+	long := netbuffer.NewBuffer()
+	long.AppendString("+")
+	long.Append(make([]byte, maxLine+3))
+	if _, err := Decode(long); err == nil || err == netbuffer.ErrShortBuffer {
+		t.Errorf("Decode of a long line error %v", err)
+	}
+}
+
+func TestAppendValueErrors(t *testing.T) {
+	cases := []Value{
+		{Kind: 'x'},
+		{Kind: VerbatimString, Str: "text"},
+		{Kind: Map, Elems: []Value{{Kind: Null}}},
+		{Kind: Array, Elems: []Value{{Kind: 'x'}}},
+		{Kind: SimpleString, Str: "OK\r\n+PWNED"},
+		{Kind: Error, Str: "ERR\n"},
+		{Kind: BigNumber, Str: "1\r2"},
+		{Kind: Array, Elems: []Value{{Kind: Integer, Int: 1}, {Kind: Map, Elems: []Value{{Kind: Null}}}}},
+	}
+	for _, v := range cases {
+		b := netbuffer.NewBuffer()
+		if err := AppendValue(b, v); err == nil {
+			t.Errorf("AppendValue of %+v succeeded", v)
+		}
+		if b.ReadableBytes() != 0 {
+			t.Errorf("failed AppendValue of %+v appended %q", v, b.PeekAllAsByteSlice())
+		}
+	}
+}
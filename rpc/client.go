@@ -0,0 +1,210 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// call is a call waiting for its response.
+type call struct {
+	reply interface{}
+	err   error
+	done  chan struct{} // closed when err is set
+}
+
+// Client makes calls over one connection. Calls may be made concurrently;
+// their responses may arrive in any order.
+type Client struct {
+	conn    *netbuffer.Conn
+	timeout time.Duration
+
+	// writeSem holds a token while a request is written to conn, so
+	// that calls waiting to write give up when their context is done.
+	writeSem chan struct{}
+
+	mu      sync.Mutex // guards the fields below
+	seq     uint32
+	pending map[uint32]*call
+	err     error // why the client stopped, if it did
+}
+
+// NewClient returns a client making calls over conn, and starts reading
+// the responses.
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:     netbuffer.NewConn(conn),
+		writeSem: make(chan struct{}, 1),
+		pending:  make(map[uint32]*call),
+	}
+	go c.readLoop()
+	return c
+}
+
+// SetTimeout sets the timeout of the calls whose context has no deadline.
+// A zero d means no timeout, which is the default.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.mu.Lock()
+	c.timeout = d
+	c.mu.Unlock()
+}
+
+// Call calls method with args and decodes the response into reply, a
+// pointer, unless reply is nil. It returns a ServerError if the handler
+// failed, and ctx.Err() if ctx is done first, after which a response to
+// the call is discarded. The deadline of ctx also limits writing the
+// request; if it passes with the request partly written, the client is
+// closed with the write error.
+func (c *Client) Call(ctx context.Context, method uint16, args, reply interface{}) error {
+	body := netbuffer.NewBuffer()
+	if args != nil {
+		if err := encode(body, args); err != nil {
+			return err
+		}
+	}
+
+	cl := &call{reply: reply, done: make(chan struct{})}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	c.seq++
+	seq := c.seq
+	c.pending[seq] = cl
+	c.mu.Unlock()
+
+	n, err := c.send(ctx, seq, method, body)
+	switch {
+	case err == nil:
+	case n == 0 && (ctx.Err() != nil || isTimeout(err)):
+		// nothing was written, the connection carries on
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return context.DeadlineExceeded
+	default:
+		// a frame cut short leaves the connection unusable
+		c.stop(err)
+	}
+
+	select {
+	case <-cl.done:
+		return cl.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		_, waiting := c.pending[seq]
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		if waiting {
+			return ctx.Err()
+		}
+		// the response is being decoded into reply
+		<-cl.done
+		return cl.err
+	}
+}
+
+// send writes the request frame, waiting for the calls writing before it
+// until ctx is done, and limiting the write to the deadline of ctx. It
+// returns count of byte written.
+func (c *Client) send(ctx context.Context, seq uint32, method uint16, body *netbuffer.Buffer) (int64, error) {
+	select {
+	case c.writeSem <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	defer func() { <-c.writeSem }()
+
+	conn := c.conn.NetConn()
+	deadline, _ := ctx.Deadline() // no deadline is the zero time
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return writeFrame(conn, seq, method, kindRequest, body)
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// Close closes the connection. Pending calls return ErrClosed.
+func (c *Client) Close() error {
+	return c.stop(ErrClosed)
+}
+
+// stop fails the pending calls and the next calls with err, and closes
+// the connection, unless the client was stopped already.
+func (c *Client) stop(err error) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.err = err
+	pending := c.pending
+	c.pending = make(map[uint32]*call)
+	c.mu.Unlock()
+
+	for _, cl := range pending {
+		cl.err = err
+		close(cl.done)
+	}
+	return c.conn.Close()
+}
+
+func (c *Client) readLoop() {
+	input := c.conn.Input()
+	for {
+		if _, err := c.conn.Fill(); err != nil {
+			c.stop(err)
+			return
+		}
+		for {
+			f, err := readFrame(input)
+			if err != nil {
+				c.stop(err)
+				return
+			}
+			if f == nil {
+				break
+			}
+			c.handle(f)
+		}
+	}
+}
+
+// handle completes the call f responds to, if it is still waiting.
+func (c *Client) handle(f *frame) {
+	c.mu.Lock()
+	cl := c.pending[f.seq]
+	delete(c.pending, f.seq)
+	c.mu.Unlock()
+	if cl == nil {
+		return
+	}
+	switch {
+	case f.kind == kindError:
+		cl.err = ServerError(f.body.PeekAllAsByteSlice())
+	case f.kind != kindReply:
+		cl.err = fmt.Errorf("rpc: unexpected frame kind %d from server", f.kind)
+	case cl.reply != nil:
+		if err := netbuffer.DefaultCodec.Decode(f.body, cl.reply); err != nil {
+			cl.err = fmt.Errorf("rpc: decoding reply of method %d: %v", f.method, err)
+		}
+	}
+	close(cl.done)
+}
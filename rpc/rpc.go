@@ -0,0 +1,140 @@
+// Package rpc is a request/response layer over length prefixed frames of
+// netbuffer.Buffers, multiplexing concurrent calls over one connection.
+//
+// Each frame is a uint32 length, then a header of a uint32 sequence
+// number, a uint16 method ID and a uint8 kind, then the body. The header
+// is prepended to the encoded body in the prepend area of its Buffer, and
+// the length and the Buffer are written to the connection with one
+// writev, so that the body is not copied. A response carries the sequence number of its
+// request, and its body is the reply, or the error message of the
+// handler.
+//
+// Bodies are encoded with EncodeTo and decoded with DecodeFrom when the
+// values have them, as code generated by netbuffergen does, and with
+// netbuffer.Marshal and netbuffer.Unmarshal otherwise.
+//
+//	s := rpc.NewServer()
+//	s.Register(1, (*Args)(nil), func(ctx context.Context, args interface{}) (interface{}, error) {
+//		a := args.(*Args)
+//		return &Reply{Sum: a.A + a.B}, nil
+//	})
+//	s.SetWriteTimeout(10 * time.Second)
+//	go s.ServeConn(conn)
+//
+//	c := rpc.NewClient(conn)
+//	var reply Reply
+//	err := c.Call(ctx, 1, &Args{A: 1, B: 2}, &reply)
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+const (
+	headerSize = 4 + 2 + 1 // seq, method, kind
+	maxFrame   = 64 << 20  // largest frame accepted, without the length
+)
+
+// Kinds of frames.
+const (
+	kindRequest = iota
+	kindReply
+	kindError // the body is an error message
+)
+
+var (
+	// ErrClosed is returned by Call after the client was closed.
+	ErrClosed = errors.New("rpc: client closed")
+	// ErrFrameTooLarge is returned when a frame longer than 64 MiB
+	// arrives.
+	ErrFrameTooLarge = errors.New("rpc: frame too large")
+)
+
+// ServerError is an error returned by the handler of a call, as received
+// by the client.
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+type encoder interface {
+	EncodeTo(b *netbuffer.Buffer) error
+}
+
+func encode(b *netbuffer.Buffer, v interface{}) error {
+	if e, ok := v.(encoder); ok {
+		return e.EncodeTo(b)
+	}
+	return netbuffer.Marshal(b, v)
+}
+
+// writeFrame prepends the header to body and writes the frame to w, the
+// length and body in one writev, and returns count of byte written.
+func writeFrame(w io.Writer, seq uint32, method uint16, kind uint8, body *netbuffer.Buffer) (int64, error) {
+	if err := body.PrependUint8(kind); err != nil {
+		return 0, err
+	}
+	if err := body.PrependUint16(method); err != nil {
+		return 0, err
+	}
+	if err := body.PrependUint32(seq); err != nil {
+		return 0, err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(body.ReadableBytes()))
+	bufs := net.Buffers{length[:], body.PeekAllAsByteSlice()}
+	return bufs.WriteTo(w)
+}
+
+// frame is a received frame, its body in a Buffer of its own so that it
+// outlives the input buffer it came from.
+type frame struct {
+	seq    uint32
+	method uint16
+	kind   uint8
+	body   *netbuffer.Buffer
+}
+
+// readFrame removes the next frame from input. It returns nil if input
+// holds no whole frame yet.
+func readFrame(input *netbuffer.Buffer) (*frame, error) {
+	if input.ReadableBytes() < 4 {
+		return nil, nil
+	}
+	n, err := input.PeekUint32()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFrame {
+		return nil, ErrFrameTooLarge
+	}
+	if n < headerSize {
+		return nil, fmt.Errorf("rpc: frame of %d bytes is shorter than its header", n)
+	}
+	if input.ReadableBytes() < 4+int(n) {
+		return nil, nil
+	}
+	input.Retrieve(4)
+	f := &frame{}
+	if f.seq, err = input.ReadUint32(); err != nil {
+		return nil, err
+	}
+	if f.method, err = input.ReadUint16(); err != nil {
+		return nil, err
+	}
+	if f.kind, err = input.ReadUint8(); err != nil {
+		return nil, err
+	}
+	size := int(n) - headerSize
+	f.body = netbuffer.NewBufferWithSize(size)
+	f.body.Append(input.PeekAsByteSlice(size))
+	input.Retrieve(size)
+	return f, nil
+}
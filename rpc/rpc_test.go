@@ -0,0 +1,265 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+type addArgs struct {
+	A, B  int32
+	Delay uint16 // milliseconds the handler waits
+}
+
+type addReply struct {
+	Sum int32
+}
+
+const (
+	methodAdd = iota + 1
+	methodFail
+	methodBlock
+)
+
+// pipe serves s on one end of a net.Pipe and returns a client of the
+// other end, with the channel ServeConn returns into.
+func pipe(t *testing.T, s *Server) (*Client, chan error) {
+	t.Helper()
+	client, server := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeConn(server)
+	}()
+	return NewClient(client), served
+}
+
+func newTestServer(t *testing.T, release chan struct{}) *Server {
+	t.Helper()
+	s := NewServer()
+	register := func(id uint16, prototype interface{}, h HandlerFunc) {
+		if err := s.Register(id, prototype, h); err != nil {
+			t.Fatalf("s.Register error %v", err)
+		}
+	}
+	register(methodAdd, (*addArgs)(nil), func(ctx context.Context, args interface{}) (interface{}, error) {
+		a := args.(*addArgs)
+		time.Sleep(time.Duration(a.Delay) * time.Millisecond)
+		return &addReply{Sum: a.A + a.B}, nil
+	})
+	register(methodFail, (*addArgs)(nil), func(ctx context.Context, args interface{}) (interface{}, error) {
+		return nil, errors.New("failed on purpose")
+	})
+	register(methodBlock, (*addArgs)(nil), func(ctx context.Context, args interface{}) (interface{}, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return &addReply{}, nil
+	})
+	return s
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	c, served := pipe(t, newTestServer(t, nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int32) {
+			defer wg.Done()
+			// later calls wait less, so the responses arrive out of order
+			args := &addArgs{A: i, B: 2 * i, Delay: uint16(50-i) / 5}
+			var reply addReply
+			if err := c.Call(context.Background(), methodAdd, args, &reply); err != nil || reply.Sum != 3*i {
+				t.Errorf("call %d: got %d, %v, want %d", i, reply.Sum, err, 3*i)
+			}
+		}(int32(i))
+	}
+	wg.Wait()
+
+	if err := c.Close(); err != nil {
+		t.Errorf("c.Close error %v", err)
+	}
+	<-served
+	if err := c.Call(context.Background(), methodAdd, &addArgs{}, nil); err != ErrClosed {
+		t.Errorf("c.Call after Close error %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	c, served := pipe(t, newTestServer(t, nil))
+	defer func() {
+		c.Close()
+		<-served
+	}()
+
+	err := c.Call(context.Background(), methodFail, &addArgs{}, nil)
+	if err != ServerError("failed on purpose") {
+		t.Errorf("c.Call error %v, want the handler error", err)
+	}
+	if err := c.Call(context.Background(), 99, &addArgs{}, nil); err != ServerError("rpc: unknown method 99") {
+		t.Errorf("c.Call of an unknown method error %v", err)
+	}
+	// args too short for addArgs
+	if err := c.Call(context.Background(), methodAdd, &addReply{}, nil); err == nil {
+		t.Errorf("c.Call with bad args succeeded")
+	} else if _, ok := err.(ServerError); !ok {
+		t.Errorf("c.Call with bad args error %v is not a ServerError", err)
+	}
+}
+
+func TestTimeoutAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	c, served := pipe(t, newTestServer(t, release))
+	defer func() {
+		c.Close()
+		<-served
+	}()
+
+	c.SetTimeout(20 * time.Millisecond)
+	if err := c.Call(context.Background(), methodBlock, &addArgs{}, nil); err != context.DeadlineExceeded {
+		t.Errorf("c.Call error %v, want %v", err, context.DeadlineExceeded)
+	}
+	c.SetTimeout(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := c.Call(ctx, methodBlock, &addArgs{}, nil); err != context.Canceled {
+		t.Errorf("c.Call error %v, want %v", err, context.Canceled)
+	}
+
+	// the late responses are discarded, and the client still works
+	close(release)
+	var reply addReply
+	if err := c.Call(context.Background(), methodAdd, &addArgs{A: 1, B: 2}, &reply); err != nil || reply.Sum != 3 {
+		t.Errorf("c.Call got %d, %v, want 3", reply.Sum, err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	callWithTimeout := func(c *Client) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		return c.Call(ctx, methodAdd, &addArgs{}, nil)
+	}
+
+	// nobody reads the other end of the pipes, so writes block
+	client, server := net.Pipe()
+	c := NewClient(client)
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call(context.Background(), methodAdd, &addArgs{}, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := callWithTimeout(c); err != context.DeadlineExceeded {
+		t.Errorf("c.Call behind a blocked write error %v, want %v", err, context.DeadlineExceeded)
+	}
+	c.Close()
+	if err := <-blocked; err != ErrClosed {
+		t.Errorf("blocked c.Call error %v, want %v", err, ErrClosed)
+	}
+	server.Close()
+
+	client, server = net.Pipe()
+	c = NewClient(client)
+	defer c.Close()
+	if err := callWithTimeout(c); err != context.DeadlineExceeded {
+		t.Errorf("c.Call of a blocked write error %v, want %v", err, context.DeadlineExceeded)
+	}
+	// nothing was written, so the client still works
+	go NewServer().ServeConn(server)
+	if err := c.Call(context.Background(), methodAdd, &addArgs{}, nil); err != ServerError("rpc: unknown method 1") {
+		t.Errorf("c.Call error %v, want the unknown method error", err)
+	}
+}
+
+func TestCloseFailsPendingCalls(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c, served := pipe(t, newTestServer(t, release))
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Call(context.Background(), methodBlock, &addArgs{}, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	if err := <-errs; err != ErrClosed {
+		t.Errorf("pending c.Call error %v, want %v", err, ErrClosed)
+	}
+	<-served
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.SetWriteTimeout(20 * time.Millisecond)
+	client, server := net.Pipe()
+	defer client.Close()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeConn(server)
+	}()
+
+	// the client sends a call and never reads the reply
+	body := netbuffer.NewBuffer()
+	if err := encode(body, &addArgs{A: 1}); err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+	if _, err := writeFrame(client, 1, methodAdd, kindRequest, body); err != nil {
+		t.Fatalf("writeFrame error %v", err)
+	}
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Error("ServeConn returned nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeConn blocked on a reply nobody reads")
+	}
+
+	if err := s.Register(methodAdd+100, (*addArgs)(nil), nil); err == nil {
+		t.Error("s.Register of a nil handler succeeded")
+	}
+}
+
+func TestFrameFormat(t *testing.T) {
+	body := netbuffer.NewBuffer()
+	body.AppendString("body")
+	out := netbuffer.NewBuffer()
+	if n, err := writeFrame(out, 0x01020304, 0x0506, kindReply, body); n != 15 || err != nil {
+		t.Fatalf("writeFrame returned %d, %v", n, err)
+	}
+	want := []byte{0, 0, 0, 11, 1, 2, 3, 4, 5, 6, kindReply, 'b', 'o', 'd', 'y'}
+	if got := out.PeekAllAsByteSlice(); !bytes.Equal(got, want) {
+		t.Fatalf("frame is % x, want % x", got, want)
+	}
+
+	out.Append([]byte{0, 0, 0}) // the beginning of the next frame
+	f, err := readFrame(out)
+	if err != nil || f == nil {
+		t.Fatalf("readFrame returned %v, %v", f, err)
+	}
+	if f.seq != 0x01020304 || f.method != 0x0506 || f.kind != kindReply || string(f.body.PeekAllAsByteSlice()) != "body" {
+		t.Errorf("readFrame returned %+v", f)
+	}
+	if f, err := readFrame(out); f != nil || err != nil || out.ReadableBytes() != 3 {
+		t.Errorf("readFrame of a partial frame returned %v, %v", f, err)
+	}
+
+	tooLarge := netbuffer.NewBuffer()
+	if err := tooLarge.AppendUint32(maxFrame + 1); err != nil {
+		t.Fatalf("AppendUint32 error %v", err)
+	}
+	if _, err := readFrame(tooLarge); err != ErrFrameTooLarge {
+		t.Errorf("readFrame error %v, want %v", err, ErrFrameTooLarge)
+	}
+}
@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// HandlerFunc handles a call with its decoded args and returns the reply,
+// or an error sent to the client as a ServerError. ctx is canceled when
+// the connection of the call ends.
+type HandlerFunc func(ctx context.Context, args interface{}) (reply interface{}, err error)
+
+type method struct {
+	args    reflect.Type // element type of the registered pointer
+	handler HandlerFunc
+}
+
+// Server serves calls of the methods registered with it. Register the
+// methods, and set the write timeout, before serving.
+type Server struct {
+	methods      map[uint16]method
+	writeTimeout time.Duration
+}
+
+// NewServer returns a server without methods.
+func NewServer() *Server {
+	return &Server{methods: make(map[uint16]method)}
+}
+
+// SetWriteTimeout sets the timeout of writing each reply. If it passes,
+// the connection is closed, so that a client which does not read its
+// replies cannot block the handlers, and ServeConn, forever. A zero d
+// means no timeout, which is the default.
+func (s *Server) SetWriteTimeout(d time.Duration) {
+	s.writeTimeout = d
+}
+
+// Register registers h for the calls of method id, whose args are decoded
+// into a new value of the type of prototype, a pointer such as
+// (*Args)(nil).
+func (s *Server) Register(id uint16, prototype interface{}, h HandlerFunc) error {
+	if _, ok := s.methods[id]; ok {
+		return fmt.Errorf("rpc: method %d registered twice", id)
+	}
+	if h == nil {
+		return fmt.Errorf("rpc: nil handler of method %d", id)
+	}
+	t := reflect.TypeOf(prototype)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return fmt.Errorf("rpc: args prototype of non-pointer type %T", prototype)
+	}
+	s.methods[id] = method{args: t.Elem(), handler: h}
+	return nil
+}
+
+// ServeConn serves the calls arriving on conn, each in a goroutine of its
+// own, until reading from conn fails, and returns that error; io.EOF when
+// the client closed conn. It closes conn.
+func (s *Server) ServeConn(conn net.Conn) error {
+	sc := &serverConn{s: s, conn: netbuffer.NewConn(conn)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sc.wg.Wait()
+		conn.Close()
+	}()
+
+	input := sc.conn.Input()
+	for {
+		if _, err := sc.conn.Fill(); err != nil {
+			return err
+		}
+		for {
+			f, err := readFrame(input)
+			if err != nil {
+				return err
+			}
+			if f == nil {
+				break
+			}
+			if f.kind != kindRequest {
+				return fmt.Errorf("rpc: unexpected frame kind %d from client", f.kind)
+			}
+			sc.wg.Add(1)
+			go sc.serve(ctx, f)
+		}
+	}
+}
+
+// serverConn is a connection served by ServeConn.
+type serverConn struct {
+	s    *Server
+	conn *netbuffer.Conn
+	wg   sync.WaitGroup // running calls
+
+	writeMu sync.Mutex // serializes writes to conn
+}
+
+func (sc *serverConn) serve(ctx context.Context, f *frame) {
+	defer sc.wg.Done()
+	reply, err := sc.call(ctx, f)
+	body := netbuffer.NewBuffer()
+	kind := uint8(kindReply)
+	if err == nil && reply != nil {
+		err = encode(body, reply)
+	}
+	if err != nil {
+		body.RetrieveAll()
+		body.AppendString(err.Error())
+		kind = kindError
+	}
+
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
+	conn := sc.conn.NetConn()
+	var deadline time.Time // no deadline is the zero time
+	if d := sc.s.writeTimeout; d > 0 {
+		deadline = time.Now().Add(d)
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		sc.conn.Close()
+		return
+	}
+	if _, err := writeFrame(conn, f.seq, f.method, kind, body); err != nil {
+		// the reader sees the connection fail too
+		sc.conn.Close()
+	}
+}
+
+func (sc *serverConn) call(ctx context.Context, f *frame) (interface{}, error) {
+	m, ok := sc.s.methods[f.method]
+	if !ok {
+		return nil, fmt.Errorf("rpc: unknown method %d", f.method)
+	}
+	args := reflect.New(m.args).Interface()
+	if err := netbuffer.DefaultCodec.Decode(f.body, args); err != nil {
+		return nil, fmt.Errorf("rpc: decoding args of method %d: %v", f.method, err)
+	}
+	return m.handler(ctx, args)
+}
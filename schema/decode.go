@@ -0,0 +1,318 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Field is a decoded field, or a decoded packet or array with Children.
+type Field struct {
+	Name   string
+	Type   string // as written in the schema, or the packet name
+	Offset int    // count of byte from the beginning of the decoded packet
+	Size   int    // count of byte of the field
+
+	// Value is an int64, uint64, float64, bool, string or []byte, or nil
+	// for packets and arrays. []byte values are copies.
+	Value    interface{}
+	Children []*Field
+}
+
+// Decode decodes a packet from the beginning of the readable bytes of b
+// and removes its bytes from b.
+// If the readable bytes end in the middle of the packet, it returns
+// netbuffer.ErrShortBuffer. On error b is left unchanged.
+func (s *Schema) Decode(b *netbuffer.Buffer, packet string) (*Field, error) {
+	f, err := s.Peek(b, packet)
+	if err != nil {
+		return nil, err
+	}
+	b.Retrieve(f.Size)
+	return f, nil
+}
+
+// Peek decodes a packet from the beginning of the readable bytes of b,
+// like Decode, but does not modify b.
+func (s *Schema) Peek(b *netbuffer.Buffer, packet string) (*Field, error) {
+	p, ok := s.packets[packet]
+	if !ok {
+		return nil, fmt.Errorf("schema: unknown packet %s", packet)
+	}
+	d := &decoder{schema: s, data: b.PeekAllAsByteSlice()}
+	f, err := d.packet(packet, p)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// maxDepth is the deepest nesting of packets Decode decodes, which a
+// recursive packet does not bound.
+const maxDepth = 100
+
+type decoder struct {
+	schema *Schema
+	data   []byte
+	off    int
+	depth  int // packets being decoded
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, netbuffer.ErrShortBuffer
+	}
+	p := d.data[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+func (d *decoder) packet(name string, p *packetDef) (*Field, error) {
+	if d.depth == maxDepth {
+		return nil, fmt.Errorf("schema: packets nested deeper than %d", maxDepth)
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	f := &Field{Name: name, Type: p.name, Offset: d.off}
+	for _, fd := range p.fields {
+		child, err := d.value(fd.name, fd.text, fd.typ, f)
+		if err != nil {
+			return nil, err
+		}
+		f.Children = append(f.Children, child)
+	}
+	f.Size = d.off - f.Offset
+	return f, nil
+}
+
+// value decodes a value of type t. parent holds the earlier fields
+// referenced by counts.
+func (d *decoder) value(name, text string, t *typeDef, parent *Field) (*Field, error) {
+	start := d.off
+	f := &Field{Name: name, Type: text, Offset: start}
+	switch t.kind {
+	case kindScalar:
+		v, err := d.scalar(t.scalar)
+		if err != nil {
+			return nil, err
+		}
+		f.Value = v
+	case kindString, kindBytes:
+		n, err := d.count(t.count, parent)
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == kindString {
+			f.Value = string(p)
+		} else {
+			f.Value = append([]byte(nil), p...)
+		}
+	case kindArray:
+		n, err := d.count(t.count, parent)
+		if err != nil {
+			return nil, err
+		}
+		if t.elemMin > 0 && n > (len(d.data)-d.off)/t.elemMin {
+			// not allocating elements for bytes which are not there
+			return nil, netbuffer.ErrShortBuffer
+		}
+		elemText := text[:strings.LastIndex(text, "[")]
+		for i := 0; i < n; i++ {
+			child, err := d.value(strconv.Itoa(i), elemText, t.elem, parent)
+			if err != nil {
+				return nil, err
+			}
+			f.Children = append(f.Children, child)
+		}
+	case kindPacket:
+		p, err := d.packet(name, d.schema.packets[t.packet])
+		if err != nil {
+			return nil, err
+		}
+		p.Type = text
+		return p, nil
+	}
+	f.Size = d.off - start
+	return f, nil
+}
+
+func (d *decoder) count(c count, parent *Field) (int, error) {
+	switch c.kind {
+	case countFixed:
+		return c.n, nil
+	case countRest:
+		return len(d.data) - d.off, nil
+	case countPrefix:
+		v, err := d.scalar(c.prefix)
+		if err != nil {
+			return 0, err
+		}
+		return toCount(v)
+	}
+	ref := parent.Child(c.field)
+	if ref == nil {
+		return 0, fmt.Errorf("schema: count field %s not found", c.field)
+	}
+	return toCount(ref.Value)
+}
+
+func toCount(v interface{}) (int, error) {
+	switch x := v.(type) {
+	case uint64:
+		if x <= math.MaxInt32 {
+			return int(x), nil
+		}
+	case int64:
+		if x >= 0 && x <= math.MaxInt32 {
+			return int(x), nil
+		}
+	}
+	return 0, fmt.Errorf("schema: invalid count %v", v)
+}
+
+func (d *decoder) scalar(sc scalar) (interface{}, error) {
+	if sc.size == 0 {
+		var x int64
+		var u uint64
+		var n int
+		if sc.signed {
+			x, n = binary.Varint(d.data[d.off:])
+		} else {
+			u, n = binary.Uvarint(d.data[d.off:])
+		}
+		if n == 0 {
+			return nil, netbuffer.ErrShortBuffer
+		}
+		if n < 0 {
+			return nil, netbuffer.ErrVarintOverflow
+		}
+		d.off += n
+		if sc.signed {
+			return x, nil
+		}
+		return u, nil
+	}
+
+	p, err := d.next(sc.size)
+	if err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if sc.le {
+		order = binary.LittleEndian
+	}
+	var u uint64
+	switch sc.size {
+	case 1:
+		u = uint64(p[0])
+	case 2:
+		u = uint64(order.Uint16(p))
+	case 4:
+		u = uint64(order.Uint32(p))
+	case 8:
+		u = order.Uint64(p)
+	}
+	switch {
+	case sc.bool:
+		return u != 0, nil
+	case sc.float && sc.size == 4:
+		return float64(math.Float32frombits(uint32(u))), nil
+	case sc.float:
+		return math.Float64frombits(u), nil
+	case sc.signed:
+		shift := uint(64 - 8*sc.size)
+		return int64(u<<shift) >> shift, nil
+	}
+	return u, nil
+}
+
+// Child returns the direct child named name, or nil.
+func (f *Field) Child(name string) *Field {
+	for _, c := range f.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Get returns the field at a dot separated path of child names, such as
+// "items.0.id", or nil.
+func (f *Field) Get(path string) *Field {
+	for _, name := range strings.Split(path, ".") {
+		if f = f.Child(name); f == nil {
+			return nil
+		}
+	}
+	return f
+}
+
+// Annotations returns an annotation for each field of the tree without
+// children, named by its path as in Get, for
+// netbuffer.Buffer.DumpAnnotated. Offsets are counted from the beginning
+// of the packet, which is the beginning of the readable bytes of the
+// buffer passed to Peek.
+func (f *Field) Annotations() []netbuffer.Annotation {
+	var annotations []netbuffer.Annotation
+	var walk func(f *Field, path string)
+	walk = func(f *Field, path string) {
+		if len(f.Children) == 0 {
+			annotations = append(annotations, netbuffer.Annotation{Offset: f.Offset, Size: f.Size, Name: path})
+			return
+		}
+		for _, c := range f.Children {
+			if path == "" {
+				walk(c, c.Name)
+			} else {
+				walk(c, path+"."+c.Name)
+			}
+		}
+	}
+	walk(f, "")
+	return annotations
+}
+
+// Dump writes the field tree to w, one field per line with its offset,
+// size and value.
+func (f *Field) Dump(w io.Writer) error {
+	return f.dump(w, 0)
+}
+
+func (f *Field) dump(w io.Writer, depth int) error {
+	value := ""
+	switch v := f.Value.(type) {
+	case nil:
+	case []byte:
+		value = fmt.Sprintf(" = % x", v)
+	case string:
+		value = fmt.Sprintf(" = %q", v)
+	default:
+		value = fmt.Sprintf(" = %v", v)
+	}
+	if _, err := fmt.Fprintf(w, "%s%04x+%-4d %s %s%s\n",
+		strings.Repeat("  ", depth), f.Offset, f.Size, f.Name, f.Type, value); err != nil {
+		return err
+	}
+	for _, c := range f.Children {
+		if err := c.dump(w, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the output of Dump.
+func (f *Field) String() string {
+	var sb strings.Builder
+	_ = f.Dump(&sb) // a strings.Builder never fails
+	return sb.String()
+}
@@ -0,0 +1,208 @@
+package schema
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func appendLogin(t *testing.T, b *netbuffer.Buffer) {
+	t.Helper()
+	must := func(err error) {
+		if err != nil {
+			t.Fatalf("append error %v", err)
+		}
+	}
+	must(b.AppendUint16(7))
+	must(b.AppendUint16(0x0201)) // kind 0x0102, little endian
+	must(b.AppendUint8(4))
+	b.Append([]byte("hero"))
+	must(b.AppendUint8(2)) // count
+	for i, delta := range []int64{-1, 300} {
+		must(b.AppendUint32(uint32(i + 1)))
+		b.AppendVarint(delta)
+		b.Append([]byte{0, 0, 0, 0x3f}) // 0.5, little endian
+	}
+	must(b.AppendUint8(1))
+	must(b.AppendUint16(443))
+	must(b.AppendUint8(1))
+	b.Append([]byte{0xaa, 0xbb})
+	b.Append([]byte("tail"))
+}
+
+func TestDecode(t *testing.T) {
+	s, err := Parse(loginSchema)
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf := netbuffer.NewBuffer()
+	appendLogin(t, buf)
+	n := buf.ReadableBytes()
+
+	f, err := s.Decode(buf, "Login")
+	if err != nil {
+		t.Fatalf("s.Decode error %v", err)
+	}
+	if buf.ReadableBytes() != 0 || f.Size != n {
+		t.Errorf("s.Decode left %d bytes, decoded %d bytes, want 0 and %d", buf.ReadableBytes(), f.Size, n)
+	}
+	for path, want := range map[string]interface{}{
+		"id":            uint64(7),
+		"kind":          uint64(0x0102),
+		"name":          "hero",
+		"items.0.id":    uint64(1),
+		"items.0.delta": int64(-1),
+		"items.1.delta": int64(300),
+		"items.1.ratio": 0.5,
+		"ports.0":       uint64(443),
+		"ok":            true,
+		"rest":          "tail",
+	} {
+		got := f.Get(path)
+		if got == nil {
+			t.Errorf("f.Get(%q) = nil", path)
+			continue
+		}
+		if b, ok := got.Value.([]byte); ok {
+			got.Value = string(b)
+		}
+		if got.Value != want {
+			t.Errorf("f.Get(%q).Value = %#v, want %#v", path, got.Value, want)
+		}
+	}
+	if name := f.Get("name"); name.Offset != 4 || name.Size != 5 {
+		t.Errorf("field name at %d+%d, want 4+5", name.Offset, name.Size)
+	}
+	if f.Get("items.2") != nil || f.Get("nothing") != nil {
+		t.Error("f.Get of a missing path is not nil")
+	}
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	s, err := Parse(strings.Replace(loginSchema, "rest   bytes", "", 1))
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	full := netbuffer.NewBuffer()
+	appendLogin(t, full)
+	data := full.PeekAllAsByteSlice()
+	data = data[:len(data)-len("tail")]
+
+	for i := 0; i < len(data); i++ {
+		buf := netbuffer.NewBuffer()
+		buf.Append(data[:i])
+		if _, err := s.Decode(buf, "Login"); err != netbuffer.ErrShortBuffer {
+			t.Fatalf("s.Decode of %d bytes error %v, want %v", i, err, netbuffer.ErrShortBuffer)
+		}
+		if buf.ReadableBytes() != i {
+			t.Fatalf("after a failed s.Decode, buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), i)
+		}
+	}
+	if _, err := s.Decode(netbuffer.NewBuffer(), "Logout"); err == nil {
+		t.Error("s.Decode of an unknown packet returned no error")
+	}
+}
+
+func TestDecodeEmptyElements(t *testing.T) {
+	s, err := Parse("packet Empty {\n}\npacket A {\n s string(0)[5]\n e Empty[u8]\n v u8\n}")
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf := netbuffer.NewBuffer()
+	buf.Append([]byte{200, 1})
+	f, err := s.Decode(buf, "A")
+	if err != nil {
+		t.Fatalf("s.Decode error %v", err)
+	}
+	if len(f.Get("s").Children) != 5 || len(f.Get("e").Children) != 200 || f.Get("v").Value != uint64(1) {
+		t.Errorf("s.Decode = %+v", f)
+	}
+
+	s, err = Parse("packet A {\n a u16[u8]\n}")
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf.Append([]byte{3, 0, 1, 0, 2, 0})
+	if _, err := s.Decode(buf, "A"); err != netbuffer.ErrShortBuffer {
+		t.Errorf("s.Decode of 2 u16s of 3 error %v, want %v", err, netbuffer.ErrShortBuffer)
+	}
+}
+
+func TestDecodeDepth(t *testing.T) {
+	s, err := Parse("packet Tree {\n kids Tree[u8]\n}")
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf := netbuffer.NewBuffer()
+	for i := 0; i < maxDepth-1; i++ {
+		buf.Append([]byte{1})
+	}
+	buf.Append([]byte{0})
+	if _, err := s.Peek(buf, "Tree"); err != nil {
+		t.Errorf("s.Peek of %d nested packets error %v", maxDepth, err)
+	}
+	buf.RetrieveAll()
+	buf.Append(bytes.Repeat([]byte{1}, 1<<20))
+	if _, err := s.Peek(buf, "Tree"); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("s.Peek of too deep packets error %v", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	s, err := Parse(loginSchema)
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf := netbuffer.NewBuffer()
+	appendLogin(t, buf)
+	f, err := s.Peek(buf, "Login")
+	if err != nil {
+		t.Fatalf("s.Peek error %v", err)
+	}
+	if buf.ReadableBytes() != f.Size {
+		t.Errorf("s.Peek changed the buffer")
+	}
+	out := f.String()
+	for _, want := range []string{
+		"0000+",
+		"  0004+5    name string(u8) = \"hero\"",
+		"    000a+9    0 Item\n      000a+4    id u32 = 1\n",
+		"pad bytes[2] = aa bb",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("f.String() does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	s, err := Parse("packet P {\n id u16\n items Item[u8]\n}\npacket Item {\n v u8\n}")
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	buf := netbuffer.NewBuffer()
+	buf.Append([]byte{0, 1, 2, 0xa, 0xb})
+	f, err := s.Peek(buf, "P")
+	if err != nil {
+		t.Fatalf("s.Peek error %v", err)
+	}
+	want := []netbuffer.Annotation{
+		{Offset: 0, Size: 2, Name: "id"},
+		{Offset: 3, Size: 1, Name: "items.0.v"},
+		{Offset: 4, Size: 1, Name: "items.1.v"},
+	}
+	if got := f.Annotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("f.Annotations() = %+v, want %+v", got, want)
+	}
+
+	var sb strings.Builder
+	if err := buf.DumpAnnotated(&sb, f.Annotations()); err != nil {
+		t.Errorf("buf.DumpAnnotated error %v", err)
+	}
+	if !strings.Contains(sb.String(), "00000003  1     items.0.v: 0a\n") {
+		t.Errorf("buf.DumpAnnotated wrote\n%s", sb.String())
+	}
+}
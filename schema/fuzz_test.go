@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+package schema
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func FuzzParse(f *testing.F) {
+	f.Add(loginSchema)
+	f.Add("packet A {\n a u8\n b A[a]\n}\n")
+	f.Add("packet A {\n s string(varint)\n r bytes\n}\n")
+	f.Fuzz(func(t *testing.T, src string) {
+		s, err := Parse(src)
+		if err != nil {
+			return
+		}
+		buf := netbuffer.NewBuffer()
+		buf.Append(make([]byte, 64))
+		for _, name := range s.Packets() {
+			_, _ = s.Peek(buf, name)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	s, err := Parse(loginSchema)
+	if err != nil {
+		f.Fatal(err)
+	}
+	seed := netbuffer.NewBuffer()
+	if err := seed.AppendUint16(7); err != nil {
+		f.Fatal(err)
+	}
+	seed.Append([]byte{1, 2, 4, 'h', 'e', 'r', 'o', 0, 0, 1, 0xbb, 0, 0, 'x'})
+	f.Add(seed.PeekAllAsByteSlice())
+	f.Add([]byte{})
+	f.Add(bytes.Repeat([]byte{0xff}, 32))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := netbuffer.NewBuffer()
+		buf.Append(data)
+		field, err := s.Decode(buf, "Login")
+		if err != nil {
+			if !bytes.Equal(buf.PeekAllAsByteSlice(), data) {
+				t.Fatalf("failed Decode changed the buffer: %v", err)
+			}
+			return
+		}
+		if field.Size > len(data) || buf.ReadableBytes() != len(data)-field.Size {
+			t.Fatalf("Decode of %d bytes took %d and left %d", len(data), field.Size, buf.ReadableBytes())
+		}
+		for _, a := range field.Annotations() {
+			if a.Offset < 0 || a.Size < 0 || a.Offset+a.Size > field.Size {
+				t.Fatalf("annotation %s at %d+%d outside the packet of %d bytes", a.Name, a.Offset, a.Size, field.Size)
+			}
+		}
+	})
+}
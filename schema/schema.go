@@ -0,0 +1,413 @@
+// Package schema describes packets in a small text format and decodes
+// the readable bytes of a netbuffer.Buffer into a tree of fields, for
+// decoding messages or dissecting them in debugging tools.
+//
+// A schema is a list of packets:
+//
+//	# a comment, // works too
+//	packet Login {
+//		id     u16
+//		kind   u16le
+//		name   string(u8)    # string prefixed with its u8 length
+//		count  u8
+//		items  Item[count]   # as many Items as the field count says
+//		ports  u16[u8]       # u16s prefixed with their u8 count
+//		pad    bytes[2]      # 2 bytes
+//		rest   bytes         # all remaining bytes, last field only
+//	}
+//
+//	packet Item {
+//		id     u32
+//		delta  svarint
+//	}
+//
+// The types of a field are:
+//
+//	i8 i16 i32 i64 u8 u16 u32 u64   integers, big endian unless
+//	f32 f64                         suffixed with le, as in u16le
+//	varint svarint                  unsigned and zig-zag signed varints
+//	bool                            one byte
+//	string(N) bytes(N)              N bytes
+//	T[N]                            N values of type T, which may be a packet
+//	string bytes                    all remaining bytes
+//	P                               the fields of packet P
+//
+// where N is a number, the name of an earlier integer field of the same
+// packet, or one of u8, u16, u32, u64 (optionally suffixed with le) and
+// varint for a prefix holding the count. A packet may contain itself
+// only through arrays counted by a prefix or a field, which may be empty.
+package schema
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema is a set of packet definitions.
+type Schema struct {
+	packets map[string]*packetDef
+	order   []string
+}
+
+type packetDef struct {
+	name    string
+	fields  []*fieldDef
+	min     int  // count of byte the packet takes at least
+	minDone bool // min is computed
+}
+
+type fieldDef struct {
+	name string
+	text string // type as written
+	typ  *typeDef
+}
+
+// Kinds of typeDef.
+const (
+	kindScalar = iota
+	kindString
+	kindBytes
+	kindArray
+	kindPacket
+)
+
+type typeDef struct {
+	kind   int
+	scalar scalar   // kindScalar
+	count  count    // kindString, kindBytes, kindArray
+	elem   *typeDef // kindArray
+	packet string   // kindPacket
+
+	elemMin int // count of byte an element takes at least, for kindArray
+}
+
+// scalar is the wire format of a number or bool.
+type scalar struct {
+	name   string
+	size   int // 0 for varints
+	signed bool
+	float  bool
+	bool   bool
+	le     bool
+}
+
+// Kinds of count.
+const (
+	countFixed  = iota // n
+	countPrefix        // prefix read before the values
+	countField         // value of an earlier field
+	countRest          // all remaining bytes
+)
+
+type count struct {
+	kind   int
+	n      int
+	prefix scalar
+	field  string
+}
+
+var scalars = map[string]scalar{
+	"i8": {size: 1, signed: true}, "i16": {size: 2, signed: true},
+	"i32": {size: 4, signed: true}, "i64": {size: 8, signed: true},
+	"u8": {size: 1}, "u16": {size: 2}, "u32": {size: 4}, "u64": {size: 8},
+	"f32": {size: 4, float: true}, "f64": {size: 8, float: true},
+	"varint": {}, "svarint": {signed: true},
+	"bool": {size: 1, bool: true},
+}
+
+func parseScalar(s string) (scalar, bool) {
+	name := s
+	le := false
+	if strings.HasSuffix(s, "le") {
+		name = strings.TrimSuffix(s, "le")
+		le = true
+	}
+	sc, ok := scalars[name]
+	if !ok || le && (sc.size < 2 || sc.bool) {
+		return scalar{}, false
+	}
+	sc.name = s
+	sc.le = le
+	return sc, true
+}
+
+// Parse parses the text of a schema.
+func Parse(src string) (*Schema, error) {
+	s := &Schema{packets: make(map[string]*packetDef)}
+	var cur *packetDef
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		switch {
+		case cur == nil:
+			if len(words) != 3 || words[0] != "packet" || words[2] != "{" {
+				return nil, fmt.Errorf("schema: line %d: want \"packet NAME {\"", lineNo)
+			}
+			name := words[1]
+			if !isIdent(name) {
+				return nil, fmt.Errorf("schema: line %d: invalid packet name %q", lineNo, name)
+			}
+			if _, ok := s.packets[name]; ok {
+				return nil, fmt.Errorf("schema: line %d: packet %s redefined", lineNo, name)
+			}
+			cur = &packetDef{name: name}
+			s.packets[name] = cur
+			s.order = append(s.order, name)
+		case len(words) == 1 && words[0] == "}":
+			cur = nil
+		case len(words) == 2:
+			if err := cur.addField(words[0], words[1]); err != nil {
+				return nil, fmt.Errorf("schema: line %d: %v", lineNo, err)
+			}
+		default:
+			return nil, fmt.Errorf("schema: line %d: want \"NAME TYPE\" or \"}\"", lineNo)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("schema: packet %s is not closed", cur.name)
+	}
+	return s, s.check()
+}
+
+func (p *packetDef) addField(name, text string) error {
+	if !isIdent(name) {
+		return fmt.Errorf("invalid field name %q", name)
+	}
+	for _, f := range p.fields {
+		if f.name == name {
+			return fmt.Errorf("field %s redefined", name)
+		}
+		if f.typ.isRest() {
+			return fmt.Errorf("field %s after field %s, which takes all remaining bytes", name, f.name)
+		}
+	}
+	t, err := p.parseType(text)
+	if err != nil {
+		return fmt.Errorf("field %s: %v", name, err)
+	}
+	p.fields = append(p.fields, &fieldDef{name: name, text: text, typ: t})
+	return nil
+}
+
+func (p *packetDef) parseType(text string) (*typeDef, error) {
+	switch {
+	case text == "string":
+		return &typeDef{kind: kindString, count: count{kind: countRest}}, nil
+	case text == "bytes":
+		return &typeDef{kind: kindBytes, count: count{kind: countRest}}, nil
+	case strings.HasSuffix(text, ")"):
+		i := strings.Index(text, "(")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid type %q", text)
+		}
+		kind := kindString
+		switch text[:i] {
+		case "string":
+		case "bytes":
+			kind = kindBytes
+		default:
+			return nil, fmt.Errorf("invalid type %q", text)
+		}
+		c, err := p.parseCount(text[i+1 : len(text)-1])
+		if err != nil {
+			return nil, err
+		}
+		return &typeDef{kind: kind, count: c}, nil
+	case strings.HasSuffix(text, "]"):
+		i := strings.LastIndex(text, "[")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid type %q", text)
+		}
+		c, err := p.parseCount(text[i+1 : len(text)-1])
+		if err != nil {
+			return nil, err
+		}
+		if text[:i] == "bytes" || text[:i] == "string" {
+			// bytes[2] reads as 2 bytes, not 2 times all remaining bytes
+			return p.parseType(text[:i] + "(" + text[i+1:len(text)-1] + ")")
+		}
+		elem, err := p.parseType(text[:i])
+		if err != nil {
+			return nil, err
+		}
+		if elem.isRest() {
+			return nil, fmt.Errorf("array of %s", text[:i])
+		}
+		return &typeDef{kind: kindArray, count: c, elem: elem}, nil
+	}
+	if sc, ok := parseScalar(text); ok {
+		return &typeDef{kind: kindScalar, scalar: sc}, nil
+	}
+	if !isIdent(text) {
+		return nil, fmt.Errorf("invalid type %q", text)
+	}
+	return &typeDef{kind: kindPacket, packet: text}, nil
+}
+
+func (p *packetDef) parseCount(s string) (count, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return count{kind: countFixed, n: n}, nil
+	}
+	if sc, ok := parseScalar(s); ok && !sc.signed && !sc.float && !sc.bool {
+		return count{kind: countPrefix, prefix: sc}, nil
+	}
+	for _, f := range p.fields {
+		if f.name == s {
+			if f.typ.kind != kindScalar || f.typ.scalar.float || f.typ.scalar.bool {
+				return count{}, fmt.Errorf("count field %s is not an integer", s)
+			}
+			return count{kind: countField, field: s}, nil
+		}
+	}
+	return count{}, fmt.Errorf("invalid count %q", s)
+}
+
+func (t *typeDef) isRest() bool {
+	return (t.kind == kindString || t.kind == kindBytes) && t.count.kind == countRest
+}
+
+// check verifies that referenced packets exist and that no packet
+// contains itself in every value: directly, or through arrays of a fixed
+// count, which no input could end.
+func (s *Schema) check() error {
+	for _, name := range s.order {
+		for _, f := range s.packets[name].fields {
+			for t := f.typ; t != nil; t = t.elem {
+				if t.kind == kindPacket && s.packets[t.packet] == nil {
+					return fmt.Errorf("schema: field %s.%s: unknown packet %s", name, f.name, t.packet)
+				}
+			}
+		}
+	}
+	for _, name := range s.order {
+		if _, err := s.packetMin(s.packets[name], map[string]bool{}); err != nil {
+			return err
+		}
+	}
+	// the packets are sized, now the elements of arrays
+	for _, name := range s.order {
+		for _, f := range s.packets[name].fields {
+			for t := f.typ; t.kind == kindArray; t = t.elem {
+				m, err := s.minSize(t.elem, nil)
+				if err != nil {
+					return err
+				}
+				t.elemMin = m
+			}
+		}
+	}
+	return nil
+}
+
+// maxMin bounds minimum sizes, so that nested fixed counts cannot
+// overflow them.
+const maxMin = 1 << 30
+
+// packetMin returns the count of byte packet p takes at least. It returns
+// an error if p contains itself in every value; visiting holds the
+// packets being computed.
+func (s *Schema) packetMin(p *packetDef, visiting map[string]bool) (int, error) {
+	if p.minDone {
+		return p.min, nil
+	}
+	if visiting[p.name] {
+		return 0, fmt.Errorf("schema: packet %s contains itself", p.name)
+	}
+	visiting[p.name] = true
+	n := 0
+	for _, f := range p.fields {
+		m, err := s.minSize(f.typ, visiting)
+		if err != nil {
+			return 0, err
+		}
+		if n += m; n > maxMin {
+			n = maxMin
+		}
+	}
+	delete(visiting, p.name)
+	p.min, p.minDone = n, true
+	return n, nil
+}
+
+// minSize returns the count of byte a value of type t takes at least.
+// Elements of arrays which may be empty are not looked at, so a packet
+// may contain itself through them.
+func (s *Schema) minSize(t *typeDef, visiting map[string]bool) (int, error) {
+	switch t.kind {
+	case kindScalar:
+		return t.scalar.minSize(), nil
+	case kindString, kindBytes:
+		if t.count.kind == countFixed {
+			if t.count.n > maxMin {
+				return maxMin, nil
+			}
+			return t.count.n, nil
+		}
+		return t.count.prefixSize(), nil
+	case kindArray:
+		n := t.count.prefixSize()
+		if t.count.kind != countFixed || t.count.n == 0 {
+			return n, nil
+		}
+		m, err := s.minSize(t.elem, visiting)
+		if err != nil {
+			return 0, err
+		}
+		if m > 0 && t.count.n > (maxMin-n)/m {
+			return maxMin, nil
+		}
+		return n + t.count.n*m, nil
+	}
+	return s.packetMin(s.packets[t.packet], visiting)
+}
+
+// minSize returns the count of byte of the scalar, at least one for
+// varints.
+func (sc scalar) minSize() int {
+	if sc.size == 0 {
+		return 1
+	}
+	return sc.size
+}
+
+// prefixSize returns the count of byte of the prefix holding the count,
+// at least, or 0 if the count is not prefixed.
+func (c count) prefixSize() int {
+	if c.kind == countPrefix {
+		return c.prefix.minSize()
+	}
+	return 0
+}
+
+// Packets returns the names of the packets in definition order.
+func (s *Schema) Packets() []string {
+	return append([]string(nil), s.order...)
+}
+
+func isIdent(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
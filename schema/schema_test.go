@@ -0,0 +1,83 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const loginSchema = `
+# login flow
+packet Login {
+	id     u16
+	kind   u16le
+	name   string(u8)
+	count  u8
+	items  Item[count]   // counted by a field
+	ports  u16[u8]
+	ok     bool
+	pad    bytes[2]
+	rest   bytes
+}
+
+packet Item {
+	id     u32
+	delta  svarint
+	ratio  f32le
+}
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(loginSchema)
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	if got := strings.Join(s.Packets(), ","); got != "Login,Item" {
+		t.Errorf("s.Packets() = %s, want Login,Item", got)
+	}
+	login := s.packets["Login"]
+	if len(login.fields) != 9 {
+		t.Fatalf("packet Login has %d fields, want 9", len(login.fields))
+	}
+	items := login.fields[4].typ
+	if items.kind != kindArray || items.count.kind != countField || items.elem.packet != "Item" {
+		t.Errorf("field items is %+v", items)
+	}
+	if pad := login.fields[7].typ; pad.kind != kindBytes || pad.count.n != 2 {
+		t.Errorf("field pad is %+v", pad)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{"packet A {\n a u12\n}", "unknown packet u12"},
+		{"packet A {\n a u8\n a u8\n}", "field a redefined"},
+		{"packet A {\n a u8\n}\npacket A {\n}", "packet A redefined"},
+		{"packet A {\n a bytes\n b u8\n}", "takes all remaining bytes"},
+		{"packet A {\n a u8[n]\n}", "invalid count"},
+		{"packet A {\n n f32\n a u8[n]\n}", "is not an integer"},
+		{"packet A {\n a u8[i16]\n}", "invalid count"},
+		{"packet A {\n a A\n}", "contains itself"},
+		{"packet N {\n kids N[1]\n}", "contains itself"},
+		{"packet A {\n b B[2][3]\n}\npacket B {\n a A\n}", "contains itself"},
+		{"packet A {\n a u8", "is not closed"},
+		{"packet A\n", "want \"packet NAME {\""},
+		{"packet A {\n a u8 u8\n}", "want \"NAME TYPE\""},
+		{"packet A {\n a bytes[u8]\n b bytes[1]\n c string[u16]\n d u8le\n}", "unknown packet u8le"},
+	} {
+		_, err := Parse(c.src)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Parse(%q) error %v, want %q", c.src, err, c.want)
+		}
+	}
+
+	// a packet may contain itself through an array
+	if _, err := Parse("packet Tree {\n v u8\n kids Tree[u8]\n}"); err != nil {
+		t.Errorf("Parse of a recursive packet error %v", err)
+	}
+	if _, err := Parse("packet Leaf {\n kids Leaf[0]\n}"); err != nil {
+		t.Errorf("Parse of a packet containing itself 0 times error %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package netbuffer
+
+// Tap observes the bytes flowing through a Buffer, for recording traffic.
+// The slices passed to a Tap are only valid during the call.
+type Tap interface {
+	// Appended is called with bytes just appended to the buffer, by
+	// Append, the typed Append functions or HasWritten. Functions which
+	// remove what they appended on error, such as Marshal, CompressInto
+	// and DecompressFrom, report their bytes once they succeeded.
+	Appended(p []byte)
+	// Retrieved is called with readable bytes about to be removed from
+	// the buffer by Retrieve or RetrieveAll, and the functions built on
+	// them such as the Read functions.
+	Retrieved(p []byte)
+}
+
+// SetTap makes t observe this buffer, or stops observing it if t is nil.
+// Prepended bytes, and bytes changed in place by functions such as Seal,
+// are not reported as appended.
+func (b *Buffer) SetTap(t Tap) {
+	b.tap = t
+}
+
+// appendOrRollback calls fn, which appends to this buffer. If fn returns
+// an error, the bytes it appended are removed; otherwise they are
+// reported to the tap, which is detached while fn runs, so that it never
+// sees bytes which are removed.
+func (b *Buffer) appendOrRollback(fn func() error) error {
+	readable := b.ReadableBytes()
+	tap := b.tap
+	b.tap = nil
+	err := fn()
+	b.tap = tap
+	if err != nil {
+		b.writerIndex = b.readerIndex + readable
+		return err
+	}
+	if tap != nil && b.ReadableBytes() > readable {
+		tap.Appended(b.buf[b.readerIndex+readable : b.writerIndex])
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package netbuffer
+
+import (
+	"testing"
+)
+
+type recordingTap struct {
+	appended  []string
+	retrieved []string
+}
+
+func (t *recordingTap) Appended(p []byte) {
+	t.appended = append(t.appended, string(p))
+}
+
+func (t *recordingTap) Retrieved(p []byte) {
+	t.retrieved = append(t.retrieved, string(p))
+}
+
+func TestTap(t *testing.T) {
+	tap := &recordingTap{}
+	buf := NewBuffer()
+	buf.SetTap(tap)
+
+	buf.Append([]byte("abc"))
+	if err := buf.AppendUint16(0x6465); err != nil {
+		t.Errorf("buf.AppendUint16 error %v", err)
+	}
+	buf.AppendString("fg")
+	buf.Retrieve(2)
+	if _, err := buf.ReadUint16(); err != nil {
+		t.Errorf("buf.ReadUint16 error %v", err)
+	}
+	buf.Retrieve(100)
+	buf.RetrieveAll()
+
+	if got, want := tap.appended, []string{"abc", "de", "fg"}; !equalStrings(got, want) {
+		t.Errorf("tap saw appended %q, want %q", got, want)
+	}
+	if got, want := tap.retrieved, []string{"ab", "cd", "efg"}; !equalStrings(got, want) {
+		t.Errorf("tap saw retrieved %q, want %q", got, want)
+	}
+
+	buf.SetTap(nil)
+	buf.Append([]byte("x"))
+	if len(tap.appended) != 3 {
+		t.Error("tap saw appended bytes after buf.SetTap(nil)")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package tcpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Delays between connection attempts of a Client, as in muduo's Connector.
+const (
+	defaultInitialRetryDelay = 500 * time.Millisecond
+	defaultMaxRetryDelay     = 30 * time.Second
+)
+
+// Client connects to a server and runs the callbacks for the connection,
+// as muduo's TcpClient. Failed connection attempts are retried with an
+// exponential backoff. Set the callbacks before calling Connect.
+type Client struct {
+	callbacks
+	name              string
+	addr              string
+	dialer            net.Dialer
+	initialRetryDelay time.Duration
+	maxRetryDelay     time.Duration
+
+	mu         sync.Mutex
+	retry      bool
+	keepOutput bool
+	running    bool               // the connect goroutine is running
+	cancel     context.CancelFunc // stops the connect goroutine
+	conn       *Connection
+	closed     chan struct{}     // closed when conn is closed
+	pending    *netbuffer.Buffer // output kept for the next connection
+	nextConnID int
+}
+
+// NewClient returns a client named name for the server at the TCP
+// address addr.
+func NewClient(name, addr string) *Client {
+	return &Client{
+		callbacks:         callbacks{highWaterMark: defaultHighWaterMark},
+		name:              name,
+		addr:              addr,
+		initialRetryDelay: defaultInitialRetryDelay,
+		maxRetryDelay:     defaultMaxRetryDelay,
+		pending:           netbuffer.NewBufferWithSize(0),
+	}
+}
+
+// Name returns the name of the client.
+func (cl *Client) Name() string {
+	return cl.name
+}
+
+// SetConnectionCallback sets the callback for established and closed
+// connections. By default nothing is done.
+func (cl *Client) SetConnectionCallback(cb ConnectionCallback) {
+	cl.connectionCallback = cb
+}
+
+// SetMessageCallback sets the callback for received bytes. By default
+// they are discarded.
+func (cl *Client) SetMessageCallback(cb MessageCallback) {
+	cl.messageCallback = cb
+}
+
+// SetWriteCompleteCallback sets the callback for emptied output buffers.
+func (cl *Client) SetWriteCompleteCallback(cb WriteCompleteCallback) {
+	cl.writeCompleteCallback = cb
+}
+
+// SetHighWaterMarkCallback sets the callback for output buffers growing
+// past mark bytes, 64 MiB by default.
+func (cl *Client) SetHighWaterMarkCallback(cb HighWaterMarkCallback, mark int) {
+	cl.highWaterMarkCallback = cb
+	cl.highWaterMark = mark
+}
+
+// SetRetryDelay sets the delay before the first retry of a failed
+// connection attempt, doubled after each failure up to max. They are
+// 500ms and 30s by default.
+func (cl *Client) SetRetryDelay(initial, max time.Duration) {
+	cl.initialRetryDelay = initial
+	cl.maxRetryDelay = max
+}
+
+// SetDialTimeout sets the timeout of a connection attempt. There is none
+// by default, other than the one of the operating system.
+func (cl *Client) SetDialTimeout(d time.Duration) {
+	cl.dialer.Timeout = d
+}
+
+// EnableRetry makes the client connect again when an established
+// connection is closed, until Stop or Disconnect is called.
+func (cl *Client) EnableRetry() {
+	cl.mu.Lock()
+	cl.retry = true
+	cl.mu.Unlock()
+}
+
+// SetKeepOutput sets whether bytes left in the output buffer when the
+// connection is closed, and bytes sent while there is no connection, are
+// kept and written first on the next connection. By default they are
+// dropped. Bytes the socket accepted before the connection was closed are
+// not written again, even if the server did not receive them.
+func (cl *Client) SetKeepOutput(keep bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.keepOutput = keep
+	if !keep {
+		cl.pending.RetrieveAll()
+	}
+}
+
+// Connect starts connecting to the server in the background. It does
+// nothing if the client is connecting or connected already.
+func (cl *Client) Connect() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.running {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cl.running = true
+	cl.cancel = cancel
+	go cl.run(ctx)
+}
+
+// Stop stops connecting, and connecting again after the connection is
+// closed. The established connection, if any, is left alone.
+func (cl *Client) Stop() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.cancel != nil {
+		cl.cancel()
+	}
+}
+
+// Disconnect stops connecting as Stop, and shuts down the established
+// connection, if any, gracefully.
+func (cl *Client) Disconnect() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.cancel != nil {
+		cl.cancel()
+	}
+	if cl.conn != nil {
+		cl.conn.Shutdown()
+	}
+}
+
+// Connection returns the established connection, or nil.
+func (cl *Client) Connection() *Connection {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.conn
+}
+
+// Send sends p on the established connection. Without one, p is kept for
+// the next connection if SetKeepOutput was set, and dropped otherwise.
+// It may be called from any goroutine.
+func (cl *Client) Send(p []byte) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.conn != nil && cl.conn.send(p) {
+		return
+	}
+	if cl.keepOutput {
+		cl.pending.Append(p)
+	}
+}
+
+// run connects, with retries, and waits for the connection to be closed,
+// then connects again if retry is enabled.
+func (cl *Client) run(ctx context.Context) {
+	defer func() {
+		cl.mu.Lock()
+		cl.running = false
+		cl.cancel()
+		cl.mu.Unlock()
+	}()
+	delay := cl.initialRetryDelay
+	for {
+		nc, err := cl.dialer.DialContext(ctx, "tcp", cl.addr)
+		if err != nil {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			if delay *= 2; delay > cl.maxRetryDelay {
+				delay = cl.maxRetryDelay
+			}
+			continue
+		}
+		delay = cl.initialRetryDelay
+
+		closed := cl.newConnection(ctx, nc)
+		if closed == nil {
+			return
+		}
+		<-closed
+		cl.mu.Lock()
+		retry := cl.retry
+		cl.mu.Unlock()
+		if !retry || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// newConnection starts a connection on nc, and returns the channel closed
+// when the connection is closed. It returns nil if ctx was canceled
+// meanwhile.
+func (cl *Client) newConnection(ctx context.Context, nc net.Conn) chan struct{} {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if ctx.Err() != nil {
+		nc.Close()
+		return nil
+	}
+	cl.nextConnID++
+	c := newConnection(&cl.callbacks, cl.removeConnection, fmt.Sprintf("%s-%s#%d", cl.name, cl.addr, cl.nextConnID), nc)
+	if cl.pending.ReadableBytes() > 0 {
+		c.conn.Output().Append(cl.pending.PeekAllAsByteSlice())
+		cl.pending.RetrieveAll()
+		c.signal()
+	}
+	cl.conn = c
+	cl.closed = make(chan struct{})
+	c.start()
+	return cl.closed
+}
+
+func (cl *Client) removeConnection(c *Connection) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.keepOutput {
+		// what is left of the output buffer was sent before what was
+		// kept since the connection was closed
+		c.mu.Lock()
+		output := c.conn.Output()
+		output.Append(cl.pending.PeekAllAsByteSlice())
+		cl.pending = output
+		c.mu.Unlock()
+	}
+	cl.conn = nil
+	close(cl.closed)
+}
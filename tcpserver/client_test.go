@@ -0,0 +1,156 @@
+package tcpserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+func echoServer(t *testing.T, setup func(s *Server)) (*Server, chan error) {
+	t.Helper()
+	return startServer(t, func(s *Server) {
+		s.SetMessageCallback(func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time) {
+			c.Send(input.PeekAllAsByteSlice())
+			input.RetrieveAll()
+		})
+		if setup != nil {
+			setup(s)
+		}
+	})
+}
+
+// receive returns the next value of ch, failing t after a while.
+func receive(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out")
+		return ""
+	}
+}
+
+func TestClientEcho(t *testing.T) {
+	s, served := echoServer(t, nil)
+	events := make(chan string, 10)
+	cl := NewClient("test", s.Addr().String())
+	cl.SetConnectionCallback(func(c *Connection) {
+		if c.Connected() {
+			events <- "up"
+			c.Send([]byte("hello"))
+		} else {
+			events <- "down"
+		}
+	})
+	cl.SetMessageCallback(func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time) {
+		if input.ReadableBytes() >= len("hello") {
+			events <- string(input.PeekAsByteSlice(len("hello")))
+			input.Retrieve(len("hello"))
+		}
+	})
+	cl.Connect()
+
+	for _, want := range []string{"up", "hello"} {
+		if got := receive(t, events); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	if cl.Connection() == nil {
+		t.Errorf("cl.Connection is nil while connected")
+	}
+	cl.Disconnect()
+	if got := receive(t, events); got != "down" {
+		t.Errorf("got %q, want %q", got, "down")
+	}
+	shutdown(t, s, served)
+}
+
+func TestClientRetry(t *testing.T) {
+	// find a free port, on which nothing listens yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen error %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	connected := make(chan string, 1)
+	cl := NewClient("test", addr)
+	cl.SetRetryDelay(5*time.Millisecond, 20*time.Millisecond)
+	cl.SetConnectionCallback(func(c *Connection) {
+		if c.Connected() {
+			connected <- "up"
+		}
+	})
+	cl.Connect()
+	defer cl.Disconnect()
+	time.Sleep(50 * time.Millisecond)
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port %s taken meanwhile: %v", addr, err)
+	}
+	s := NewServer("test", l)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve()
+	}()
+	receive(t, connected)
+	shutdown(t, s, served)
+}
+
+func TestClientKeepOutput(t *testing.T) {
+	received := make(chan string, 10)
+	accepted := 0
+	s, served := startServer(t, func(s *Server) {
+		s.SetConnectionCallback(func(c *Connection) {
+			// callbacks of different connections may run concurrently,
+			// but the client connects once at a time
+			if c.Connected() {
+				accepted++
+				if accepted == 1 {
+					c.ForceClose()
+				}
+			}
+		})
+		s.SetMessageCallback(func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time) {
+			if input.ReadableBytes() >= len("kept") {
+				received <- string(input.PeekAsByteSlice(len("kept")))
+				input.Retrieve(len("kept"))
+			}
+		})
+	})
+
+	ups := make(chan string, 10)
+	cl := NewClient("test", s.Addr().String())
+	cl.EnableRetry()
+	cl.SetKeepOutput(true)
+	cl.SetConnectionCallback(func(c *Connection) {
+		if c.Connected() {
+			ups <- "up"
+		} else {
+			// no connection to send on, so kept for the next one
+			cl.Send([]byte("kept"))
+		}
+	})
+	cl.Connect()
+
+	receive(t, ups)
+	receive(t, ups)
+	if got := receive(t, received); got != "kept" {
+		t.Errorf("server received %q, want %q", got, "kept")
+	}
+	cl.Disconnect()
+	shutdown(t, s, served)
+}
+
+func TestClientDropOutput(t *testing.T) {
+	cl := NewClient("test", "127.0.0.1:1")
+	cl.Send([]byte("dropped"))
+	if cl.pending.ReadableBytes() != 0 {
+		t.Errorf("cl.Send kept %d bytes without SetKeepOutput", cl.pending.ReadableBytes())
+	}
+}
@@ -0,0 +1,271 @@
+package tcpserver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// States of a Connection.
+const (
+	stateConnected     = iota
+	stateDisconnecting // Shutdown was called, writing what is left
+	stateDisconnected
+)
+
+// callbacks are the callbacks of the connections of a Server or a
+// Client.
+type callbacks struct {
+	connectionCallback    ConnectionCallback
+	messageCallback       MessageCallback
+	writeCompleteCallback WriteCompleteCallback
+	highWaterMarkCallback HighWaterMarkCallback
+	highWaterMark         int
+}
+
+// Connection is a connection accepted by a Server or made by a Client.
+type Connection struct {
+	cb      *callbacks
+	onClose func(c *Connection) // called last when the connection is closed
+	name    string
+	nc      net.Conn
+	conn    *netbuffer.Conn // input buffer filled by readLoop, output buffer
+
+	callbackMu sync.Mutex // serializes the callbacks
+
+	mu        sync.Mutex // guards the output buffer and the fields below
+	state     int
+	highWater int // output size to report to the high-water-mark callback
+	context   interface{}
+
+	wake      chan struct{} // tells writeLoop to write
+	writeDone chan struct{} // closed when writeLoop returns
+}
+
+func newConnection(cb *callbacks, onClose func(c *Connection), name string, nc net.Conn) *Connection {
+	return &Connection{
+		cb:        cb,
+		onClose:   onClose,
+		name:      name,
+		nc:        nc,
+		conn:      netbuffer.NewConn(nc),
+		wake:      make(chan struct{}, 1),
+		writeDone: make(chan struct{}),
+	}
+}
+
+// Name returns the name of the connection, made of the server or client
+// name, the listener or server address and a sequence number.
+func (c *Connection) Name() string {
+	return c.name
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *Connection) LocalAddr() net.Addr {
+	return c.nc.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Connection) RemoteAddr() net.Addr {
+	return c.nc.RemoteAddr()
+}
+
+// Connected reports whether the connection is established, and neither
+// being shut down nor closed.
+func (c *Connection) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == stateConnected
+}
+
+// SetContext attaches v to the connection, such as the session state of
+// a protocol.
+func (c *Connection) SetContext(v interface{}) {
+	c.mu.Lock()
+	c.context = v
+	c.mu.Unlock()
+}
+
+// Context returns the value attached by SetContext.
+func (c *Connection) Context() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.context
+}
+
+// Send appends p to the output buffer, to be written to the socket in the
+// background. It may be called from any goroutine. Bytes sent after
+// Shutdown or after the connection was closed are dropped.
+func (c *Connection) Send(p []byte) {
+	c.send(p)
+}
+
+// send is Send, reporting whether p was appended.
+func (c *Connection) send(p []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != stateConnected {
+		return false
+	}
+	output := c.conn.Output()
+	old := output.ReadableBytes()
+	output.Append(p)
+	if n := output.ReadableBytes(); old < c.cb.highWaterMark && n >= c.cb.highWaterMark {
+		c.highWater = n
+	}
+	c.signal()
+	return true
+}
+
+// OutputBytes returns count of byte waiting in the output buffer.
+func (c *Connection) OutputBytes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.Output().ReadableBytes()
+}
+
+// Shutdown closes the write side of the connection once the output
+// buffer has been written. The connection is closed when the peer closes
+// its side.
+func (c *Connection) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == stateConnected {
+		c.state = stateDisconnecting
+		c.signal()
+	}
+}
+
+// ForceClose closes the connection, dropping the output buffer.
+func (c *Connection) ForceClose() {
+	c.nc.Close()
+}
+
+// signal wakes writeLoop. c.mu must be held.
+func (c *Connection) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// callback runs f, serialized with the other callbacks of c.
+func (c *Connection) callback(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	f()
+}
+
+func (c *Connection) start() {
+	go c.writeLoop()
+	go c.readLoop()
+}
+
+func (c *Connection) readLoop() {
+	s := c.cb
+	if s.connectionCallback != nil {
+		c.callback(func() { s.connectionCallback(c) })
+	}
+	input := c.conn.Input()
+	for {
+		n, err := c.conn.Fill()
+		if n > 0 {
+			receiveTime := time.Now()
+			c.callback(func() {
+				if s.messageCallback != nil {
+					s.messageCallback(c, input, receiveTime)
+				} else {
+					input.RetrieveAll()
+				}
+			})
+		}
+		if err != nil {
+			break
+		}
+	}
+	c.handleClose()
+}
+
+func (c *Connection) handleClose() {
+	c.mu.Lock()
+	c.state = stateDisconnected
+	c.signal()
+	c.mu.Unlock()
+	c.nc.Close()
+	<-c.writeDone
+
+	s := c.cb
+	if s.connectionCallback != nil {
+		c.callback(func() { s.connectionCallback(c) })
+	}
+	c.onClose(c)
+}
+
+func (c *Connection) writeLoop() {
+	defer close(c.writeDone)
+	for range c.wake {
+		if !c.flush() {
+			return
+		}
+	}
+}
+
+// flush writes the output buffer until it is empty, and reports whether
+// writeLoop should go on. The output buffer is written through a View,
+// so that Send can append to it meanwhile.
+func (c *Connection) flush() bool {
+	s := c.cb
+	wrote := false
+	for {
+		c.mu.Lock()
+		highWater := c.highWater
+		c.highWater = 0
+		state := c.state
+		output := c.conn.Output()
+		n := output.ReadableBytes()
+		var v *netbuffer.View
+		if n > 0 && state != stateDisconnected {
+			v = output.PeekView(n)
+		}
+		c.mu.Unlock()
+
+		if highWater > 0 && s.highWaterMarkCallback != nil {
+			c.callback(func() { s.highWaterMarkCallback(c, highWater) })
+		}
+		if state == stateDisconnected {
+			return false
+		}
+		if v == nil {
+			if wrote && s.writeCompleteCallback != nil {
+				c.callback(func() { s.writeCompleteCallback(c) })
+			}
+			if state == stateDisconnecting {
+				c.shutdownWrite()
+				return false
+			}
+			return true
+		}
+
+		written, err := c.nc.Write(v.Bytes())
+		c.mu.Lock()
+		v.Release()
+		output.Retrieve(written)
+		c.mu.Unlock()
+		wrote = true
+		if err != nil {
+			c.nc.Close() // readLoop sees the error and closes the connection
+			return false
+		}
+	}
+}
+
+func (c *Connection) shutdownWrite() {
+	if cw, ok := c.nc.(interface{ CloseWrite() error }); ok {
+		if cw.CloseWrite() == nil {
+			return
+		}
+	}
+	c.nc.Close()
+}
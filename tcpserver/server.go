@@ -0,0 +1,207 @@
+// Package tcpserver is a TCP server in the style of muduo's TcpServer and
+// TcpConnection, built around netbuffer.Buffer.
+//
+// Each connection has an input buffer, filled from the socket and passed
+// to the message callback, and an output buffer, appended to by Send and
+// written to the socket in the background. The callbacks of one
+// connection never run concurrently, so a message callback may decode
+// from its input buffer without locking:
+//
+//	s := tcpserver.NewServer("echo", l)
+//	s.SetMessageCallback(func(c *tcpserver.Connection, input *netbuffer.Buffer, t time.Time) {
+//		c.Send(input.PeekAllAsByteSlice())
+//		input.RetrieveAll()
+//	})
+//	go s.Serve()
+//	...
+//	s.Shutdown(ctx)
+//
+// A Client makes connections with the same callbacks, retrying failed
+// connection attempts and optionally reconnecting, as muduo's TcpClient.
+package tcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// defaultHighWaterMark is the output buffer size above which the
+// high-water-mark callback is called, as in muduo.
+const defaultHighWaterMark = 64 << 20
+
+// Delays before accepting again after a temporary error, such as running
+// out of file descriptors, as in net/http.
+const (
+	initialAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay     = time.Second
+)
+
+// ErrServerClosed is returned by Serve after Shutdown.
+var ErrServerClosed = errors.New("tcpserver: server closed")
+
+// ConnectionCallback is called when a connection is established and when
+// it is closed; Connected tells which.
+type ConnectionCallback func(c *Connection)
+
+// MessageCallback is called when bytes arrived in input, the input buffer
+// of c, at receiveTime. Bytes it does not retrieve stay in input for the
+// next call.
+type MessageCallback func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time)
+
+// WriteCompleteCallback is called when the output buffer of c has been
+// written to the socket entirely.
+type WriteCompleteCallback func(c *Connection)
+
+// HighWaterMarkCallback is called when Send makes the output buffer of c
+// grow to outputSize bytes, past the high water mark.
+type HighWaterMarkCallback func(c *Connection, outputSize int)
+
+// Server accepts connections from a listener and runs the callbacks for
+// them. Set the callbacks before calling Serve.
+type Server struct {
+	callbacks
+	name     string
+	listener net.Listener
+
+	mu         sync.Mutex
+	conns      map[*Connection]struct{}
+	nextConnID int
+	closed     bool
+	wg         sync.WaitGroup // running connections
+}
+
+// NewServer returns a server named name accepting connections from l.
+func NewServer(name string, l net.Listener) *Server {
+	return &Server{
+		callbacks: callbacks{highWaterMark: defaultHighWaterMark},
+		name:      name,
+		listener:  l,
+		conns:     make(map[*Connection]struct{}),
+	}
+}
+
+// Name returns the name of the server.
+func (s *Server) Name() string {
+	return s.name
+}
+
+// Addr returns the address of the listener.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// SetConnectionCallback sets the callback for established and closed
+// connections. By default nothing is done.
+func (s *Server) SetConnectionCallback(cb ConnectionCallback) {
+	s.connectionCallback = cb
+}
+
+// SetMessageCallback sets the callback for received bytes. By default
+// they are discarded.
+func (s *Server) SetMessageCallback(cb MessageCallback) {
+	s.messageCallback = cb
+}
+
+// SetWriteCompleteCallback sets the callback for emptied output buffers.
+func (s *Server) SetWriteCompleteCallback(cb WriteCompleteCallback) {
+	s.writeCompleteCallback = cb
+}
+
+// SetHighWaterMarkCallback sets the callback for output buffers growing
+// past mark bytes, 64 MiB by default.
+func (s *Server) SetHighWaterMarkCallback(cb HighWaterMarkCallback, mark int) {
+	s.highWaterMarkCallback = cb
+	s.highWaterMark = mark
+}
+
+// Serve accepts connections until Shutdown is called, then returns
+// ErrServerClosed, or until accepting fails. Temporary errors, such as
+// EMFILE, are retried after a delay growing from 5ms to 1s.
+func (s *Server) Serve() error {
+	var delay time.Duration
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = initialAcceptDelay
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		s.newConnection(nc)
+	}
+}
+
+func (s *Server) newConnection(nc net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	s.nextConnID++
+	c := newConnection(&s.callbacks, s.removeConnection, fmt.Sprintf("%s-%s#%d", s.name, s.listener.Addr(), s.nextConnID), nc)
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	c.start()
+}
+
+func (s *Server) removeConnection(c *Connection) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// Shutdown stops accepting connections and shuts down the existing ones
+// gracefully: their output buffers are written, then their write sides
+// are closed. It waits for the peers to close the connections. If ctx is
+// done first, it closes the remaining connections and returns ctx.Err().
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.listener.Close()
+	conns := make([]*Connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Shutdown()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		for _, c := range conns {
+			c.ForceClose()
+		}
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,255 @@
+package tcpserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// startServer starts a server on a loopback port after setup has set its
+// callbacks, and returns it with the channel Serve returns into.
+func startServer(t *testing.T, setup func(s *Server)) (*Server, chan error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen error %v", err)
+	}
+	s := NewServer("test", l)
+	setup(s)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve()
+	}()
+	return s, served
+}
+
+func shutdown(t *testing.T, s *Server, served chan error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("s.Shutdown error %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("s.Serve returned %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	closed := make(chan struct{})
+
+	s, served := startServer(t, func(s *Server) {
+		s.SetConnectionCallback(func(c *Connection) {
+			if c.Connected() {
+				record("up")
+				c.SetContext(c.RemoteAddr().String())
+			} else {
+				record("down")
+				close(closed)
+			}
+		})
+		s.SetMessageCallback(func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time) {
+			if receiveTime.IsZero() {
+				t.Errorf("zero receive time")
+			}
+			c.Send(input.PeekAllAsByteSlice())
+			input.RetrieveAll()
+		})
+		s.SetWriteCompleteCallback(func(c *Connection) {
+			record("written")
+		})
+	})
+
+	client, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	for _, msg := range []string{"hello", "world"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("client.Write error %v", err)
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(client, got); err != nil || string(got) != msg {
+			t.Fatalf("echo of %q is %q, %v", msg, got, err)
+		}
+	}
+	client.Close()
+	<-closed
+
+	mu.Lock()
+	got := append([]string(nil), events...)
+	mu.Unlock()
+	if len(got) < 3 || got[0] != "up" || got[1] != "written" || got[len(got)-1] != "down" {
+		t.Errorf("callbacks ran as %v, want up, written..., down", got)
+	}
+	shutdown(t, s, served)
+}
+
+func TestHighWaterMark(t *testing.T) {
+	const mark = 1 << 16
+	reported := make(chan int, 1)
+	s, served := startServer(t, func(s *Server) {
+		s.SetConnectionCallback(func(c *Connection) {
+			if c.Connected() {
+				c.Send(make([]byte, 1<<20))
+			}
+		})
+		s.SetHighWaterMarkCallback(func(c *Connection, outputSize int) {
+			reported <- outputSize
+		}, mark)
+	})
+
+	client, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	select {
+	case n := <-reported:
+		if n < mark {
+			t.Errorf("high water mark callback got %d bytes, want at least %d", n, mark)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("high water mark callback not called")
+	}
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(client, 1<<20))
+	if err != nil || n != 1<<20 {
+		t.Errorf("client read %d bytes, %v, want %d", n, err, 1<<20)
+	}
+	client.Close()
+	shutdown(t, s, served)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	connected := make(chan struct{})
+	s, served := startServer(t, func(s *Server) {
+		s.SetConnectionCallback(func(c *Connection) {
+			if c.Connected() {
+				c.Send([]byte("bye"))
+				close(connected)
+			}
+		})
+	})
+	client, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	<-connected
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+
+	// the pending output is written before the write side is closed
+	got, err := ioutil.ReadAll(client)
+	if err != nil || !bytes.Equal(got, []byte("bye")) {
+		t.Errorf("client read %q, %v, want %q", got, err, "bye")
+	}
+	client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("s.Shutdown error %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("s.Serve returned %v, want %v", err, ErrServerClosed)
+	}
+	if _, err := net.Dial("tcp", s.Addr().String()); err == nil {
+		t.Errorf("net.Dial after Shutdown succeeded")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	connected := make(chan struct{})
+	s, served := startServer(t, func(s *Server) {
+		s.SetConnectionCallback(func(c *Connection) {
+			if c.Connected() {
+				close(connected)
+			}
+		})
+	})
+	client, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	defer client.Close()
+	<-connected
+
+	// the client never closes, so the connection is closed at the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("s.Shutdown error %v, want %v", err, context.DeadlineExceeded)
+	}
+	<-served
+	if _, err := ioutil.ReadAll(client); err != nil {
+		t.Errorf("client read error %v after the server closed", err)
+	}
+}
+
+// temporaryError is a net.Error such as accepting returns on EMFILE.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// flakyListener fails to accept n times before accepting.
+type flakyListener struct {
+	net.Listener
+	n int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.n > 0 {
+		l.n--
+		return nil, temporaryError{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestAcceptTemporaryError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen error %v", err)
+	}
+	s := NewServer("test", &flakyListener{Listener: l, n: 3})
+	s.SetMessageCallback(func(c *Connection, input *netbuffer.Buffer, receiveTime time.Time) {
+		c.Send(input.PeekAllAsByteSlice())
+		input.RetrieveAll()
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve()
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial error %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatalf("client.Write error %v", err)
+	}
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(client, got); err != nil {
+		t.Fatalf("io.ReadFull error %v", err)
+	}
+	if string(got) != "ping" {
+		t.Errorf("echoed %q, want %q", got, "ping")
+	}
+	client.Close()
+	shutdown(t, s, served)
+}
@@ -0,0 +1,35 @@
+package netbuffer
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Validate checks the invariants of the indices of this buffer:
+// 0 <= readerIndex <= writerIndex <= len(buf), and buf keeps room for the
+// cheapPrepend bytes which RetrieveAll reserves in front of the readable
+// bytes. It returns an error describing the first broken invariant, or
+// nil.
+// In debug mode, makeSpace and prepend panic with this error.
+func (b *Buffer) Validate() error {
+	switch {
+	case b.readerIndex < 0:
+		return fmt.Errorf("netbuffer: readerIndex %d is negative", b.readerIndex)
+	case b.readerIndex > b.writerIndex:
+		return fmt.Errorf("netbuffer: readerIndex %d is after writerIndex %d", b.readerIndex, b.writerIndex)
+	case b.writerIndex > len(b.buf):
+		return fmt.Errorf("netbuffer: writerIndex %d is after len(buf) %d", b.writerIndex, len(b.buf))
+	case len(b.buf) < cheapPrepend:
+		return fmt.Errorf("netbuffer: len(buf) %d is less than the prepend reserve %d", len(b.buf), cheapPrepend)
+	case b.pin != nil && atomic.LoadInt32(&b.pin.refs) < 0:
+		return fmt.Errorf("netbuffer: %d Views released more than once", -atomic.LoadInt32(&b.pin.refs))
+	}
+	return nil
+}
+
+// mustValidate panics if Validate fails. Call it in debug mode only.
+func (b *Buffer) mustValidate() {
+	if err := b.Validate(); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,176 @@
+package netbuffer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"testing"
+	"testing/quick"
+)
+
+func TestValidate(t *testing.T) {
+	buf := NewBufferWithSize(4)
+	if err := buf.Validate(); err != nil {
+		t.Errorf("buf.Validate() of a new buffer error %v", err)
+	}
+	broken := []struct {
+		breakIt func(b *Buffer)
+		want    string
+	}{
+		{func(b *Buffer) { b.readerIndex = -1 }, "readerIndex -1 is negative"},
+		{func(b *Buffer) { b.readerIndex = b.writerIndex + 1 }, "readerIndex 9 is after writerIndex 8"},
+		{func(b *Buffer) { b.writerIndex = len(b.buf) + 1 }, "writerIndex 13 is after len(buf) 12"},
+		{func(b *Buffer) { b.readerIndex, b.writerIndex = 0, 0; b.buf = b.buf[:cheapPrepend-1] },
+			"len(buf) 7 is less than the prepend reserve 8"},
+		{func(b *Buffer) { b.PeekView(0).Release(); b.pin.refs = -1 }, "1 Views released more than once"},
+	}
+	for i, c := range broken {
+		b := NewBufferWithSize(4)
+		c.breakIt(b)
+		err := b.Validate()
+		if err == nil || err.Error() != "netbuffer: "+c.want {
+			t.Errorf("case %d: buf.Validate() error %v, want %q", i, err, c.want)
+		}
+	}
+}
+
+// quickOp is an operation on a Buffer generated by testing/quick.
+type quickOp struct {
+	Kind uint8
+	N    uint16
+	Data []byte
+}
+
+// heldView is a View kept across operations, with its expected content.
+type heldView struct {
+	v    *View
+	want string
+}
+
+// apply runs op against b and against the oracle, which holds the
+// readable bytes. It returns false if b returned something other than the
+// oracle.
+func (op quickOp) apply(t *testing.T, b *Buffer, oracle *bytes.Buffer, views *[]heldView, aead cipher.AEAD) bool {
+	n := int(op.N)
+	switch op.Kind % 11 {
+	case 0:
+		b.Append(op.Data)
+		oracle.Write(op.Data)
+	case 1:
+		_ = b.AppendUint32(uint32(n))
+		var p [4]byte
+		binary.BigEndian.PutUint32(p[:], uint32(n))
+		oracle.Write(p[:])
+	case 2:
+		// prepend up to 32 bytes, more than cheapPrepend
+		p := make([]byte, 0, 32)
+		for i := 0; i <= n%8; i++ {
+			_ = b.PrependUint32(uint32(i))
+			var x [4]byte
+			binary.BigEndian.PutUint32(x[:], uint32(i))
+			p = append(x[:], p...)
+		}
+		rest := append(p, oracle.Bytes()...)
+		oracle.Reset()
+		oracle.Write(rest)
+	case 3:
+		n %= oracle.Len() + 2
+		b.Retrieve(n)
+		oracle.Next(n)
+	case 4:
+		b.RetrieveAll()
+		oracle.Reset()
+	case 5:
+		x, err := b.ReadUint16()
+		if oracle.Len() < 2 {
+			if err != ErrShortBuffer {
+				return false
+			}
+			break
+		}
+		if err != nil || x != binary.BigEndian.Uint16(oracle.Next(2)) {
+			return false
+		}
+	case 6:
+		b.EnsureWritableBytes(n % 2048)
+		p := b.WritableByteSlice()
+		k := copy(p, op.Data)
+		b.HasWritten(k)
+		oracle.Write(op.Data[:k])
+	case 7:
+		n %= oracle.Len() + 1
+		v := b.PeekView(n)
+		if !bytes.Equal(v.Bytes(), oracle.Bytes()[:n]) {
+			return false
+		}
+		*views = append(*views, heldView{v, string(oracle.Bytes()[:n])})
+	case 8:
+		if len(*views) > 0 {
+			h := (*views)[0]
+			if h.v.String() != h.want {
+				return false
+			}
+			h.v.Release()
+			*views = (*views)[1:]
+		}
+	case 9:
+		b.AppendUvarint(uint64(n))
+		var p [binary.MaxVarintLen64]byte
+		oracle.Write(p[:binary.PutUvarint(p[:], uint64(n))])
+	case 10:
+		// seal a frame of op.Data after the readable bytes, then open it
+		frame := NewBuffer()
+		frame.Append(op.Data)
+		if err := frame.Seal(aead, nil, nil); err != nil {
+			t.Fatalf("frame.Seal error %v", err)
+		}
+		size := frame.ReadableBytes()
+		readable := b.ReadableBytes()
+		b.Append(frame.PeekAllAsByteSlice())
+		b.Retrieve(readable)
+		if err := b.Open(aead, size, nil); err != nil {
+			t.Fatalf("buf.Open error %v", err)
+		}
+		oracle.Reset()
+		oracle.Write(op.Data)
+	}
+	return bytes.Equal(b.PeekAllAsByteSlice(), oracle.Bytes())
+}
+
+func TestQuickIndexInvariants(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := func(ops []quickOp) bool {
+		b := NewBufferWithSize(16)
+		var oracle bytes.Buffer
+		var views []heldView
+		for i, op := range ops {
+			if !op.apply(t, b, &oracle, &views, aead) {
+				t.Logf("op %d %+v: readable bytes %x, want %x", i, op, b.PeekAllAsByteSlice(), oracle.Bytes())
+				return false
+			}
+			if err := b.Validate(); err != nil {
+				t.Logf("op %d %+v: %v", i, op, err)
+				return false
+			}
+		}
+		for i, h := range views {
+			if h.v.String() != h.want {
+				t.Logf("view %d changed to %q, want %q", i, h.v.String(), h.want)
+				return false
+			}
+			h.v.Release()
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,94 @@
+package netbuffer
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrVarintOverflow is returned when a varint does not fit in 64 bits.
+var ErrVarintOverflow = errors.New("netbuffer: varint overflows a 64-bit integer")
+
+// AppendUvarint appends x as an unsigned varint, in the format of
+// encoding/binary and Protocol Buffers.
+func (b *Buffer) AppendUvarint(x uint64) {
+	b.ensureWritableBytes(binary.MaxVarintLen64)
+	n := binary.PutUvarint(b.WritableByteSlice(), x)
+	b.HasWritten(n)
+}
+
+// AppendVarint appends x as a zig-zag encoded signed varint.
+func (b *Buffer) AppendVarint(x int64) {
+	b.ensureWritableBytes(binary.MaxVarintLen64)
+	n := binary.PutVarint(b.WritableByteSlice(), x)
+	b.HasWritten(n)
+}
+
+// PrependUvarint prepends x as an unsigned varint, such as the length of
+// a message encoded after it.
+func (b *Buffer) PrependUvarint(x uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	b.prepend(tmp[:n])
+}
+
+// PeekUvarint parses an unsigned varint from the beginning of the readable
+// bytes of this buffer and returns it with its count of byte.
+// This function does not modify this buffer.
+func (b *Buffer) PeekUvarint() (x uint64, n int, err error) {
+	x, n = binary.Uvarint(b.buf[b.readerIndex:b.writerIndex])
+	return x, n, varintError(n)
+}
+
+// PeekVarint parses a signed varint from the beginning of the readable
+// bytes of this buffer and returns it with its count of byte.
+// This function does not modify this buffer.
+func (b *Buffer) PeekVarint() (x int64, n int, err error) {
+	x, n = binary.Varint(b.buf[b.readerIndex:b.writerIndex])
+	return x, n, varintError(n)
+}
+
+// ReadUvarint parses an unsigned varint from the beginning of the readable
+// bytes of this buffer and changes readable bytes of this buffer.
+func (b *Buffer) ReadUvarint() (x uint64, err error) {
+	x, n, err := b.PeekUvarint()
+	if err != nil {
+		return
+	}
+	b.Retrieve(n)
+	return
+}
+
+// ReadVarint parses a signed varint from the beginning of the readable
+// bytes of this buffer and changes readable bytes of this buffer.
+func (b *Buffer) ReadVarint() (x int64, err error) {
+	x, n, err := b.PeekVarint()
+	if err != nil {
+		return
+	}
+	b.Retrieve(n)
+	return
+}
+
+// UvarintSize returns count of byte of x encoded by AppendUvarint.
+func UvarintSize(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+// VarintSize returns count of byte of x encoded by AppendVarint.
+func VarintSize(x int64) int {
+	return UvarintSize(uint64(x<<1) ^ uint64(x>>63))
+}
+
+func varintError(n int) error {
+	if n == 0 {
+		return ErrShortBuffer
+	}
+	if n < 0 {
+		return ErrVarintOverflow
+	}
+	return nil
+}
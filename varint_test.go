@@ -0,0 +1,79 @@
+package netbuffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUvarint(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, math.MaxUint32, math.MaxUint64} {
+		buf := NewBuffer()
+		buf.AppendUvarint(v)
+		x, err := buf.ReadUvarint()
+		if err != nil {
+			t.Errorf("buf.ReadUvarint() error %v", err)
+		}
+		if x != v {
+			t.Errorf("buf.ReadUvarint() = %d, want %d", x, v)
+		}
+		if buf.ReadableBytes() != 0 {
+			t.Errorf("after buf.ReadUvarint(), buf.ReadableBytes() = %d, want 0", buf.ReadableBytes())
+		}
+		buf.AppendUvarint(v)
+		if UvarintSize(v) != buf.ReadableBytes() {
+			t.Errorf("UvarintSize(%d) = %d, want %d", v, UvarintSize(v), buf.ReadableBytes())
+		}
+	}
+
+	buf := NewBuffer()
+	buf.Append([]byte{0x80, 0x80})
+	if _, err := buf.ReadUvarint(); err != ErrShortBuffer {
+		t.Errorf("buf.ReadUvarint() of a partial varint error %v, want %v", err, ErrShortBuffer)
+	}
+	if buf.ReadableBytes() != 2 {
+		t.Errorf("buf.ReadableBytes() = %d, want 2", buf.ReadableBytes())
+	}
+	buf.Append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if _, err := buf.ReadUvarint(); err != ErrVarintOverflow {
+		t.Errorf("buf.ReadUvarint() of a long varint error %v, want %v", err, ErrVarintOverflow)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []int64{0, -1, 1, -64, 64, math.MinInt64, math.MaxInt64} {
+		buf := NewBuffer()
+		buf.AppendVarint(v)
+		x, n, err := buf.PeekVarint()
+		if err != nil {
+			t.Errorf("buf.PeekVarint() error %v", err)
+		}
+		if n != buf.ReadableBytes() {
+			t.Errorf("buf.PeekVarint() n = %d, want %d", n, buf.ReadableBytes())
+		}
+		if VarintSize(v) != n {
+			t.Errorf("VarintSize(%d) = %d, want %d", v, VarintSize(v), n)
+		}
+		if x != v {
+			t.Errorf("buf.PeekVarint() = %d, want %d", x, v)
+		}
+		x, err = buf.ReadVarint()
+		if err != nil || x != v {
+			t.Errorf("buf.ReadVarint() = %d, %v, want %d", x, err, v)
+		}
+	}
+}
+
+func TestPrependUvarint(t *testing.T) {
+	for _, v := range []uint64{0, 127, 128, 268435455, math.MaxUint64} {
+		buf := NewBuffer()
+		buf.AppendString("body")
+		buf.PrependUvarint(v)
+		x, err := buf.ReadUvarint()
+		if err != nil || x != v {
+			t.Errorf("buf.ReadUvarint() after buf.PrependUvarint(%d) = %d, %v", v, x, err)
+		}
+		if s := buf.retrieveAllAsString(); s != "body" {
+			t.Errorf("after the varint, readable bytes are %q, want %q", s, "body")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package netbuffer
+
+import (
+	"sync/atomic"
+)
+
+// pin counts the Views which reference the storage of a Buffer.
+type pin struct {
+	refs int32
+}
+
+// View is a read-only window on bytes of a Buffer.
+// Unlike the slice returned by PeekAsByteSlice, a View stays valid after
+// later writes to the Buffer: while a View is alive, the Buffer never
+// reuses the storage under it and moves to new storage instead.
+// Call Release when you are done with a View so the Buffer can reuse
+// its storage again.
+type View struct {
+	data []byte
+	pin  *pin
+}
+
+// PeekView returns a View of length count bytes from the beginning of
+// the readable bytes of this buffer.
+// This function does not modify this buffer.
+func (b *Buffer) PeekView(length int) *View {
+	if b.pin == nil {
+		b.pin = &pin{}
+	}
+	atomic.AddInt32(&b.pin.refs, 1)
+	start := b.readerIndex
+	return &View{
+		data: b.buf[start : start+length : start+length],
+		pin:  b.pin,
+	}
+}
+
+// ReadView returns a View of length count bytes from the beginning of
+// the readable bytes of this buffer and removes these bytes from it.
+func (b *Buffer) ReadView(length int) *View {
+	v := b.PeekView(length)
+	b.Retrieve(length)
+	return v
+}
+
+// Bytes returns the bytes of this view.
+// You MUST NOT modify the content of the returned slice, and MUST NOT
+// use it after Release.
+func (v *View) Bytes() []byte {
+	v.check()
+	return v.data
+}
+
+// Len returns count of byte in this view.
+func (v *View) Len() int {
+	v.check()
+	return len(v.data)
+}
+
+// String returns the bytes of this view as a string.
+func (v *View) String() string {
+	v.check()
+	return string(v.data)
+}
+
+// Slice returns a new View of v.Bytes()[i:j] which shares the storage of
+// this view. Both views must be released.
+func (v *View) Slice(i, j int) *View {
+	v.check()
+	atomic.AddInt32(&v.pin.refs, 1)
+	return &View{
+		data: v.data[i:j:j],
+		pin:  v.pin,
+	}
+}
+
+// Release tells the buffer that this view is no longer used.
+// A view must not be used after Release.
+func (v *View) Release() {
+	v.check()
+	atomic.AddInt32(&v.pin.refs, -1)
+	v.data = nil
+	v.pin = nil
+}
+
+func (v *View) check() {
+	if v.pin == nil {
+		panic("netbuffer: use of released View")
+	}
+}
+
+// shared reports whether any View still references the storage of b.
+func (b *Buffer) shared() bool {
+	return b.pin != nil && atomic.LoadInt32(&b.pin.refs) > 0
+}
+
+// unshare moves the readable bytes of b to new storage if any View still
+// references the current one. It must be called before b overwrites
+// bytes it has handed out.
+func (b *Buffer) unshare() {
+	if !b.shared() {
+		return
+	}
+	buf := make([]byte, len(b.buf))
+	copy(buf[b.readerIndex:b.writerIndex], b.buf[b.readerIndex:b.writerIndex])
+	b.buf = buf
+	b.pin = nil
+}
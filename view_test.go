@@ -0,0 +1,75 @@
+package netbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPeekView(t *testing.T) {
+	buf := NewBufferWithSize(16)
+	buf.Append([]byte("hello, world"))
+	v := buf.PeekView(5)
+	if v.String() != "hello" {
+		t.Errorf("v.String() = %q, want %q", v.String(), "hello")
+	}
+	if buf.ReadableBytes() != 12 {
+		t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 12)
+	}
+
+	// compaction must not touch the viewed bytes
+	buf.Retrieve(7)
+	buf.Append(bytes.Repeat([]byte("x"), 10))
+	if v.String() != "hello" {
+		t.Errorf("after compaction, v.String() = %q, want %q", v.String(), "hello")
+	}
+	if got := string(buf.PeekAllAsByteSlice()); got != "world"+"xxxxxxxxxx" {
+		t.Errorf("after compaction, readable bytes are %q", got)
+	}
+	v.Release()
+}
+
+func TestReadView(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("abcdef"))
+	v := buf.ReadView(3)
+	if buf.ReadableBytes() != 3 {
+		t.Errorf("buf.ReadableBytes() = %d, want %d", buf.ReadableBytes(), 3)
+	}
+
+	// prepend writes in front of readerIndex, where v lives
+	if err := buf.PrependUint16(0xffff); err != nil {
+		t.Errorf("buf.PrependUint16 error %v", err)
+	}
+	buf.RetrieveAll()
+	buf.Append([]byte("zzzzzz"))
+	if v.String() != "abc" {
+		t.Errorf("v.String() = %q, want %q", v.String(), "abc")
+	}
+
+	sub := v.Slice(1, 2)
+	v.Release()
+	if sub.String() != "b" {
+		t.Errorf("sub.String() = %q, want %q", sub.String(), "b")
+	}
+	sub.Release()
+}
+
+func TestViewRelease(t *testing.T) {
+	buf := NewBuffer()
+	buf.Append([]byte("abc"))
+	storage := &buf.buf[0]
+	v := buf.PeekView(3)
+	v.Release()
+	buf.RetrieveAll()
+	buf.Append([]byte("def"))
+	if &buf.buf[0] != storage {
+		t.Error("buffer did not reuse its storage after all views were released")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("v.Bytes() after v.Release() did not panic")
+		}
+	}()
+	v.Bytes()
+}
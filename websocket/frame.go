@@ -0,0 +1,389 @@
+// Package websocket decodes and encodes RFC 6455 WebSocket frames from
+// and to netbuffer.Buffers, and makes the HTTP upgrade handshake with the
+// httpcodec package.
+//
+// A Decoder takes frames from the input buffer of a connection, unmasks
+// their payloads in place with Buffer.Mask, and reassembles fragmented
+// messages. Payloads are returned as Views, without copying unless the
+// message was fragmented:
+//
+//	d := websocket.NewDecoder(websocket.ServerSide)
+//	for {
+//		m, err := d.Decode(input)
+//		if err == netbuffer.ErrShortBuffer {
+//			break
+//		}
+//		if err != nil {
+//			websocket.AppendClose(output, websocket.CloseCode(err), "", nil)
+//			...
+//		}
+//		switch m.Opcode {
+//		case websocket.Ping:
+//			websocket.AppendFrame(output, true, websocket.Pong, m.Payload.Bytes(), nil)
+//		...
+//		}
+//		m.Release()
+//	}
+//
+// Extensions, such as permessage-deflate, are not supported.
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+// Opcode is the type of a frame.
+type Opcode uint8
+
+// Opcodes of RFC 6455, section 5.2.
+const (
+	Continuation Opcode = 0x0
+	Text         Opcode = 0x1
+	Binary       Opcode = 0x2
+	Close        Opcode = 0x8
+	Ping         Opcode = 0x9
+	Pong         Opcode = 0xa
+)
+
+// IsControl reports whether op is the opcode of a control frame.
+func (op Opcode) IsControl() bool {
+	return op&0x8 != 0
+}
+
+// Close codes of RFC 6455, section 7.4.1.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+const (
+	maxControlPayload     = 125
+	defaultMaxMessageSize = 16 << 20
+)
+
+var (
+	// ErrMessageTooLarge is returned by Decode for a message longer than
+	// the limit of the decoder.
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+	// ErrInvalidUTF8 is returned by Decode for a text message, or the
+	// reason of a close frame, which is not valid UTF-8.
+	ErrInvalidUTF8 = errors.New("websocket: invalid UTF-8 text")
+)
+
+// CloseCode returns the close code to send for an error of Decode.
+func CloseCode(err error) int {
+	switch err {
+	case ErrMessageTooLarge:
+		return CloseMessageTooBig
+	case ErrInvalidUTF8:
+		return CloseInvalidPayload
+	}
+	return CloseProtocolError
+}
+
+// Role tells which end of a connection a Decoder runs on: frames from
+// clients must be masked, and frames from servers must not.
+type Role int
+
+// Roles of a Decoder.
+const (
+	ServerSide Role = iota // decodes frames sent by a client
+	ClientSide             // decodes frames sent by a server
+)
+
+// Message is a data message, whole, or a control frame.
+type Message struct {
+	Opcode  Opcode
+	Payload *netbuffer.View
+}
+
+// Release releases the payload of m.
+func (m *Message) Release() {
+	m.Payload.Release()
+}
+
+// Decoder decodes the frames of one connection.
+type Decoder struct {
+	role           Role
+	maxMessageSize int
+
+	opcode    Opcode            // of the fragmented message being received
+	fragments *netbuffer.Buffer // payloads of its frames so far, or nil
+}
+
+// NewDecoder returns a decoder for role, accepting messages of up to
+// 16 MiB.
+func NewDecoder(role Role) *Decoder {
+	return &Decoder{role: role, maxMessageSize: defaultMaxMessageSize}
+}
+
+// SetMaxMessageSize sets the longest message accepted, in bytes.
+func (d *Decoder) SetMaxMessageSize(n int) {
+	d.maxMessageSize = n
+}
+
+// header is the header of a frame.
+type header struct {
+	fin    bool
+	rsv    byte
+	opcode Opcode
+	masked bool
+	key    [4]byte
+	length uint64
+}
+
+// parseHeader parses the header at the beginning of p, and returns its
+// length, or 0 if p is shorter than the header.
+func parseHeader(p []byte) (header, int) {
+	var h header
+	if len(p) < 2 {
+		return h, 0
+	}
+	h.fin = p[0]&0x80 != 0
+	h.rsv = p[0] & 0x70
+	h.opcode = Opcode(p[0] & 0x0f)
+	h.masked = p[1]&0x80 != 0
+	n := 2
+	switch l := p[1] & 0x7f; l {
+	case 126:
+		if len(p) < n+2 {
+			return h, 0
+		}
+		h.length = uint64(binary.BigEndian.Uint16(p[n:]))
+		n += 2
+	case 127:
+		if len(p) < n+8 {
+			return h, 0
+		}
+		h.length = binary.BigEndian.Uint64(p[n:])
+		n += 8
+	default:
+		h.length = uint64(l)
+	}
+	if h.masked {
+		if len(p) < n+4 {
+			return h, 0
+		}
+		copy(h.key[:], p[n:n+4])
+		n += 4
+	}
+	return h, n
+}
+
+func (d *Decoder) check(h header) error {
+	switch {
+	case h.rsv != 0:
+		return fmt.Errorf("websocket: reserved bits %#x set without extension", h.rsv)
+	case h.masked != (d.role == ServerSide):
+		if h.masked {
+			return fmt.Errorf("websocket: masked frame from server")
+		}
+		return fmt.Errorf("websocket: unmasked frame from client")
+	case h.length>>63 != 0:
+		return fmt.Errorf("websocket: payload length with most significant bit set")
+	}
+	switch h.opcode {
+	case Close, Ping, Pong:
+		if !h.fin {
+			return fmt.Errorf("websocket: fragmented control frame")
+		}
+		if h.length > maxControlPayload {
+			return fmt.Errorf("websocket: control frame payload of %d bytes", h.length)
+		}
+		return nil
+	case Continuation:
+		if d.fragments == nil {
+			return fmt.Errorf("websocket: continuation frame without a message")
+		}
+	case Text, Binary:
+		if d.fragments != nil {
+			return fmt.Errorf("websocket: data frame inside a fragmented message")
+		}
+	default:
+		return fmt.Errorf("websocket: unknown opcode %#x", uint8(h.opcode))
+	}
+	received := 0
+	if d.fragments != nil {
+		received = d.fragments.ReadableBytes()
+	}
+	// the limit may have been lowered below the fragments received
+	if received > d.maxMessageSize || h.length > uint64(d.maxMessageSize-received) {
+		return ErrMessageTooLarge
+	}
+	return nil
+}
+
+// Decode removes frames from the beginning of the readable bytes of b
+// until it has a whole data message or a control frame, and returns it.
+// Control frames may arrive between the frames of a fragmented message.
+// If b holds no whole frame, it returns netbuffer.ErrShortBuffer, keeping
+// the fragments received so far. Any other error is fatal to the
+// connection; CloseCode tells the close code to send.
+func (d *Decoder) Decode(b *netbuffer.Buffer) (*Message, error) {
+	for {
+		h, n := parseHeader(b.PeekAllAsByteSlice())
+		if n == 0 {
+			return nil, netbuffer.ErrShortBuffer
+		}
+		if err := d.check(h); err != nil {
+			return nil, err
+		}
+		if uint64(b.ReadableBytes()-n) < h.length {
+			return nil, netbuffer.ErrShortBuffer
+		}
+		length := int(h.length)
+		b.Retrieve(n)
+		if h.masked {
+			if err := b.Mask(0, length, h.key); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case h.opcode.IsControl():
+			m := &Message{Opcode: h.opcode, Payload: b.ReadView(length)}
+			if h.opcode == Close {
+				if _, _, err := ParseClose(m.Payload.Bytes()); err != nil {
+					m.Release()
+					return nil, err
+				}
+			}
+			return m, nil
+
+		case h.opcode != Continuation && h.fin:
+			return d.message(h.opcode, b.ReadView(length))
+
+		default:
+			if h.opcode != Continuation {
+				d.opcode = h.opcode
+				d.fragments = netbuffer.NewBufferWithSize(length)
+			}
+			d.fragments.Append(b.PeekAsByteSlice(length))
+			b.Retrieve(length)
+			if h.fin {
+				fragments := d.fragments
+				d.fragments = nil
+				return d.message(d.opcode, fragments.ReadView(fragments.ReadableBytes()))
+			}
+		}
+	}
+}
+
+func (d *Decoder) message(op Opcode, payload *netbuffer.View) (*Message, error) {
+	if op == Text && !utf8.Valid(payload.Bytes()) {
+		payload.Release()
+		return nil, ErrInvalidUTF8
+	}
+	return &Message{Opcode: op, Payload: payload}, nil
+}
+
+// ParseClose parses the payload of a close frame. code is 0 if the
+// payload is empty.
+func ParseClose(payload []byte) (code int, reason string, err error) {
+	switch {
+	case len(payload) == 0:
+		return 0, "", nil
+	case len(payload) == 1:
+		return 0, "", fmt.Errorf("websocket: close frame payload of 1 byte")
+	}
+	code = int(binary.BigEndian.Uint16(payload))
+	if !validCloseCode(code) {
+		return 0, "", fmt.Errorf("websocket: invalid close code %d", code)
+	}
+	if !utf8.Valid(payload[2:]) {
+		return 0, "", ErrInvalidUTF8
+	}
+	return code, string(payload[2:]), nil
+}
+
+// validCloseCode reports whether code may be sent in a close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// NewMaskKey returns a random masking key, for the frames of a client.
+func NewMaskKey() (*[4]byte, error) {
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// AppendFrame appends a frame to b. Clients must mask their frames with a
+// key from NewMaskKey; servers pass a nil key.
+func AppendFrame(b *netbuffer.Buffer, fin bool, op Opcode, payload []byte, key *[4]byte) {
+	var hdr [14]byte
+	hdr[0] = byte(op)
+	if fin {
+		hdr[0] |= 0x80
+	}
+	n := 2
+	switch l := len(payload); {
+	case l <= 125:
+		hdr[1] = byte(l)
+	case l <= 0xffff:
+		hdr[1] = 126
+		binary.BigEndian.PutUint16(hdr[n:], uint16(l))
+		n += 2
+	default:
+		hdr[1] = 127
+		binary.BigEndian.PutUint64(hdr[n:], uint64(l))
+		n += 8
+	}
+	if key != nil {
+		hdr[1] |= 0x80
+		copy(hdr[n:], key[:])
+		n += 4
+	}
+	b.Append(hdr[:n])
+	if key == nil {
+		b.Append(payload)
+		return
+	}
+	// masked into the writable bytes, so that a Tap of b is passed the
+	// frame as sent
+	b.EnsureWritableBytes(len(payload))
+	p := b.WritableByteSlice()[:len(payload)]
+	for i, c := range payload {
+		p[i] = c ^ key[i&3]
+	}
+	b.HasWritten(len(payload))
+}
+
+// AppendClose appends a close frame with code and reason to b. A zero
+// code sends an empty payload. reason is truncated to 123 bytes, at the
+// beginning of a UTF-8 sequence, to fit a control frame.
+func AppendClose(b *netbuffer.Buffer, code int, reason string, key *[4]byte) {
+	var payload []byte
+	if code != 0 {
+		if n := maxControlPayload - 2; len(reason) > n {
+			for n > 0 && !utf8.RuneStart(reason[n]) {
+				n--
+			}
+			reason = reason[:n]
+		}
+		payload = make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+	}
+	AppendFrame(b, true, Close, payload, key)
+}
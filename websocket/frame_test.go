@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+)
+
+var rfcKey = [4]byte{0x37, 0xfa, 0x21, 0x3d}
+
+// The examples of RFC 6455, section 5.7.
+var (
+	unmaskedHello = []byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'}
+	maskedHello   = []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}
+	fragmented    = []byte{0x01, 0x03, 'H', 'e', 'l', 0x80, 0x02, 'l', 'o'}
+	unmaskedPing  = []byte{0x89, 0x05, 'H', 'e', 'l', 'l', 'o'}
+)
+
+func TestAppendFrame(t *testing.T) {
+	cases := []struct {
+		fin     bool
+		op      Opcode
+		payload []byte
+		key     *[4]byte
+		want    []byte
+	}{
+		{true, Text, []byte("Hello"), nil, unmaskedHello},
+		{true, Text, []byte("Hello"), &rfcKey, maskedHello},
+		{true, Ping, []byte("Hello"), nil, unmaskedPing},
+		{true, Binary, make([]byte, 256), nil, append([]byte{0x82, 0x7e, 0x01, 0x00}, make([]byte, 256)...)},
+		{true, Binary, make([]byte, 65536), nil, append([]byte{0x82, 0x7f, 0, 0, 0, 0, 0, 1, 0, 0}, make([]byte, 65536)...)},
+		{false, Text, []byte("Hel"), nil, fragmented[:5]},
+	}
+	for i, c := range cases {
+		b := netbuffer.NewBuffer()
+		AppendFrame(b, c.fin, c.op, c.payload, c.key)
+		if got := b.PeekAllAsByteSlice(); !bytes.Equal(got, c.want) {
+			t.Errorf("case %d: AppendFrame appended % x, want % x", i, got, c.want)
+		}
+	}
+}
+
+// concatTap concatenates the bytes appended to a Buffer.
+type concatTap struct {
+	bytes.Buffer
+}
+
+func (t *concatTap) Appended(p []byte)  { t.Write(p) }
+func (t *concatTap) Retrieved(p []byte) {}
+
+func TestAppendFrameTap(t *testing.T) {
+	b := netbuffer.NewBuffer()
+	tap := &concatTap{}
+	b.SetTap(tap)
+	payload := []byte("Hello")
+	AppendFrame(b, true, Text, payload, &rfcKey)
+	if !bytes.Equal(tap.Bytes(), maskedHello) {
+		t.Errorf("tap saw appended % x, want % x", tap.Bytes(), maskedHello)
+	}
+	if string(payload) != "Hello" {
+		t.Errorf("AppendFrame changed the payload to %q", payload)
+	}
+}
+
+// decodeAll feeds input to d a byte at a time and returns the messages
+// decoded, as strings prefixed with their opcode.
+func decodeAll(t *testing.T, d *Decoder, input []byte) []string {
+	t.Helper()
+	b := netbuffer.NewBuffer()
+	var got []string
+	for i := range input {
+		b.Append(input[i : i+1])
+		for {
+			m, err := d.Decode(b)
+			if err == netbuffer.ErrShortBuffer {
+				break
+			}
+			if err != nil {
+				t.Fatalf("d.Decode error %v at byte %d", err, i)
+			}
+			got = append(got, string(rune('0'+m.Opcode))+m.Payload.String())
+			m.Release()
+		}
+	}
+	return got
+}
+
+func TestDecode(t *testing.T) {
+	var input []byte
+	input = append(input, unmaskedHello...)
+	input = append(input, fragmented[:5]...)
+	input = append(input, unmaskedPing...) // between fragments
+	input = append(input, fragmented[5:]...)
+	big := netbuffer.NewBuffer()
+	AppendFrame(big, true, Binary, bytes.Repeat([]byte("x"), 70000), nil)
+	input = append(input, big.PeekAllAsByteSlice()...)
+	AppendClose(big, CloseGoingAway, "bye", nil)
+	input = append(input, big.PeekAllAsByteSlice()[big.ReadableBytes()-7:]...)
+
+	got := decodeAll(t, NewDecoder(ClientSide), input)
+	want := []string{"1Hello", "9Hello", "1Hello", "2" + string(bytes.Repeat([]byte("x"), 70000)), "8\x03\xe9bye"}
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d is %.20q, want %.20q", i, got[i], want[i])
+		}
+	}
+	code, reason, err := ParseClose([]byte(want[4][1:]))
+	if code != CloseGoingAway || reason != "bye" || err != nil {
+		t.Errorf("ParseClose returned %d, %q, %v", code, reason, err)
+	}
+}
+
+func TestDecodeMasked(t *testing.T) {
+	key, err := NewMaskKey()
+	if err != nil {
+		t.Fatalf("NewMaskKey error %v", err)
+	}
+	b := netbuffer.NewBuffer()
+	AppendFrame(b, false, Binary, []byte("frag"), key)
+	AppendFrame(b, true, Continuation, []byte("ment"), key)
+	input := append(append([]byte(nil), maskedHello...), b.PeekAllAsByteSlice()...)
+
+	got := decodeAll(t, NewDecoder(ServerSide), input)
+	if len(got) != 2 || got[0] != "1Hello" || got[1] != "2fragment" {
+		t.Errorf("decoded %q", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		role  Role
+		input []byte
+		code  int
+	}{
+		{"unmasked from client", ServerSide, unmaskedHello, CloseProtocolError},
+		{"masked from server", ClientSide, maskedHello, CloseProtocolError},
+		{"reserved bits", ClientSide, []byte{0xc1, 0x00}, CloseProtocolError},
+		{"unknown opcode", ClientSide, []byte{0x83, 0x00}, CloseProtocolError},
+		{"fragmented control", ClientSide, []byte{0x09, 0x00}, CloseProtocolError},
+		{"long control", ClientSide, []byte{0x89, 0x7e, 0x00, 0x7e}, CloseProtocolError},
+		{"continuation first", ClientSide, []byte{0x80, 0x00}, CloseProtocolError},
+		{"data inside fragments", ClientSide, []byte{0x01, 0x00, 0x81, 0x00}, CloseProtocolError},
+		{"length high bit", ClientSide, []byte{0x82, 0x7f, 0x80, 0, 0, 0, 0, 0, 0, 0}, CloseProtocolError},
+		{"too large", ClientSide, []byte{0x82, 0x7f, 0, 0, 0, 0, 0x10, 0, 0, 0}, CloseMessageTooBig},
+		{"invalid UTF-8", ClientSide, []byte{0x81, 0x02, 0xc3, 0x28}, CloseInvalidPayload},
+		{"close of 1 byte", ClientSide, []byte{0x88, 0x01, 0x03}, CloseProtocolError},
+		{"close code", ClientSide, []byte{0x88, 0x02, 0x03, 0xec}, CloseProtocolError},
+		{"close reason", ClientSide, []byte{0x88, 0x04, 0x03, 0xe8, 0xc3, 0x28}, CloseInvalidPayload},
+	}
+	for _, c := range cases {
+		b := netbuffer.NewBuffer()
+		b.Append(c.input)
+		d := NewDecoder(c.role)
+		var err error
+		for err == nil {
+			_, err = d.Decode(b)
+		}
+		if err == netbuffer.ErrShortBuffer {
+			t.Errorf("%s: d.Decode needs more bytes", c.name)
+		} else if code := CloseCode(err); code != c.code {
+			t.Errorf("%s: d.Decode error %v, close code %d, want %d", c.name, err, code, c.code)
+		}
+	}
+
+	// fragments add up to the limit
+	d := NewDecoder(ClientSide)
+	d.SetMaxMessageSize(4)
+	b := netbuffer.NewBuffer()
+	b.Append([]byte{0x02, 0x03, 'a', 'b', 'c', 0x80, 0x02, 'd', 'e'})
+	if _, err := d.Decode(b); err != ErrMessageTooLarge {
+		t.Errorf("d.Decode error %v, want %v", err, ErrMessageTooLarge)
+	}
+
+	// the limit is lowered below the fragments received
+	d = NewDecoder(ClientSide)
+	b.RetrieveAll()
+	b.Append([]byte{0x02, 0x03, 'a', 'b', 'c'})
+	if _, err := d.Decode(b); err != netbuffer.ErrShortBuffer {
+		t.Fatalf("d.Decode error %v, want %v", err, netbuffer.ErrShortBuffer)
+	}
+	d.SetMaxMessageSize(2)
+	b.Append([]byte{0x80, 0x01, 'd'})
+	if _, err := d.Decode(b); err != ErrMessageTooLarge {
+		t.Errorf("d.Decode after lowering the limit error %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+func TestAppendCloseLongReason(t *testing.T) {
+	// 2 byte runes, so that 123 bytes end in the middle of one
+	reason := string(bytes.Repeat([]byte("é"), 100))
+	b := netbuffer.NewBuffer()
+	AppendClose(b, CloseNormal, reason, nil)
+	msg, err := NewDecoder(ClientSide).Decode(b)
+	if err != nil {
+		t.Fatalf("Decode error %v", err)
+	}
+	defer msg.Release()
+	code, got, err := ParseClose(msg.Payload.Bytes())
+	if code != CloseNormal || got != reason[:122] || err != nil {
+		t.Errorf("ParseClose returned %d, %d bytes, %v, want %d, 122 bytes", code, len(got), err, CloseNormal)
+	}
+}
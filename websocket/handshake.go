@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/ZhangGuangxu/netbuffer/httpcodec"
+)
+
+// keyGUID is appended to Sec-WebSocket-Key to compute
+// Sec-WebSocket-Accept, RFC 6455 section 1.3.
+const keyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// AcceptKey returns the Sec-WebSocket-Accept value answering key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(keyGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hasToken reports whether a comma separated header of h contains token,
+// case-insensitively.
+func hasToken(h httpcodec.Header, name, token string) bool {
+	for _, v := range h[name] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade checks that req asks to upgrade its connection to WebSocket,
+// and returns the 101 response to send back, after which the connection
+// carries frames. If req is not a valid upgrade request, it returns an
+// error; respond with 400 Bad Request then.
+func Upgrade(req *httpcodec.Request) (*httpcodec.Response, error) {
+	switch {
+	case req.Method != "GET":
+		return nil, fmt.Errorf("websocket: upgrade request method %s", req.Method)
+	case req.Proto != "HTTP/1.1":
+		return nil, fmt.Errorf("websocket: upgrade request protocol %s", req.Proto)
+	case !hasToken(req.Header, "Connection", "upgrade"):
+		return nil, fmt.Errorf("websocket: missing Connection: upgrade")
+	case !hasToken(req.Header, "Upgrade", "websocket"):
+		return nil, fmt.Errorf("websocket: missing Upgrade: websocket")
+	case req.Header.Get("Sec-Websocket-Version") != "13":
+		return nil, fmt.Errorf("websocket: unsupported version %q", req.Header.Get("Sec-Websocket-Version"))
+	}
+	key := req.Header.Get("Sec-Websocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return nil, fmt.Errorf("websocket: invalid Sec-WebSocket-Key %q", key)
+	}
+	resp := &httpcodec.Response{StatusCode: 101, Header: make(httpcodec.Header)}
+	resp.Header.Set("Upgrade", "websocket")
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Sec-Websocket-Accept", AcceptKey(key))
+	return resp, nil
+}
+
+// NewUpgradeRequest returns a request to upgrade a connection to host to
+// WebSocket at target, such as "/chat", and the key to check the response
+// with CheckUpgradeResponse.
+func NewUpgradeRequest(host, target string) (*httpcodec.Request, string, error) {
+	var k [16]byte
+	if _, err := rand.Read(k[:]); err != nil {
+		return nil, "", err
+	}
+	key := base64.StdEncoding.EncodeToString(k[:])
+	req := &httpcodec.Request{Method: "GET", Target: target, Proto: "HTTP/1.1", Header: make(httpcodec.Header)}
+	req.Header.Set("Host", host)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-Websocket-Key", key)
+	req.Header.Set("Sec-Websocket-Version", "13")
+	return req, key, nil
+}
+
+// CheckUpgradeResponse checks that resp accepts the upgrade request sent
+// with key.
+func CheckUpgradeResponse(resp *httpcodec.Response, key string) error {
+	switch {
+	case resp.StatusCode != 101:
+		return fmt.Errorf("websocket: upgrade refused with status %d %s", resp.StatusCode, resp.Reason)
+	case !hasToken(resp.Header, "Connection", "upgrade"):
+		return fmt.Errorf("websocket: missing Connection: upgrade")
+	case !hasToken(resp.Header, "Upgrade", "websocket"):
+		return fmt.Errorf("websocket: missing Upgrade: websocket")
+	case resp.Header.Get("Sec-Websocket-Accept") != AcceptKey(key):
+		return fmt.Errorf("websocket: wrong Sec-WebSocket-Accept %q", resp.Header.Get("Sec-Websocket-Accept"))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/ZhangGuangxu/netbuffer"
+	"github.com/ZhangGuangxu/netbuffer/httpcodec"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// RFC 6455, section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey returned %q", got)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	req, key, err := NewUpgradeRequest("example.com", "/chat")
+	if err != nil {
+		t.Fatalf("NewUpgradeRequest error %v", err)
+	}
+	b := netbuffer.NewBuffer()
+	if err := httpcodec.AppendRequest(b, req); err != nil {
+		t.Fatalf("httpcodec.AppendRequest error %v", err)
+	}
+	parsed, err := httpcodec.NewRequestParser().Parse(b)
+	if err != nil {
+		t.Fatalf("parsing the upgrade request error %v", err)
+	}
+
+	resp, err := Upgrade(parsed)
+	if err != nil {
+		t.Fatalf("Upgrade error %v", err)
+	}
+	if err := httpcodec.AppendResponse(b, resp); err != nil {
+		t.Fatalf("httpcodec.AppendResponse error %v", err)
+	}
+	parsedResp, err := httpcodec.NewResponseParser().Parse(b)
+	if err != nil {
+		t.Fatalf("parsing the upgrade response error %v", err)
+	}
+	if err := CheckUpgradeResponse(parsedResp, key); err != nil {
+		t.Errorf("CheckUpgradeResponse error %v", err)
+	}
+	if err := CheckUpgradeResponse(parsedResp, "dGhlIHNhbXBsZSBub25jZQ=="); err == nil {
+		t.Errorf("CheckUpgradeResponse with another key succeeded")
+	}
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	valid := func() *httpcodec.Request {
+		return &httpcodec.Request{Method: "GET", Target: "/", Proto: "HTTP/1.1", Header: httpcodec.Header{
+			"Connection":            {"keep-alive, Upgrade"},
+			"Upgrade":               {"WebSocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		}}
+	}
+	if _, err := Upgrade(valid()); err != nil {
+		t.Fatalf("Upgrade error %v", err)
+	}
+	cases := []func(r *httpcodec.Request){
+		func(r *httpcodec.Request) { r.Method = "POST" },
+		func(r *httpcodec.Request) { r.Proto = "HTTP/1.0" },
+		func(r *httpcodec.Request) { r.Header.Del("Connection") },
+		func(r *httpcodec.Request) { r.Header.Set("Upgrade", "h2c") },
+		func(r *httpcodec.Request) { r.Header.Set("Sec-Websocket-Version", "8") },
+		func(r *httpcodec.Request) { r.Header.Set("Sec-Websocket-Key", "c2hvcnQ=") },
+	}
+	for i, change := range cases {
+		r := valid()
+		change(r)
+		if _, err := Upgrade(r); err == nil {
+			t.Errorf("case %d: Upgrade succeeded", i)
+		}
+	}
+}